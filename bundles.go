@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/vallard/stickypipe-agent/nxapi"
+)
+
+// annotateBundles marks the port-channels and their members in the set
+// from show port-channel summary and show vpc brief.  Interfaces we don't
+// have counters for are left out rather than sent up empty.
+func (ss *sampleSet) annotateBundles(channels []nxapi.PortChannel, vpc *nxapi.VPCBrief) {
+	// vPC number by port-channel.
+	vpcs := map[string]string{}
+	role := ""
+	if vpc != nil {
+		role = vpc.Vpc_Role
+		for _, p := range vpc.Peerlink {
+			vpcs[nxapi.CLIName(strings.ToLower(p.Peerlink_Ifindex))] = "peer-link"
+		}
+		for _, v := range vpc.Vpc {
+			vpcs[nxapi.CLIName(strings.ToLower(v.Vpc_Ifindex))] = v.Vpc_Id
+		}
+	}
+	for _, c := range channels {
+		id := vpcs[c.Port_Channel]
+		if s, ok := ss.samples[c.Port_Channel]; ok {
+			s.Aggregate = true
+			if id != "" {
+				s.VPC = id
+				s.VPCRole = role
+			}
+		}
+		for _, m := range c.Member {
+			s, ok := ss.samples[m.Port]
+			if !ok {
+				continue
+			}
+			s.Bundle = c.Port_Channel
+			if id != "" {
+				s.VPC = id
+				s.VPCRole = role
+			}
+		}
+	}
+}
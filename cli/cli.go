@@ -0,0 +1,215 @@
+package cli
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/* Parsers for the text output of switches we can only reach over SSH.  Each
+OS prints "show interfaces" a little differently but they all boil down to the
+same handful of numbers, so they all produce the same Interface.
+*/
+
+const (
+	IOS  = "IOS"
+	NXOS = "NX-OS"
+	EOS  = "EOS"
+)
+
+// Interface is what we can scrape about one interface.
+type Interface struct {
+	Name        string
+	Description string
+	AdminStatus string
+	OperStatus  string
+	Duplex      string
+	MTU         int
+	// Kbit/sec
+	Bandwidth uint64
+	// bits/sec
+	InRate  uint64
+	OutRate uint64
+
+	InPkts       uint64
+	InOctets     uint64
+	InUcast      uint64
+	InMulticast  uint64
+	InBroadcast  uint64
+	InErrors     uint64
+	InDiscards   uint64
+	CRC          uint64
+	Runts        uint64
+	Giants       uint64
+	OutPkts      uint64
+	OutOctets    uint64
+	OutUcast     uint64
+	OutMulticast uint64
+	OutBroadcast uint64
+	OutErrors    uint64
+	OutDiscards  uint64
+}
+
+// Version is what we can scrape out of show version.
+type Version struct {
+	OS       string
+	Hostname string
+	Model    string
+	Version  string
+	Serial   string
+}
+
+// DetectOS figures out which OS printed this show version.
+func DetectOS(showVersion string) string {
+	switch {
+	case strings.Contains(showVersion, "NX-OS") || strings.Contains(showVersion, "Nexus"):
+		return NXOS
+	case strings.Contains(showVersion, "Arista"):
+		return EOS
+	case strings.Contains(showVersion, "Cisco IOS") || strings.Contains(showVersion, "IOS-XE"):
+		return IOS
+	}
+	return ""
+}
+
+var versionPatterns = map[string]map[string]*regexp.Regexp{
+	IOS: {
+		"hostname": regexp.MustCompile(`(?m)^(\S+) uptime is`),
+		"model":    regexp.MustCompile(`(?m)^[Cc]isco (\S+) .*processor`),
+		"version":  regexp.MustCompile(`Version ([^,\s]+)`),
+		"serial":   regexp.MustCompile(`(?m)^(?:System serial number\s*:|Processor board ID) (\S+)`),
+	},
+	NXOS: {
+		"hostname": regexp.MustCompile(`(?m)^\s*Device name: (\S+)`),
+		"model":    regexp.MustCompile(`(?m)^\s*cisco (.+?) [Cc]hassis`),
+		"version":  regexp.MustCompile(`(?m)^\s*(?:NXOS|system): +version (\S+)`),
+		"serial":   regexp.MustCompile(`(?m)^\s*Processor Board ID (\S+)`),
+	},
+	EOS: {
+		"hostname": regexp.MustCompile(`(?m)^Hostname:\s+(\S+)`),
+		"model":    regexp.MustCompile(`(?m)^Arista (\S+)`),
+		"version":  regexp.MustCompile(`(?m)^Software image version:\s+(\S+)`),
+		"serial":   regexp.MustCompile(`(?m)^Serial number:\s+(\S+)`),
+	},
+}
+
+// ParseVersion pulls what it can out of show version.  EOS doesn't print the
+// hostname there so callers append the output of show hostname.
+func ParseVersion(out string) Version {
+	v := Version{OS: DetectOS(out)}
+	get := func(what string) string {
+		re, ok := versionPatterns[v.OS][what]
+		if !ok {
+			return ""
+		}
+		if m := re.FindStringSubmatch(out); m != nil {
+			return strings.TrimSpace(m[1])
+		}
+		return ""
+	}
+	v.Hostname = get("hostname")
+	v.Model = get("model")
+	v.Version = get("version")
+	v.Serial = get("serial")
+	return v
+}
+
+// ParseInterfaces parses show interfaces for os.
+func ParseInterfaces(os string, out string) []Interface {
+	switch os {
+	case IOS:
+		return ParseIOSInterfaces(out)
+	case NXOS:
+		return ParseNXOSInterfaces(out)
+	case EOS:
+		return ParseEOSInterfaces(out)
+	}
+	return nil
+}
+
+// counts finds all the "<number> <label>" pairs on a line, for example
+// "0 runts, 0 giants, 0 throttles" or "0 runts  0 giants  0 CRC".
+var countRe = regexp.MustCompile(`(\d+) ([A-Za-z][A-Za-z ]*[A-Za-z]|[A-Za-z])`)
+
+func counts(line string) map[string]uint64 {
+	c := map[string]uint64{}
+	for _, m := range countRe.FindAllStringSubmatch(line, -1) {
+		n, err := strconv.ParseUint(m[1], 10, 64)
+		if err != nil {
+			continue
+		}
+		c[m[2]] = n
+	}
+	return c
+}
+
+var (
+	descRe   = regexp.MustCompile(`^\s+Description: (.*)$`)
+	mtuRe    = regexp.MustCompile(`MTU (\d+) bytes`)
+	bwRe     = regexp.MustCompile(`BW (\d+) [Kk]bit`)
+	duplexRe = regexp.MustCompile(`(?i)^\s*(full|half|auto)[- ]duplex`)
+	rateRe   = regexp.MustCompile(`(input|output) rate ([\d.]+) ([A-Za-z/]+)`)
+)
+
+// common picks up the lines all three OSes print the same way.
+func (i *Interface) common(line string) {
+	if m := descRe.FindStringSubmatch(line); m != nil {
+		i.Description = strings.TrimSpace(m[1])
+	}
+	if m := mtuRe.FindStringSubmatch(line); m != nil {
+		i.MTU, _ = strconv.Atoi(m[1])
+	}
+	if m := bwRe.FindStringSubmatch(line); m != nil {
+		i.Bandwidth, _ = strconv.ParseUint(m[1], 10, 64)
+	}
+	if m := duplexRe.FindStringSubmatch(line); m != nil {
+		i.Duplex = strings.ToLower(m[1])
+	}
+	for _, m := range rateRe.FindAllStringSubmatch(line, -1) {
+		bps := rate(m[2], m[3])
+		if m[1] == "input" {
+			i.InRate = bps
+		} else {
+			i.OutRate = bps
+		}
+	}
+}
+
+// rate converts a rate like 1.23 kbps into bits per second.
+func rate(n string, unit string) uint64 {
+	f, err := strconv.ParseFloat(n, 64)
+	if err != nil {
+		return 0
+	}
+	switch strings.ToLower(unit) {
+	case "kbps":
+		f *= 1e3
+	case "mbps":
+		f *= 1e6
+	case "gbps":
+		f *= 1e9
+	}
+	return uint64(f)
+}
+
+// headerRe matches the first line of each interface, "Ethernet1/1 is up" or
+// "GigabitEthernet0/1 is administratively down, line protocol is down".
+var headerRe = regexp.MustCompile(`^(\S+) is (administratively down|up|down)(?:, line protocol is (\S+))?`)
+
+// blocks splits show interfaces into one chunk per interface.
+func blocks(out string) [][]string {
+	var b [][]string
+	for _, line := range strings.Split(strings.Replace(out, "\r", "", -1), "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if headerRe.MatchString(line) {
+			b = append(b, []string{line})
+			continue
+		}
+		if len(b) > 0 {
+			b[len(b)-1] = append(b[len(b)-1], line)
+		}
+	}
+	return b
+}
@@ -0,0 +1,257 @@
+package cli
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// header fills in the name and status from the first line of a block.
+func (i *Interface) header(line string) {
+	m := headerRe.FindStringSubmatch(line)
+	if m == nil {
+		return
+	}
+	i.Name = m[1]
+	switch m[2] {
+	case "administratively down":
+		i.AdminStatus = "down"
+		i.OperStatus = "down"
+	case "down":
+		i.AdminStatus = "up"
+		i.OperStatus = "down"
+	default:
+		i.AdminStatus = "up"
+		i.OperStatus = "up"
+	}
+	// line protocol is the real operational status on IOS and EOS.
+	if m[3] != "" {
+		i.OperStatus = m[3]
+	}
+}
+
+var (
+	iosInDropsRe  = regexp.MustCompile(`Input queue: \d+/\d+/(\d+)/\d+`)
+	iosOutDropsRe = regexp.MustCompile(`Total output drops: (\d+)`)
+)
+
+/* ParseIOSInterfaces parses IOS show interfaces:
+
+GigabitEthernet0/10 is up, line protocol is up (connected)
+  Description: uplink
+  MTU 1500 bytes, BW 1000000 Kbit/sec, DLY 10 usec,
+  Full-duplex, 1000Mb/s, media type is 10/100/1000BaseTX
+  Input queue: 0/75/0/0 (size/max/drops/flushes); Total output drops: 0
+  5 minute input rate 2000 bits/sec, 3 packets/sec
+  5 minute output rate 9000 bits/sec, 8 packets/sec
+     3866362551 packets input, 345343003 bytes, 0 no buffer
+     Received 1234 broadcasts (567 multicasts)
+     0 runts, 0 giants, 0 throttles
+     0 input errors, 0 CRC, 0 frame, 0 overrun, 0 ignored
+     123 packets output, 456 bytes, 0 underruns
+     0 output errors, 0 collisions, 1 interface resets
+*/
+func ParseIOSInterfaces(out string) []Interface {
+	ifaces := []Interface{}
+	for _, b := range blocks(out) {
+		i := Interface{}
+		i.header(b[0])
+		for _, line := range b[1:] {
+			i.common(line)
+			if m := iosInDropsRe.FindStringSubmatch(line); m != nil {
+				i.InDiscards, _ = strconv.ParseUint(m[1], 10, 64)
+			}
+			if m := iosOutDropsRe.FindStringSubmatch(line); m != nil {
+				i.OutDiscards, _ = strconv.ParseUint(m[1], 10, 64)
+			}
+			i.ciscoStyleCounters(line)
+		}
+		ifaces = append(ifaces, i)
+	}
+	return ifaces
+}
+
+/* ParseEOSInterfaces parses EOS show interfaces, which copies the IOS layout
+with a few extra counters:
+
+Ethernet1 is up, line protocol is up (connected)
+  Description: to spine1
+  Ethernet MTU 9214 bytes , BW 10000000 kbit
+  Full-duplex, 10Gb/s, auto negotiation: off, uni-link: n/a
+  5 minutes input rate 1.23 kbps (0.0% with framing overhead), 1 packets/sec
+  5 minutes output rate 4.56 kbps (0.0% with framing overhead), 2 packets/sec
+     1234 packets input, 567890 bytes
+     Received 12 broadcasts, 34 multicast
+     0 runts, 0 giants
+     0 input errors, 0 CRC, 0 alignment, 0 symbol, 0 input discards
+     2345 packets output, 678901 bytes
+     Sent 12 broadcasts, 34 multicast
+     0 output errors, 0 collisions
+     0 late collision, 0 deferred, 0 output discards
+*/
+func ParseEOSInterfaces(out string) []Interface {
+	ifaces := []Interface{}
+	for _, b := range blocks(out) {
+		i := Interface{}
+		i.header(b[0])
+		for _, line := range b[1:] {
+			i.common(line)
+			i.ciscoStyleCounters(line)
+			c := counts(line)
+			if v, ok := c["input discards"]; ok {
+				i.InDiscards = v
+			}
+			if v, ok := c["output discards"]; ok {
+				i.OutDiscards = v
+			}
+		}
+		ifaces = append(ifaces, i)
+	}
+	return ifaces
+}
+
+// ciscoStyleCounters handles the counter lines IOS and EOS share.  The
+// direction of "bytes" and "broadcasts" depends on what else is on the line.
+func (i *Interface) ciscoStyleCounters(line string) {
+	c := counts(line)
+	trimmed := strings.TrimSpace(line)
+	switch {
+	case strings.Contains(line, "packets input"):
+		i.InPkts = c["packets input"]
+		i.InOctets = c["bytes"]
+	case strings.Contains(line, "packets output"):
+		i.OutPkts = c["packets output"]
+		i.OutOctets = c["bytes"]
+	case strings.HasPrefix(trimmed, "Received"):
+		i.InBroadcast = c["broadcasts"]
+		i.InMulticast = c["multicasts"] + c["multicast"]
+	case strings.HasPrefix(trimmed, "Sent"):
+		i.OutBroadcast = c["broadcasts"]
+		i.OutMulticast = c["multicasts"] + c["multicast"]
+	}
+	if v, ok := c["runts"]; ok {
+		i.Runts = v
+	}
+	if v, ok := c["giants"]; ok {
+		i.Giants = v
+	}
+	if v, ok := c["input errors"]; ok {
+		i.InErrors = v
+	}
+	if v, ok := c["CRC"]; ok {
+		i.CRC = v
+	}
+	if v, ok := c["output errors"]; ok {
+		i.OutErrors = v
+	}
+}
+
+var nxosAdminRe = regexp.MustCompile(`^admin state is (\w+)`)
+
+/* ParseNXOSInterfaces parses NX-OS show interface, which splits the counters
+into RX and TX sections:
+
+Ethernet1/1 is up
+admin state is up, Dedicated Interface
+  Description: uplink
+  MTU 1500 bytes, BW 10000000 Kbit, DLY 10 usec
+  full-duplex, 10 Gb/s, media type is 10G
+  30 seconds input rate 1234 bits/sec, 1 packets/sec
+  30 seconds output rate 5678 bits/sec, 2 packets/sec
+  RX
+    123 unicast packets  456 multicast packets  7 broadcast packets
+    586 input packets  123456 bytes
+    0 runts  0 giants  0 CRC  0 no buffer
+    0 input error  0 short frame  0 overrun   0 underrun  0 ignored
+    0 input with dribble  0 input discard
+  TX
+    123 unicast packets  456 multicast packets  7 broadcast packets
+    586 output packets  123456 bytes
+    0 output error  0 collision  0 deferred  0 late collision
+    0 lost carrier  0 no carrier  0 babble  0 output discard
+*/
+func ParseNXOSInterfaces(out string) []Interface {
+	ifaces := []Interface{}
+	for _, b := range blocks(out) {
+		i := Interface{}
+		i.header(b[0])
+		// NX-OS says "is down (Administratively down)" and then tells us
+		// the admin state on the next line.
+		if strings.Contains(b[0], "Administratively down") {
+			i.AdminStatus = "down"
+		}
+		section := ""
+		for _, line := range b[1:] {
+			if m := nxosAdminRe.FindStringSubmatch(line); m != nil {
+				i.AdminStatus = m[1]
+				continue
+			}
+			// mgmt0 says Rx and Tx.
+			trimmed := strings.ToUpper(strings.TrimSpace(line))
+			if trimmed == "RX" || trimmed == "TX" {
+				section = trimmed
+				continue
+			}
+			i.common(line)
+			c := counts(line)
+			switch section {
+			case "RX":
+				if v, ok := c["unicast packets"]; ok {
+					i.InUcast = v
+				}
+				if v, ok := c["multicast packets"]; ok {
+					i.InMulticast = v
+				}
+				if v, ok := c["broadcast packets"]; ok {
+					i.InBroadcast = v
+				}
+				if v, ok := c["input packets"]; ok {
+					i.InPkts = v
+				}
+				// mgmt0 puts bytes on the line after.
+				if v, ok := c["bytes"]; ok {
+					i.InOctets = v
+				}
+				if v, ok := c["runts"]; ok {
+					i.Runts = v
+				}
+				if v, ok := c["giants"]; ok {
+					i.Giants = v
+				}
+				if v, ok := c["CRC"]; ok {
+					i.CRC = v
+				}
+				if v, ok := c["input error"]; ok {
+					i.InErrors = v
+				}
+				if v, ok := c["input discard"]; ok {
+					i.InDiscards = v
+				}
+			case "TX":
+				if v, ok := c["unicast packets"]; ok {
+					i.OutUcast = v
+				}
+				if v, ok := c["multicast packets"]; ok {
+					i.OutMulticast = v
+				}
+				if v, ok := c["broadcast packets"]; ok {
+					i.OutBroadcast = v
+				}
+				if v, ok := c["output packets"]; ok {
+					i.OutPkts = v
+				}
+				if v, ok := c["bytes"]; ok {
+					i.OutOctets = v
+				}
+				if v, ok := c["output error"]; ok {
+					i.OutErrors = v
+				}
+				if v, ok := c["output discard"]; ok {
+					i.OutDiscards = v
+				}
+			}
+		}
+		ifaces = append(ifaces, i)
+	}
+	return ifaces
+}
@@ -0,0 +1,408 @@
+package cli
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// show interfaces from a Catalyst 2960G on 12.2(55)SE, trimmed to a port
+// that's up, one that's shut and a VLAN interface.  IOS ends lines with \r\n.
+var iosShowInterfaces = strings.Replace(`GigabitEthernet0/1 is up, line protocol is up (connected)
+  Hardware is Gigabit Ethernet, address is 0022.5579.a081 (bia 0022.5579.a081)
+  Description: uplink to core
+  MTU 1500 bytes, BW 1000000 Kbit/sec, DLY 10 usec,
+     reliability 255/255, txload 1/255, rxload 1/255
+  Encapsulation ARPA, loopback not set
+  Keepalive set (10 sec)
+  Full-duplex, 1000Mb/s, media type is 10/100/1000BaseTX
+  input flow-control is off, output flow-control is unsupported
+  ARP type: ARPA, ARP Timeout 04:00:00
+  Last input 00:00:01, output 00:00:00, output hang never
+  Last clearing of "show interface" counters never
+  Input queue: 0/75/12/0 (size/max/drops/flushes); Total output drops: 34
+  Queueing strategy: fifo
+  Output queue: 0/40 (size/max)
+  5 minute input rate 2000 bits/sec, 3 packets/sec
+  5 minute output rate 9000 bits/sec, 8 packets/sec
+     3866362551 packets input, 18446744073709551000 bytes, 0 no buffer
+     Received 1234 broadcasts (567 multicasts)
+     1 runts, 2 giants, 0 throttles
+     5 input errors, 3 CRC, 0 frame, 0 overrun, 0 ignored
+     0 watchdog, 567 multicast, 0 pause input
+     0 input packets with dribble condition detected
+     123 packets output, 456 bytes, 0 underruns
+     7 output errors, 0 collisions, 1 interface resets
+     0 unknown protocol drops
+     0 babbles, 0 late collision, 0 deferred
+     0 lost carrier, 0 no carrier, 0 PAUSE output
+     0 output buffer failures, 0 output buffers swapped out
+GigabitEthernet0/2 is administratively down, line protocol is down (disabled)
+  Hardware is Gigabit Ethernet, address is 0022.5579.a082 (bia 0022.5579.a082)
+  MTU 1500 bytes, BW 10000 Kbit/sec, DLY 1000 usec,
+  Auto-duplex, Auto-speed, media type is 10/100/1000BaseTX
+  Input queue: 0/75/0/0 (size/max/drops/flushes); Total output drops: 0
+  5 minute input rate 0 bits/sec, 0 packets/sec
+  5 minute output rate 0 bits/sec, 0 packets/sec
+     0 packets input, 0 bytes, 0 no buffer
+     Received 0 broadcasts (0 multicasts)
+     0 runts, 0 giants, 0 throttles
+     0 input errors, 0 CRC, 0 frame, 0 overrun, 0 ignored
+     0 packets output, 0 bytes, 0 underruns
+     0 output errors, 0 collisions, 0 interface resets
+Vlan1 is up, line protocol is down
+  Hardware is EtherSVI, address is 0022.5579.a0c0 (bia 0022.5579.a0c0)
+  MTU 1500 bytes, BW 1000000 Kbit/sec, DLY 10 usec,
+  5 minute input rate 0 bits/sec, 0 packets/sec
+  5 minute output rate 0 bits/sec, 0 packets/sec
+     10 packets input, 640 bytes, 0 no buffer
+     Received 0 broadcasts (0 IP multicasts)
+     0 runts, 0 giants, 0 throttles
+     0 input errors, 0 CRC, 0 frame, 0 overrun, 0 ignored
+     20 packets output, 1280 bytes, 0 underruns
+     0 output errors, 0 interface resets
+`, "\n", "\r\n", -1)
+
+// show interface from a Nexus 9000 on 7.0(3)I7(6).
+const nxosShowInterface = `
+mgmt0 is up
+admin state is up,
+  Hardware: GigabitEthernet, address: 00fe.c8b2.1a00 (bia 00fe.c8b2.1a00)
+  Internet Address is 10.93.234.3/24
+  MTU 1500 bytes, BW 1000000 Kbit, DLY 10 usec
+  reliability 255/255, txload 1/255, rxload 1/255
+  Encapsulation ARPA, medium is broadcast
+  full-duplex, 1000 Mb/s
+  Auto-Negotiation is turned on
+  Auto-mdix is turned off
+  EtherType is 0x0000
+  1 minute input rate 6392 bits/sec, 8 packets/sec
+  1 minute output rate 3272 bits/sec, 1 packets/sec
+  Rx
+    3316254 input packets 1873931 unicast packets 1371052 multicast packets
+    71270 broadcast packets 2061366451 bytes
+  Tx
+    1411383 output packets 1403159 unicast packets 8210 multicast packets
+    14 broadcast packets 306291436 bytes
+
+Ethernet1/1 is up
+admin state is up, Dedicated Interface
+  Hardware: 100/1000/10000/25000 Ethernet, address: 00fe.c8b2.1a08 (bia 00fe.c8b2.1a08)
+  Description: to spine1 Eth1/49
+  MTU 9216 bytes, BW 10000000 Kbit, DLY 10 usec
+  reliability 255/255, txload 1/255, rxload 1/255
+  Encapsulation ARPA, medium is broadcast
+  Port mode is trunk
+  full-duplex, 10 Gb/s, media type is 10G
+  Beacon is turned off
+  Auto-Negotiation is turned on  FEC mode is Auto
+  Input flow-control is off, output flow-control is off
+  Last link flapped 12week(s) 3day(s)
+  Last clearing of "show interface" counters never
+  1 interface resets
+  30 seconds input rate 1234 bits/sec, 1 packets/sec
+  30 seconds output rate 5678 bits/sec, 2 packets/sec
+  Load-Interval #2: 5 minute (300 seconds)
+    input rate 1.02 Kbps, 1 pps; output rate 4.51 Kbps, 2 pps
+  RX
+    9007199254740993 unicast packets  456 multicast packets  7 broadcast packets
+    9007199254741456 input packets  123456 bytes
+    0 jumbo packets  0 storm suppression packets
+    1 runts  2 giants  3 CRC  0 no buffer
+    4 input error  0 short frame  0 overrun   0 underrun  0 ignored
+    0 watchdog  0 bad etype drop  0 bad proto drop  0 if down drop
+    0 input with dribble  5 input discard
+    0 Rx pause
+  TX
+    321 unicast packets  654 multicast packets  8 broadcast packets
+    983 output packets  654321 bytes
+    0 jumbo packets
+    6 output error  0 collision  0 deferred  0 late collision
+    0 lost carrier  0 no carrier  0 babble  7 output discard
+    0 Tx pause
+
+Ethernet1/2 is down (Administratively down)
+admin state is down, Dedicated Interface
+  Hardware: 100/1000/10000/25000 Ethernet, address: 00fe.c8b2.1a09 (bia 00fe.c8b2.1a09)
+  MTU 1500 bytes, BW 10000000 Kbit, DLY 10 usec
+  auto-duplex, auto-speed
+  RX
+    0 unicast packets  0 multicast packets  0 broadcast packets
+    0 input packets  0 bytes
+  TX
+    0 unicast packets  0 multicast packets  0 broadcast packets
+    0 output packets  0 bytes
+`
+
+// show interfaces from a 7050 on EOS 4.20.
+const eosShowInterfaces = `Ethernet1 is up, line protocol is up (connected)
+  Hardware is Ethernet, address is 2899.3a8e.1b01 (bia 2899.3a8e.1b01)
+  Description: to spine1
+  Ethernet MTU 9214 bytes , BW 10000000 kbit
+  Full-duplex, 10Gb/s, auto negotiation: off, uni-link: n/a
+  Up 12 days, 3 hours, 4 minutes, 5 seconds
+  Loopback Mode : None
+  4 link status changes since last clear
+  Last clearing of "show interface" counters never
+  5 minutes input rate 1.23 kbps (0.0% with framing overhead), 1 packets/sec
+  5 minutes output rate 4.56 Mbps (0.0% with framing overhead), 2 packets/sec
+     1234 packets input, 567890 bytes
+     Received 12 broadcasts, 34 multicast
+     1 runts, 2 giants
+     3 input errors, 4 CRC, 0 alignment, 0 symbol, 5 input discards
+     0 PAUSE input
+     2345 packets output, 678901 bytes
+     Sent 56 broadcasts, 78 multicast
+     6 output errors, 0 collisions
+     0 late collision, 0 deferred, 7 output discards
+     0 PAUSE output
+Ethernet2 is down, line protocol is notpresent (notconnect)
+  Hardware is Ethernet, address is 2899.3a8e.1b02 (bia 2899.3a8e.1b02)
+  Ethernet MTU 9214 bytes , BW 10000000 kbit
+  Full-duplex, 10Gb/s, auto negotiation: off, uni-link: n/a
+  5 minutes input rate 0 bps (0.0% with framing overhead), 0 packets/sec
+  5 minutes output rate 0 bps (0.0% with framing overhead), 0 packets/sec
+     0 packets input, 0 bytes
+     Received 0 broadcasts, 0 multicast
+     0 runts, 0 giants
+     0 input errors, 0 CRC, 0 alignment, 0 symbol, 0 input discards
+     0 packets output, 0 bytes
+     Sent 0 broadcasts, 0 multicast
+     0 output errors, 0 collisions
+     0 late collision, 0 deferred, 0 output discards
+`
+
+func TestParseIOSInterfaces(t *testing.T) {
+	want := []Interface{
+		{
+			Name:        "GigabitEthernet0/1",
+			Description: "uplink to core",
+			AdminStatus: "up",
+			OperStatus:  "up",
+			Duplex:      "full",
+			MTU:         1500,
+			Bandwidth:   1000000,
+			InRate:      2000,
+			OutRate:     9000,
+			InPkts:      3866362551,
+			InOctets:    18446744073709551000,
+			InMulticast: 567,
+			InBroadcast: 1234,
+			InErrors:    5,
+			InDiscards:  12,
+			CRC:         3,
+			Runts:       1,
+			Giants:      2,
+			OutPkts:     123,
+			OutOctets:   456,
+			OutErrors:   7,
+			OutDiscards: 34,
+		},
+		{
+			Name:        "GigabitEthernet0/2",
+			AdminStatus: "down",
+			OperStatus:  "down",
+			Duplex:      "auto",
+			MTU:         1500,
+			Bandwidth:   10000,
+		},
+		{
+			Name:        "Vlan1",
+			AdminStatus: "up",
+			OperStatus:  "down",
+			MTU:         1500,
+			Bandwidth:   1000000,
+			InPkts:      10,
+			InOctets:    640,
+			OutPkts:     20,
+			OutOctets:   1280,
+		},
+	}
+	got := ParseInterfaces(IOS, iosShowInterfaces)
+	checkInterfaces(t, got, want)
+}
+
+func TestParseNXOSInterfaces(t *testing.T) {
+	want := []Interface{
+		{
+			Name:         "mgmt0",
+			AdminStatus:  "up",
+			OperStatus:   "up",
+			Duplex:       "full",
+			MTU:          1500,
+			Bandwidth:    1000000,
+			InRate:       6392,
+			OutRate:      3272,
+			InPkts:       3316254,
+			InOctets:     2061366451,
+			InUcast:      1873931,
+			InMulticast:  1371052,
+			InBroadcast:  71270,
+			OutPkts:      1411383,
+			OutOctets:    306291436,
+			OutUcast:     1403159,
+			OutMulticast: 8210,
+			OutBroadcast: 14,
+		},
+		{
+			Name:         "Ethernet1/1",
+			Description:  "to spine1 Eth1/49",
+			AdminStatus:  "up",
+			OperStatus:   "up",
+			Duplex:       "full",
+			MTU:          9216,
+			Bandwidth:    10000000,
+			InRate:       1020,
+			OutRate:      4510,
+			InPkts:       9007199254741456,
+			InOctets:     123456,
+			InUcast:      9007199254740993,
+			InMulticast:  456,
+			InBroadcast:  7,
+			InErrors:     4,
+			InDiscards:   5,
+			CRC:          3,
+			Runts:        1,
+			Giants:       2,
+			OutPkts:      983,
+			OutOctets:    654321,
+			OutUcast:     321,
+			OutMulticast: 654,
+			OutBroadcast: 8,
+			OutErrors:    6,
+			OutDiscards:  7,
+		},
+		{
+			Name:        "Ethernet1/2",
+			AdminStatus: "down",
+			OperStatus:  "down",
+			Duplex:      "auto",
+			MTU:         1500,
+			Bandwidth:   10000000,
+		},
+	}
+	got := ParseInterfaces(NXOS, nxosShowInterface)
+	checkInterfaces(t, got, want)
+}
+
+func TestParseEOSInterfaces(t *testing.T) {
+	want := []Interface{
+		{
+			Name:         "Ethernet1",
+			Description:  "to spine1",
+			AdminStatus:  "up",
+			OperStatus:   "up",
+			Duplex:       "full",
+			MTU:          9214,
+			Bandwidth:    10000000,
+			InRate:       1230,
+			OutRate:      4560000,
+			InPkts:       1234,
+			InOctets:     567890,
+			InMulticast:  34,
+			InBroadcast:  12,
+			InErrors:     3,
+			InDiscards:   5,
+			CRC:          4,
+			Runts:        1,
+			Giants:       2,
+			OutPkts:      2345,
+			OutOctets:    678901,
+			OutMulticast: 78,
+			OutBroadcast: 56,
+			OutErrors:    6,
+			OutDiscards:  7,
+		},
+		{
+			Name:        "Ethernet2",
+			AdminStatus: "up",
+			OperStatus:  "notpresent",
+			Duplex:      "full",
+			MTU:         9214,
+			Bandwidth:   10000000,
+		},
+	}
+	got := ParseInterfaces(EOS, eosShowInterfaces)
+	checkInterfaces(t, got, want)
+}
+
+func TestParseInterfacesUnknownOS(t *testing.T) {
+	if got := ParseInterfaces("JunOS", iosShowInterfaces); got != nil {
+		t.Errorf("got %+v", got)
+	}
+}
+
+func checkInterfaces(t *testing.T, got []Interface, want []Interface) {
+	if len(got) != len(want) {
+		t.Fatalf("got %d interfaces, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if !reflect.DeepEqual(got[i], want[i]) {
+			t.Errorf("%s:\ngot  %+v\nwant %+v", want[i].Name, got[i], want[i])
+		}
+	}
+}
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		name string
+		out  string
+		want Version
+	}{
+		{
+			name: "IOS",
+			out: `Cisco IOS Software, C2960 Software (C2960-LANBASEK9-M), Version 12.2(55)SE, RELEASE SOFTWARE (fc2)
+Technical Support: http://www.cisco.com/techsupport
+
+ROM: Bootstrap program is C2960 boot loader
+
+c2960g uptime is 1 year, 12 weeks, 3 days, 4 hours, 5 minutes
+System returned to ROM by power-on
+System image file is "flash:c2960-lanbasek9-mz.122-55.SE.bin"
+
+cisco WS-C2960G-24TC-L (PowerPC405) processor (revision G0) with 65536K bytes of memory.
+Processor board ID FOC1234X5YZ
+Last reset from power-on
+`,
+			want: Version{OS: IOS, Hostname: "c2960g", Model: "WS-C2960G-24TC-L", Version: "12.2(55)SE", Serial: "FOC1234X5YZ"},
+		},
+		{
+			name: "NX-OS",
+			out: `Cisco Nexus Operating System (NX-OS) Software
+TAC support: http://www.cisco.com/tac
+
+Software
+  BIOS: version 07.61
+  NXOS: version 7.0(3)I7(6)
+
+Hardware
+  cisco Nexus9000 C93180YC-EX chassis
+  Intel(R) Xeon(R) CPU  @ 1.80GHz with 24633916 kB of memory.
+  Processor Board ID FDO21120U8N
+
+  Device name: n9k-leaf1
+  bootflash:   53298520 kB
+`,
+			want: Version{OS: NXOS, Hostname: "n9k-leaf1", Model: "Nexus9000 C93180YC-EX", Version: "7.0(3)I7(6)", Serial: "FDO21120U8N"},
+		},
+		{
+			name: "EOS",
+			out: `Arista DCS-7050SX-64-F
+Hardware version:    01.11
+Serial number:       JPE14080457
+System MAC address:  001c.7329.2fa1
+
+Software image version: 4.20.1F
+Architecture:           i386
+Hostname: leaf2
+FQDN:     leaf2.example.com
+`,
+			want: Version{OS: EOS, Hostname: "leaf2", Model: "DCS-7050SX-64-F", Version: "4.20.1F", Serial: "JPE14080457"},
+		},
+	}
+	for _, tt := range tests {
+		if got := ParseVersion(tt.out); got != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
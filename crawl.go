@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// Neighbor crawling settings, set from the environment in main.  Nothing
+// is crawled unless crawler is set.
+var crawlSettings struct {
+	// a neighbor is only probed if it is in one of Allow, or Allow is
+	// empty, and not in any of Deny.
+	Allow []*net.IPNet
+	Deny  []*net.IPNet
+}
+
+var crawler *neighborCrawler
+
+// neighborCrawler probes the management addresses of our switches'
+// neighbors with the discovery credentials and polls the ones that answer,
+// so it finds its way around the network from a few seed switches.
+type neighborCrawler struct {
+	devices *endpointList
+	queue   chan crawlCandidate
+	mutex   sync.Mutex
+	// when we last tried an address, so a neighbor that won't answer isn't
+	// probed every minute.
+	tried map[string]time.Time
+}
+
+// crawlCandidate is a neighbor address and how we heard of it.
+type crawlCandidate struct {
+	address  string
+	protocol string
+	via      string
+}
+
+// how long before we try a neighbor that didn't answer again, when
+// discoverySettings.Interval doesn't say.
+const crawlRetry = 24 * time.Hour
+
+func newNeighborCrawler(devices *endpointList) *neighborCrawler {
+	return &neighborCrawler{
+		devices: devices,
+		queue:   make(chan crawlCandidate, 1024),
+		tried:   map[string]time.Time{},
+	}
+}
+
+// crawlAllowed says if the crawl policy lets us probe ip.
+func crawlAllowed(ip net.IP) bool {
+	for _, n := range crawlSettings.Deny {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	if len(crawlSettings.Allow) == 0 {
+		return true
+	}
+	for _, n := range crawlSettings.Allow {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// neighbors queues the management addresses of sw's neighbors we don't
+// poll yet.  It doesn't wait on the probes.
+func (c *neighborCrawler) neighbors(sw string, neighbors []Neighbor) {
+	retry := discoverySettings.Interval
+	if retry <= 0 {
+		retry = crawlRetry
+	}
+	now := time.Now()
+	for _, n := range neighbors {
+		ip := net.ParseIP(n.MgmtAddress).To4()
+		// endpoints are host:method so IPv6 addresses won't do.
+		if ip == nil || !crawlAllowed(ip) {
+			continue
+		}
+		a := ip.String()
+		if c.devices.has(a) {
+			continue
+		}
+		c.mutex.Lock()
+		last, ok := c.tried[a]
+		if ok && now.Sub(last) < retry {
+			c.mutex.Unlock()
+			continue
+		}
+		c.tried[a] = now
+		c.mutex.Unlock()
+		select {
+		case c.queue <- crawlCandidate{address: a, protocol: n.Protocol, via: sw}:
+		default:
+			// full, we'll hear about it again next time around.
+			c.mutex.Lock()
+			delete(c.tried, a)
+			c.mutex.Unlock()
+		}
+	}
+}
+
+/*
+	Probe the neighbors queued by neighbors and add the ones that answer.
+
+Arguments:
+
+	ctx - stops crawling when cancelled
+
+Probes are rate limited the same as the sweep.
+*/
+func (c *neighborCrawler) run(ctx context.Context) {
+	for {
+		var first crawlCandidate
+		select {
+		case <-ctx.Done():
+			return
+		case first = <-c.queue:
+		}
+		// take everything waiting so the probes run alongside each other.
+		batch := map[string]crawlCandidate{first.address: first}
+	drain:
+		for {
+			select {
+			case n := <-c.queue:
+				batch[n.address] = n
+			default:
+				break drain
+			}
+		}
+		addrs := []string{}
+		for a := range batch {
+			addrs = append(addrs, a)
+		}
+		sweep(ctx, addrs, func(p probeResult) {
+			n := batch[p.address]
+			addDiscovered(c.devices, p, n.protocol, n.via)
+		})
+	}
+}
+
+// sendNeighbors sends the report, if there's anything in it, and crawls
+// the neighbors in it.
+func sendNeighbors(r NeighborReport) {
+	if len(r.Neighbors) == 0 {
+		return
+	}
+	sendUpstream(r)
+	if crawler != nil {
+		crawler.neighbors(r.Switch, r.Neighbors)
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+
+	"github.com/vallard/stickypipe-agent/nxapi"
+)
+
+// DeviceInfo is the inventory metadata we report for each switch along with
+// its counters so stickypipe knows what it's looking at.
+type DeviceInfo struct {
+	Hostname        string `json:"hostname"`
+	Vendor          string `json:"vendor,omitempty"`
+	Model           string `json:"model,omitempty"`
+	OS              string `json:"os,omitempty"`
+	OSVersion       string `json:"osVersion,omitempty"`
+	BiosVersion     string `json:"biosVersion,omitempty"`
+	Serial          string `json:"serial,omitempty"`
+	Uptime          int64  `json:"uptime,omitempty"`
+	LastResetReason string `json:"lastResetReason,omitempty"`
+	LastResetTime   string `json:"lastResetTime,omitempty"`
+	Memory          int    `json:"memory,omitempty"`
+	MemoryType      string `json:"memoryType,omitempty"`
+}
+
+// DeviceReport is what we send up for the device itself.
+type DeviceReport struct {
+	Switch    string     `json:"switch"`
+	TimeStamp int64      `json:"timeStamp"`
+	Device    DeviceInfo `json:"device"`
+}
+
+// turn the output of show version into device info.
+func nxapiDeviceInfo(v nxapi.Version) DeviceInfo {
+	return DeviceInfo{
+		Hostname:        v.Host_Name,
+		Vendor:          v.Manufacturer,
+		Model:           v.Chassis_Id,
+		OS:              "NX-OS",
+		OSVersion:       v.OSVersion(),
+		BiosVersion:     v.Bios_Ver_Str,
+		Serial:          v.Proc_Board_Id,
+		Uptime:          int64(v.Uptime().Seconds()),
+		LastResetReason: v.Rr_Reason,
+		LastResetTime:   v.Rr_Ctime,
+		Memory:          v.Memory,
+		MemoryType:      v.Mem_Type,
+	}
+}
+
+// sendUpstream marshals v and sends it on to stickypipe.
+// Todo: Send this up to the main server.  For now it goes to stdout.
+func sendUpstream(v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Println("Error marshalling: ", err)
+		return
+	}
+	fmt.Println(string(b))
+}
+
+// endpointAddresses maps the addresses of the configured endpoints back to
+// the names we were given for them so traps and flows, which only tell us
+// where they came from, can be tied to their switch.
+func endpointAddresses(endpoints []string) map[string]string {
+	devices := map[string]string{}
+	for _, endpoint := range endpoints {
+		name := strings.Split(endpoint, ":")[0]
+		addrs, err := net.LookupHost(name)
+		if err != nil {
+			log.Println(name, err)
+			continue
+		}
+		for _, a := range addrs {
+			devices[a] = name
+		}
+	}
+	return devices
+}
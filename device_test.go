@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"testing"
+)
+
+// watchUpstream sends on lines everything sent upstream until stop is
+// called.
+func watchUpstream(t *testing.T) (lines <-chan string, stop func()) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	c := make(chan string, 100)
+	go func() {
+		defer close(c)
+		s := bufio.NewScanner(r)
+		s.Buffer(nil, 1<<20)
+		for s.Scan() {
+			c <- s.Text()
+		}
+	}()
+	return c, func() {
+		os.Stdout = stdout
+		w.Close()
+	}
+}
+
+// captureUpstream runs f and returns each line it sent upstream.
+func captureUpstream(t *testing.T, f func()) []string {
+	c, stop := watchUpstream(t)
+	done := make(chan []string)
+	go func() {
+		lines := []string{}
+		for l := range c {
+			lines = append(lines, l)
+		}
+		done <- lines
+	}()
+	f()
+	stop()
+	return <-done
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vallard/gosnmp"
+	"github.com/vallard/stickypipe-agent/nxapi"
+)
+
+// Discovery settings, set from the environment in main.
+var discoverySettings struct {
+	Networks    []*net.IPNet
+	Communities []string
+	Credentials []string
+	// addresses probed a second.
+	Rate     int
+	Interval time.Duration
+}
+
+// We won't sweep anything bigger than a /16 in one go, it's almost
+// certainly a typo.
+const maxSweepHosts = 1 << 16
+
+// at most this many probes waiting on an answer at once.
+const maxProbes = 64
+
+const (
+	sysDescr    = ".1.3.6.1.2.1.1.1.0"
+	sysObjectID = ".1.3.6.1.2.1.1.2.0"
+	sysName     = ".1.3.6.1.2.1.1.5.0"
+)
+
+// DiscoveredDevice is sent up when discovery adds a switch to the ones we
+// poll.
+type DiscoveredDevice struct {
+	Address     string `json:"address"`
+	Name        string `json:"name,omitempty"`
+	SysObjectID string `json:"sysObjectId,omitempty"`
+	SysDescr    string `json:"sysDescr,omitempty"`
+	Method      string `json:"method"`
+	// sweep, or lldp or cdp when a neighbor of Via.
+	Source    string `json:"source"`
+	Via       string `json:"via,omitempty"`
+	TimeStamp int64  `json:"timeStamp"`
+}
+
+// probeResult is what we learned about an address that answered.  cred is
+// what to poll it with using method.
+type probeResult struct {
+	address     string
+	name        string
+	sysObjectID string
+	sysDescr    string
+	method      string
+	cred        string
+}
+
+func (p probeResult) endpoint() string {
+	return p.address + ":" + p.method
+}
+
+// parseCIDRs reads a comma separated list of CIDRs.  A plain address is
+// taken as a single host.
+func parseCIDRs(s string) ([]*net.IPNet, error) {
+	var networks []*net.IPNet
+	for _, c := range strings.Split(s, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		if !strings.Contains(c, "/") {
+			ip := net.ParseIP(c)
+			if ip == nil {
+				return nil, fmt.Errorf("%s: not an address or CIDR", c)
+			}
+			bits := 128
+			if ip.To4() != nil {
+				bits = 32
+			}
+			c = fmt.Sprintf("%s/%d", c, bits)
+		}
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			return nil, err
+		}
+		networks = append(networks, n)
+	}
+	return networks, nil
+}
+
+// parseNetworks reads the networks to sweep.
+func parseNetworks(s string) ([]*net.IPNet, error) {
+	networks, err := parseCIDRs(s)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range networks {
+		if n.IP.To4() == nil {
+			return nil, fmt.Errorf("%s: only IPv4 networks can be swept", n)
+		}
+		ones, bits := n.Mask.Size()
+		if 1<<uint(bits-ones) > maxSweepHosts {
+			return nil, fmt.Errorf("%s: too big to sweep, split it up", n)
+		}
+	}
+	return networks, nil
+}
+
+// hosts lists the addresses in a network, leaving out the network and
+// broadcast addresses where there are some.
+func hosts(n *net.IPNet) []string {
+	ones, bits := n.Mask.Size()
+	size := uint32(1) << uint(bits-ones)
+	start := binary.BigEndian.Uint32(n.IP.To4())
+	first, last := uint32(0), size-1
+	if size > 2 {
+		first, last = 1, size-2
+	}
+	addrs := []string{}
+	for i := first; i <= last; i++ {
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, start+i)
+		addrs = append(addrs, ip.String())
+	}
+	return addrs
+}
+
+/*
+	Probe the addresses given at discoverySettings.Rate a second.
+
+Arguments:
+
+	ctx - stops the sweep when cancelled
+	addrs - the addresses to probe
+	found - called with every address that answered
+
+found is called from several goroutines at once.  sweep returns once every
+probe has finished.
+*/
+func sweep(ctx context.Context, addrs []string, found func(probeResult)) {
+	rate := discoverySettings.Rate
+	if rate <= 0 {
+		rate = 1
+	}
+	ticker := time.NewTicker(time.Second / time.Duration(rate))
+	defer ticker.Stop()
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxProbes)
+	for _, a := range addrs {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case <-ticker.C:
+		}
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(address string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if p, ok := probe(address, discoverySettings.Communities, discoverySettings.Credentials); ok {
+				found(p)
+			}
+		}(a)
+	}
+	wg.Wait()
+}
+
+// probe tries SNMP with each community and NX-API with each credential.
+// The fingerprint of what answers SNMP says whether NX-API is worth trying,
+// it gives us more so it wins when both answer.
+func probe(address string, communities []string, credentials []string) (probeResult, bool) {
+	p := probeResult{address: address}
+	snmp := false
+	for _, community := range communities {
+		if v, ok := snmpSystem(address, community); ok {
+			p.name, p.sysObjectID, p.sysDescr = v[sysName], v[sysObjectID], v[sysDescr]
+			p.method, p.cred = "SNMP", community
+			snmp = true
+			break
+		}
+	}
+	if snmp && fingerprint(p.sysObjectID, p.sysDescr).Method != "NXAPI" {
+		return p, true
+	}
+	if len(credentials) > 0 && portOpen(address, "80") {
+		for _, cred := range credentials {
+			if v, err := nxapiVersion(address, cred); err == nil {
+				if v.Host_Name != "" {
+					p.name = v.Host_Name
+				}
+				p.method, p.cred = "NXAPI", cred
+				return p, true
+			}
+		}
+	}
+	return p, snmp
+}
+
+// snmpSystem gets sysName, sysObjectID and sysDescr.
+func snmpSystem(address string, community string) (map[string]string, bool) {
+	s, err := gosnmp.NewGoSNMP(address, community, gosnmp.Version2c, 2)
+	if err != nil {
+		return nil, false
+	}
+	defer s.Close()
+	resp, err := s.GetMulti([]string{sysName, sysObjectID, sysDescr})
+	if err != nil || resp == nil {
+		return nil, false
+	}
+	v := map[string]string{}
+	for _, pdu := range resp.Variables {
+		switch pdu.Type {
+		case gosnmp.OctetString, gosnmp.ObjectIdentifier:
+			v["."+strings.TrimPrefix(pdu.Name, ".")] = pduValue(pdu)
+		}
+	}
+	return v, v[sysObjectID] != "" || v[sysName] != ""
+}
+
+// portOpen is a quick check so we don't wait on HTTP timeouts for
+// addresses with nothing on them.
+func portOpen(address string, port string) bool {
+	c, err := net.DialTimeout("tcp", net.JoinHostPort(address, port), 2*time.Second)
+	if err != nil {
+		return false
+	}
+	c.Close()
+	return true
+}
+
+// nxapiVersion runs show version over NX-API.
+func nxapiVersion(server string, creds string) (nxapi.Version, error) {
+	body, err := json.Marshal(map[string]interface{}{
+		"ins_api": map[string]string{
+			"version":       "1.0",
+			"type":          "cli_show",
+			"chunk":         "0",
+			"sid":           "1",
+			"input":         "show version",
+			"output_format": "json",
+		},
+	})
+	if err != nil {
+		return nxapi.Version{}, err
+	}
+	req, err := newJSONRequest("POST", "http://"+server+"/ins", body, creds)
+	if err != nil {
+		return nxapi.Version{}, err
+	}
+	var rr nxapi.NXAPI_Response
+	if err := doJSON(req, &rr); err != nil {
+		return nxapi.Version{}, err
+	}
+	for _, o := range rr.Ins_api.Outputs {
+		if o.Input == "show version" {
+			return nxapi.NewVersion(o.Body)
+		}
+	}
+	return nxapi.Version{}, fmt.Errorf("%s: no show version in NX-API response", server)
+}
+
+// resolveAuto works out how to poll a host:AUTO endpoint.  Its credential
+// is tried first, as a community or as an NX-API login if it has a colon,
+// then the discovery ones.
+func resolveAuto(host string, cred string) (probeResult, bool) {
+	communities := discoverySettings.Communities
+	credentials := discoverySettings.Credentials
+	if strings.Contains(cred, ":") {
+		credentials = append([]string{cred}, credentials...)
+	} else {
+		communities = append([]string{cred}, communities...)
+	}
+	return probe(host, communities, credentials)
+}
+
+// sweepAddresses lists every address in the discovery networks.
+func sweepAddresses() []string {
+	addrs := []string{}
+	for _, n := range discoverySettings.Networks {
+		addrs = append(addrs, hosts(n)...)
+	}
+	return addrs
+}
+
+/*
+	Sweep the discovery networks and add what answers to devices.
+
+Arguments:
+
+	ctx - stops discovery when cancelled
+	devices - the endpoints the main loop polls
+
+Addresses we already poll are skipped.  Sweeps again every
+discoverySettings.Interval, or just the once if that is 0.
+*/
+func discover(ctx context.Context, devices *endpointList) {
+	for {
+		addrs := []string{}
+		for _, a := range sweepAddresses() {
+			if !devices.has(a) {
+				addrs = append(addrs, a)
+			}
+		}
+		log.Println("discovery: sweeping", len(addrs), "addresses")
+		sweep(ctx, addrs, func(p probeResult) {
+			addDiscovered(devices, p, "sweep", "")
+		})
+		if discoverySettings.Interval <= 0 {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(discoverySettings.Interval):
+		}
+	}
+}
+
+// addDiscovered adds a device we found to the ones we poll and tells
+// stickypipe about it.  via is the switch that saw it as a neighbor.
+func addDiscovered(devices *endpointList, p probeResult, source string, via string) bool {
+	if !devices.add(savedEndpoint{Endpoint: p.endpoint(), Credential: p.cred, Source: source, Name: p.name}) {
+		return false
+	}
+	log.Println("discovery: found", p.address, p.name, "by", source, "polling with", p.method)
+	sendUpstream(DiscoveredDevice{
+		Address:     p.address,
+		Name:        p.name,
+		SysObjectID: p.sysObjectID,
+		SysDescr:    p.sysDescr,
+		Method:      p.method,
+		Source:      source,
+		Via:         via,
+		TimeStamp:   time.Now().Unix(),
+	})
+	return true
+}
+
+// printDiscoveredConfig sweeps once and prints SP_ENDPOINTS and
+// SP_ENDPOINT_CREDENTIALS for what answered.
+func printDiscoveredConfig(ctx context.Context) {
+	var mutex sync.Mutex
+	found := []probeResult{}
+	sweep(ctx, sweepAddresses(), func(p probeResult) {
+		mutex.Lock()
+		found = append(found, p)
+		mutex.Unlock()
+	})
+	// print them in address order.
+	sortByAddress(found)
+	endpoints := []string{}
+	creds := []string{}
+	for _, p := range found {
+		fmt.Printf("# %s %s %s\n", p.address, p.name, p.sysObjectID)
+		endpoints = append(endpoints, p.endpoint())
+		creds = append(creds, p.cred)
+	}
+	fmt.Printf("SP_ENDPOINTS=%s\n", strconv.Quote(strings.Join(endpoints, ",")))
+	fmt.Printf("SP_ENDPOINT_CREDENTIALS=%s\n", strconv.Quote(strings.Join(creds, ",")))
+}
+
+func sortByAddress(ps []probeResult) {
+	key := func(p probeResult) uint32 {
+		ip := net.ParseIP(p.address).To4()
+		if ip == nil {
+			return 0
+		}
+		return binary.BigEndian.Uint32(ip)
+	}
+	for i := 1; i < len(ps); i++ {
+		for j := i; j > 0 && key(ps[j]) < key(ps[j-1]); j-- {
+			ps[j], ps[j-1] = ps[j-1], ps[j]
+		}
+	}
+}
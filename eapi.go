@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/vallard/stickypipe-agent/eapi"
+)
+
+// The commands we run on EAPI (Arista) switches.  The order matters, the
+// results come back in the same order.
+var eapiWork = []string{
+	"show hostname",
+	"show version",
+	"show interfaces counters",
+	"show interfaces counters errors",
+}
+
+/* Get Arista eAPI information
+Arguments:
+ server - Arista Switch (10.93.234.9, leaf01, or something reachable)
+ creds - user/password pair that looks like admin:arista
+
+All the commands go in one runCmds call.
+*/
+func collectEAPI(server string, creds string) {
+	body, err := json.Marshal(eapi.NewRequest(eapiWork...))
+	if err != nil {
+		log.Println(server, err)
+		return
+	}
+	req, err := newJSONRequest("POST", "https://"+server+"/command-api", body, creds)
+	if err != nil {
+		log.Println(server, err)
+		return
+	}
+	var r eapi.Response
+	if err := doJSON(req, &r); err != nil {
+		log.Println(server, err)
+		return
+	}
+	if r.Error != nil {
+		log.Println(server, r.Error)
+		return
+	}
+	processCollectedEAPIData(server, r)
+}
+
+// process eAPI results into a device report and interface samples.
+func processCollectedEAPIData(sw string, r eapi.Response) {
+	now := time.Now()
+	swi := sw
+
+	var host eapi.Hostname
+	if err := r.Decode(0, &host); err != nil {
+		log.Println(sw, "show hostname: ", err)
+	}
+	var ver eapi.Version
+	if err := r.Decode(1, &ver); err != nil {
+		log.Println(sw, "show version: ", err)
+	}
+	if host.Hostname != "" {
+		swi = host.Hostname
+		info := DeviceInfo{
+			Hostname:  host.Hostname,
+			Vendor:    "Arista Networks",
+			Model:     ver.ModelName,
+			OS:        "EOS",
+			OSVersion: ver.Version,
+			Serial:    ver.SerialNumber,
+			Memory:    ver.MemTotal,
+		}
+		if ver.BootupTimestamp > 0 {
+			info.Uptime = now.Unix() - int64(ver.BootupTimestamp)
+		}
+		sendUpstream(DeviceReport{Switch: swi, TimeStamp: now.Unix(), Device: info})
+	}
+
+	samples := newSampleSet(swi, now.Unix())
+	var counters eapi.InterfacesCounters
+	if err := r.Decode(2, &counters); err != nil {
+		log.Println(sw, "show interfaces counters: ", err)
+	}
+	names := []string{}
+	for name := range counters.Interfaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c := counters.Interfaces[name]
+		s := samples.get(name)
+		s.IfHCInOctets = c.InOctets
+		s.InUcastPkts = c.InUcastPkts
+		s.InMulticastPkts = c.InMulticastPkts
+		s.InBroadcastPkts = c.InBroadcastPkts
+		s.InPkts = c.InUcastPkts + c.InMulticastPkts + c.InBroadcastPkts
+		s.InDiscards = c.InDiscards
+		s.IfHCOutOctets = c.OutOctets
+		s.OutUcastPkts = c.OutUcastPkts
+		s.OutMulticastPkts = c.OutMulticastPkts
+		s.OutBroadcastPkts = c.OutBroadcastPkts
+		s.OutPkts = c.OutUcastPkts + c.OutMulticastPkts + c.OutBroadcastPkts
+		s.OutDiscards = c.OutDiscards
+	}
+
+	var errs eapi.InterfacesCountersErrors
+	if err := r.Decode(3, &errs); err != nil {
+		log.Println(sw, "show interfaces counters errors: ", err)
+	}
+	for _, name := range names {
+		e, ok := errs.InterfaceErrorCounters[name]
+		if !ok {
+			continue
+		}
+		s := samples.get(name)
+		s.InErrors = e.InErrors
+		s.OutErrors = e.OutErrors
+		s.InCRC = e.FcsErrors
+		s.InRunts = e.FrameTooShorts
+		s.InGiants = e.FrameTooLongs
+	}
+	sendUpstream(map[string][]InterfaceSample{swi: samples.list()})
+}
@@ -0,0 +1,119 @@
+package eapi
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+/* Arista's eAPI is JSON-RPC 2.0 posted to /command-api.  We send a list of
+commands in one runCmds call and get back one result per command, in the same
+order.  Unlike NX-API the results are properly typed JSON, so they unmarshal
+straight into the structs below.
+*/
+
+type Request struct {
+	Jsonrpc string `json:"jsonrpc"`
+	Method  string `json:"method"`
+	Params  Params `json:"params"`
+	Id      string `json:"id"`
+}
+
+type Params struct {
+	Version int      `json:"version"`
+	Cmds    []string `json:"cmds"`
+	Format  string   `json:"format"`
+}
+
+// NewRequest is a runCmds call for cmds asking for JSON back.
+func NewRequest(cmds ...string) Request {
+	return Request{
+		Jsonrpc: "2.0",
+		Method:  "runCmds",
+		Params: Params{
+			Version: 1,
+			Cmds:    cmds,
+			Format:  "json",
+		},
+		Id: "stickypipe",
+	}
+}
+
+type Response struct {
+	Jsonrpc string            `json:"jsonrpc"`
+	Id      string            `json:"id"`
+	Result  []json.RawMessage `json:"result"`
+	Error   *Error            `json:"error"`
+}
+
+// Error is what we get back when any of the commands fail.  Data has the
+// results of the commands that ran before the failure.
+type Error struct {
+	Code    int               `json:"code"`
+	Message string            `json:"message"`
+	Data    []json.RawMessage `json:"data"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("eapi error %d: %s", e.Code, e.Message)
+}
+
+// Decode unmarshals the result of the i'th command into v.
+func (r Response) Decode(i int, v interface{}) error {
+	if i >= len(r.Result) {
+		return fmt.Errorf("eapi: no result for command %d", i)
+	}
+	return json.Unmarshal(r.Result[i], v)
+}
+
+// show hostname
+type Hostname struct {
+	Hostname string `json:"hostname"`
+	Fqdn     string `json:"fqdn"`
+}
+
+// show version
+type Version struct {
+	ModelName        string  `json:"modelName"`
+	Version          string  `json:"version"`
+	InternalVersion  string  `json:"internalVersion"`
+	SerialNumber     string  `json:"serialNumber"`
+	SystemMacAddress string  `json:"systemMacAddress"`
+	HardwareRevision string  `json:"hardwareRevision"`
+	Architecture     string  `json:"architecture"`
+	MemTotal         int     `json:"memTotal"`
+	MemFree          int     `json:"memFree"`
+	BootupTimestamp  float64 `json:"bootupTimestamp"`
+}
+
+// show interfaces counters
+type InterfacesCounters struct {
+	Interfaces map[string]InterfaceCounters `json:"interfaces"`
+}
+
+type InterfaceCounters struct {
+	InOctets         uint64 `json:"inOctets"`
+	InUcastPkts      uint64 `json:"inUcastPkts"`
+	InMulticastPkts  uint64 `json:"inMulticastPkts"`
+	InBroadcastPkts  uint64 `json:"inBroadcastPkts"`
+	InDiscards       uint64 `json:"inDiscards"`
+	OutOctets        uint64 `json:"outOctets"`
+	OutUcastPkts     uint64 `json:"outUcastPkts"`
+	OutMulticastPkts uint64 `json:"outMulticastPkts"`
+	OutBroadcastPkts uint64 `json:"outBroadcastPkts"`
+	OutDiscards      uint64 `json:"outDiscards"`
+}
+
+// show interfaces counters errors
+type InterfacesCountersErrors struct {
+	InterfaceErrorCounters map[string]InterfaceErrorCounters `json:"interfaceErrorCounters"`
+}
+
+type InterfaceErrorCounters struct {
+	FcsErrors       uint64 `json:"fcsErrors"`
+	AlignmentErrors uint64 `json:"alignmentErrors"`
+	SymbolErrors    uint64 `json:"symbolErrors"`
+	InErrors        uint64 `json:"inErrors"`
+	FrameTooShorts  uint64 `json:"frameTooShorts"`
+	FrameTooLongs   uint64 `json:"frameTooLongs"`
+	OutErrors       uint64 `json:"outErrors"`
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// endpointList is the switches we poll, as host:method, and the credential
+// for each.  It starts out as SP_ENDPOINTS and discovery adds to it while
+// we run, so the main loop takes a copy each time around.
+type endpointList struct {
+	sync.Mutex
+	endpoints []string
+	creds     []string
+	// what discovery found, written to file so we keep polling it after a
+	// restart.
+	file  string
+	found []savedEndpoint
+	// the addresses of endpoints we were given by name, so discovery
+	// doesn't add them again by address.  Looked up the first time we're
+	// asked.
+	lookup    sync.Once
+	addresses map[string]string
+}
+
+// savedEndpoint is a discovered switch in the device file.
+type savedEndpoint struct {
+	Endpoint   string `json:"endpoint"`
+	Credential string `json:"credential"`
+	Source     string `json:"source,omitempty"`
+	Name       string `json:"name,omitempty"`
+}
+
+func newEndpointList(endpoints []string, creds []string) *endpointList {
+	return &endpointList{endpoints: endpoints, creds: creds}
+}
+
+// load adds the switches in the device file, if there is one yet, and
+// remembers the file so add can save to it.
+func (l *endpointList) load(file string) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		var saved []savedEndpoint
+		if err := json.Unmarshal(b, &saved); err != nil {
+			return err
+		}
+		for _, s := range saved {
+			l.add(s)
+		}
+	}
+	l.Lock()
+	l.file = file
+	l.Unlock()
+	return nil
+}
+
+// add adds a discovered endpoint unless we already poll its host, in which
+// case it returns false.
+func (l *endpointList) add(s savedEndpoint) bool {
+	l.lookupAddresses()
+	l.Lock()
+	defer l.Unlock()
+	if l.hasLocked(strings.Split(s.Endpoint, ":")[0]) {
+		return false
+	}
+	l.endpoints = append(l.endpoints, s.Endpoint)
+	l.creds = append(l.creds, s.Credential)
+	l.found = append(l.found, s)
+	if l.file != "" {
+		if err := l.save(); err != nil {
+			log.Println(l.file, err)
+		}
+	}
+	return true
+}
+
+// save writes the discovered switches to the device file.
+func (l *endpointList) save() error {
+	b, err := json.MarshalIndent(l.found, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(l.file, b)
+}
+
+// writeFileAtomic writes b to a temporary file and renames it over file so
+// a crash doesn't leave half of it.  Only we can read it, the device file
+// holds credentials.
+func writeFileAtomic(file string, b []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(file), "."+filepath.Base(file))
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// resolve replaces endpoint, a host:AUTO one, with how we found we can
+// poll it.
+func (l *endpointList) resolve(endpoint string, s savedEndpoint) {
+	l.Lock()
+	defer l.Unlock()
+	for i, e := range l.endpoints {
+		if e == endpoint {
+			l.endpoints[i] = s.Endpoint
+			l.creds[i] = s.Credential
+		}
+	}
+}
+
+// has says if we poll host already, by that name or, for an address, by
+// a name that resolves to it.
+func (l *endpointList) has(host string) bool {
+	l.lookupAddresses()
+	l.Lock()
+	defer l.Unlock()
+	return l.hasLocked(host)
+}
+
+func (l *endpointList) hasLocked(host string) bool {
+	if _, ok := l.addresses[host]; ok {
+		return true
+	}
+	for _, e := range l.endpoints {
+		if strings.Split(e, ":")[0] == host {
+			return true
+		}
+	}
+	return false
+}
+
+// lookupAddresses resolves the endpoints we were given by name, once.  The
+// lookups are done without the lock so the main loop isn't held up by DNS.
+// Anything discovery adds is an address already.
+func (l *endpointList) lookupAddresses() {
+	l.lookup.Do(func() {
+		named := []string{}
+		l.Lock()
+		for _, e := range l.endpoints {
+			if net.ParseIP(strings.Split(e, ":")[0]) == nil {
+				named = append(named, e)
+			}
+		}
+		l.Unlock()
+		addresses := endpointAddresses(named)
+		l.Lock()
+		l.addresses = addresses
+		l.Unlock()
+	})
+}
+
+// list returns a copy of the endpoints and their credentials.
+func (l *endpointList) list() ([]string, []string) {
+	l.Lock()
+	defer l.Unlock()
+	return append([]string{}, l.endpoints...), append([]string{}, l.creds...)
+}
+
+// splitList splits a comma separated setting, an empty one being no items
+// rather than one empty one.
+func splitList(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
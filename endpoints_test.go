@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestEndpointListHas(t *testing.T) {
+	l := newEndpointList([]string{"localhost:SNMP", "10.0.0.1:NXAPI"}, []string{"public", "admin:cisco"})
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"localhost", true},
+		{"10.0.0.1", true},
+		// localhost by its address, the way a neighbor would give it.
+		{"127.0.0.1", true},
+		{"10.0.0.2", false},
+	}
+	for _, tt := range tests {
+		if got := l.has(tt.host); got != tt.want {
+			t.Errorf("%s: has %v, want %v", tt.host, got, tt.want)
+		}
+	}
+
+	// a seed found again by address isn't polled twice.
+	if l.add(savedEndpoint{Endpoint: "127.0.0.1:NXAPI", Credential: "admin:cisco"}) {
+		t.Error("added the address of a seed given by name")
+	}
+	if !l.add(savedEndpoint{Endpoint: "10.0.0.2:SNMP", Credential: "public"}) || !l.has("10.0.0.2") {
+		t.Error("didn't add a new switch")
+	}
+	if endpoints, _ := l.list(); len(endpoints) != 3 {
+		t.Errorf("endpoints %v", endpoints)
+	}
+}
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Fingerprint says what a device is from its sysObjectID and sysDescr, and
+// so how to collect from it.  SysObjectID is a prefix, the longest one
+// that matches wins.  SysDescr, if set, is a regular expression sysDescr
+// must match too, which tells apart the operating systems one vendor ships
+// under the same enterprise number.  Model, if set, is a regular expression
+// whose first group picks the model out of sysDescr.
+type Fingerprint struct {
+	SysObjectID string `json:"sysObjectId"`
+	SysDescr    string `json:"sysDescr,omitempty"`
+	Vendor      string `json:"vendor"`
+	Model       string `json:"model,omitempty"`
+	OS          string `json:"os,omitempty"`
+	// one of metricProfiles.
+	Profile string `json:"profile"`
+	// the method discovery polls it with when it answers that.
+	Method string `json:"method"`
+}
+
+// The fingerprints we know.  SP_FINGERPRINT_FILE adds to them.
+var fingerprints = []Fingerprint{
+	{SysObjectID: ".1.3.6.1.4.1.9.12.3.1.3", Vendor: "Cisco", Model: `NX-OS\(tm\) (\w+)`, OS: "NX-OS", Profile: "cisco-nxos", Method: "NXAPI"},
+	{SysObjectID: ".1.3.6.1.4.1.9", SysDescr: `NX-OS`, Vendor: "Cisco", Model: `NX-OS\(tm\) (\w+)`, OS: "NX-OS", Profile: "cisco-nxos", Method: "NXAPI"},
+	{SysObjectID: ".1.3.6.1.4.1.9", SysDescr: `IOS XR`, Vendor: "Cisco", OS: "IOS XR", Profile: "cisco-ios", Method: "SNMP"},
+	{SysObjectID: ".1.3.6.1.4.1.9", SysDescr: `IOS-XE|IOS XE`, Vendor: "Cisco", Model: `Software \((\w+?)[-_]`, OS: "IOS XE", Profile: "cisco-ios", Method: "SNMP"},
+	{SysObjectID: ".1.3.6.1.4.1.9", SysDescr: `IOS`, Vendor: "Cisco", Model: `Software \((\w+?)[-_]`, OS: "IOS", Profile: "cisco-ios", Method: "SNMP"},
+	{SysObjectID: ".1.3.6.1.4.1.9", Vendor: "Cisco", Profile: "cisco-ios", Method: "SNMP"},
+	{SysObjectID: ".1.3.6.1.4.1.30065", Vendor: "Arista", Model: `running on an Arista Networks (\S+)`, OS: "EOS", Profile: "standard", Method: "SNMP"},
+	{SysObjectID: ".1.3.6.1.4.1.2636", Vendor: "Juniper", Model: `Juniper Networks, Inc\. (\S+)`, OS: "Junos", Profile: "standard", Method: "SNMP"},
+	{SysObjectID: ".1.3.6.1.4.1.11", Vendor: "HPE", Profile: "standard", Method: "SNMP"},
+	{SysObjectID: ".1.3.6.1.4.1.14823", Vendor: "Aruba", Profile: "standard", Method: "SNMP"},
+	{SysObjectID: ".1.3.6.1.4.1.674", Vendor: "Dell", Profile: "standard", Method: "SNMP"},
+	{SysObjectID: ".1.3.6.1.4.1.1916", Vendor: "Extreme", Profile: "standard", Method: "SNMP"},
+	{SysObjectID: ".1.3.6.1.4.1.1991", Vendor: "Brocade", Profile: "standard", Method: "SNMP"},
+	{SysObjectID: ".1.3.6.1.4.1.33049", Vendor: "Mellanox", Profile: "standard", Method: "SNMP"},
+	{SysObjectID: ".1.3.6.1.4.1.40310", Vendor: "Cumulus", OS: "Cumulus Linux", Profile: "standard", Method: "SNMP"},
+	{SysObjectID: ".1.3.6.1.4.1.8072.3.2.10", Vendor: "Net-SNMP", OS: "Linux", Profile: "host", Method: "SNMP"},
+}
+
+// unknownFingerprint is what we use for devices nothing matches.  Its
+// profile collects everything, which is what every device used to get.
+var unknownFingerprint = Fingerprint{Profile: "all", Method: "SNMP"}
+
+// metricProfile is what we collect over SNMP from a kind of device, beyond
+// the interface counters everything gets.
+type metricProfile struct {
+	// the healthProfiles MIBs worth walking, all of them if nil.
+	health     []string
+	collectors []func(server string, creds string, sw string)
+	// collectors too slow for every poll, run every SP_INVENTORY_INTERVAL.
+	inventory []func(server string, creds string, sw string)
+}
+
+var metricProfiles = map[string]metricProfile{
+	"all": {
+		collectors: []func(string, string, string){
+			collectSNMPTransceivers, collectSNMPRouting, collectSNMPVLANs, collectSNMPQueues, collectSNMPNeighbors,
+		},
+		inventory: []func(string, string, string){collectSNMPPortMACs},
+	},
+	"cisco-nxos": {
+		health: []string{"CISCO-PROCESS-MIB", "CISCO-MEMORY-POOL-MIB", "ENTITY-SENSOR-MIB", "CISCO-ENVMON-MIB"},
+		collectors: []func(string, string, string){
+			collectSNMPTransceivers, collectSNMPRouting, collectSNMPVLANs, collectSNMPQueues, collectSNMPNeighbors,
+		},
+		inventory: []func(string, string, string){collectSNMPPortMACs},
+	},
+	// IOS only answers Q-BRIDGE-MIB per VLAN, see collectSNMPVLANs.
+	"cisco-ios": {
+		health: []string{"CISCO-PROCESS-MIB", "CISCO-MEMORY-POOL-MIB", "ENTITY-SENSOR-MIB", "CISCO-ENVMON-MIB"},
+		collectors: []func(string, string, string){
+			collectSNMPTransceivers, collectSNMPRouting, collectSNMPQueues, collectSNMPNeighbors,
+		},
+	},
+	// the standard MIBs, for everyone else's switches.
+	"standard": {
+		health: []string{"HOST-RESOURCES-MIB", "ENTITY-SENSOR-MIB"},
+		collectors: []func(string, string, string){
+			collectSNMPRouting, collectSNMPVLANs, collectSNMPNeighbors,
+		},
+		inventory: []func(string, string, string){collectSNMPPortMACs},
+	},
+	"host": {
+		health: []string{"HOST-RESOURCES-MIB"},
+		collectors: []func(string, string, string){
+			collectSNMPNeighbors,
+		},
+	},
+}
+
+// loadFingerprints adds the fingerprints in file ahead of the built in
+// ones, so they win when the prefixes are as long.
+func loadFingerprints(file string) error {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var fs []Fingerprint
+	if err := json.Unmarshal(b, &fs); err != nil {
+		return err
+	}
+	for _, f := range fs {
+		if _, ok := metricProfiles[f.Profile]; !ok {
+			log.Println(file, f.SysObjectID, "unknown profile", f.Profile)
+		}
+		for _, re := range []string{f.SysDescr, f.Model} {
+			if _, err := regexp.Compile(re); err != nil {
+				return err
+			}
+		}
+	}
+	fingerprints = append(fs, fingerprints...)
+	return nil
+}
+
+// fingerprint finds the fingerprint for a device.
+func fingerprint(objectID string, descr string) Fingerprint {
+	objectID = "." + strings.TrimPrefix(objectID, ".")
+	best := -1
+	for i, f := range fingerprints {
+		if objectID != f.SysObjectID && !strings.HasPrefix(objectID, f.SysObjectID+".") {
+			continue
+		}
+		if f.SysDescr != "" && !regexp.MustCompile(f.SysDescr).MatchString(descr) {
+			continue
+		}
+		if best < 0 || len(f.SysObjectID) > len(fingerprints[best].SysObjectID) {
+			best = i
+		}
+	}
+	if best < 0 {
+		return unknownFingerprint
+	}
+	return fingerprints[best]
+}
+
+// profile is the metric profile of the fingerprint, collecting everything
+// if it names one we don't have.
+func (f Fingerprint) profile() metricProfile {
+	if p, ok := metricProfiles[f.Profile]; ok {
+		return p
+	}
+	return metricProfiles["all"]
+}
+
+func contains(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+var osVersionPattern = regexp.MustCompile(`[Vv]ersion:? ([0-9][^ ,;]*)`)
+
+// deviceInfo is what the fingerprint and the system group tell us about a
+// device.
+func (f Fingerprint) deviceInfo(name string, descr string) DeviceInfo {
+	info := DeviceInfo{Hostname: name, Vendor: f.Vendor, OS: f.OS}
+	if f.Model != "" {
+		if m := regexp.MustCompile(f.Model).FindStringSubmatch(descr); len(m) > 1 {
+			info.Model = m[1]
+		}
+	}
+	if m := osVersionPattern.FindStringSubmatch(descr); len(m) > 1 {
+		info.OSVersion = m[1]
+	}
+	return info
+}
+
+// What we identified each SNMP device as, by address, so it's only done on
+// first contact.
+var identified = struct {
+	sync.Mutex
+	m map[string]Fingerprint
+}{m: map[string]Fingerprint{}}
+
+/*
+	Find out what an SNMP device is and send up its device info the first
+	time we poll it.
+
+Arguments:
+
+	server - the switch
+	creds - the SNMP community string
+
+Devices that don't answer the system group get unknownFingerprint, and
+are asked again next time.
+*/
+func identifySNMP(server string, creds string) Fingerprint {
+	identified.Lock()
+	f, ok := identified.m[server]
+	identified.Unlock()
+	if ok {
+		return f
+	}
+	v, ok := snmpSystem(server, creds)
+	if !ok {
+		return unknownFingerprint
+	}
+	f = fingerprint(v[sysObjectID], v[sysDescr])
+	identified.Lock()
+	identified.m[server] = f
+	identified.Unlock()
+	log.Println(server, "is", f.Vendor, f.OS, "using profile", f.Profile)
+	sendUpstream(DeviceReport{
+		Switch:    v[sysName],
+		TimeStamp: time.Now().Unix(),
+		Device:    f.deviceInfo(v[sysName], v[sysDescr]),
+	})
+	return f
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Flow settings, set from the environment in main.
+var flowSettings struct {
+	Interval time.Duration
+	TopN     int
+}
+
+// We stop tracking new conversations on an interface past this many in one
+// interval so a scan can't eat all our memory.  They still count towards
+// the interface totals.
+const maxConversations = 100000
+
+// Conversation is the traffic between two endpoints on one protocol and
+// pair of ports.  Bytes and packets are scaled up by the sampling rate so
+// they are estimates of the real traffic.
+type Conversation struct {
+	SrcAddr  string `json:"srcAddr"`
+	DstAddr  string `json:"dstAddr"`
+	Protocol uint8  `json:"protocol"`
+	SrcPort  uint16 `json:"srcPort,omitempty"`
+	DstPort  uint16 `json:"dstPort,omitempty"`
+	Bytes    uint64 `json:"bytes"`
+	Packets  uint64 `json:"packets"`
+}
+
+// ProtocolCount is how much of the traffic was one IP protocol.
+type ProtocolCount struct {
+	Protocol uint8  `json:"protocol"`
+	Name     string `json:"name,omitempty"`
+	Bytes    uint64 `json:"bytes"`
+	Packets  uint64 `json:"packets"`
+}
+
+// Names for the protocols people usually ask about.
+var protocolNames = map[uint8]string{
+	1:   "icmp",
+	2:   "igmp",
+	6:   "tcp",
+	17:  "udp",
+	47:  "gre",
+	50:  "esp",
+	51:  "ah",
+	58:  "ipv6-icmp",
+	89:  "ospf",
+	103: "pim",
+	112: "vrrp",
+	132: "sctp",
+}
+
+// FlowSummary is who was talking on one interface, in one direction, over
+// one interval.
+type FlowSummary struct {
+	Switch     string          `json:"switch"`
+	IfName     string          `json:"ifName"`
+	IfId       string          `json:"ifId"`
+	Direction  string          `json:"direction"`
+	Source     string          `json:"source"`
+	TimeStamp  int64           `json:"timeStamp"`
+	Interval   int64           `json:"interval"`
+	Bytes      uint64          `json:"bytes"`
+	Packets    uint64          `json:"packets"`
+	TopTalkers []Conversation  `json:"topTalkers"`
+	Protocols  []ProtocolCount `json:"protocols"`
+}
+
+type flowKey struct {
+	endpoint  string
+	ifIndex   uint32
+	direction string
+	source    string
+}
+
+type flowInterface struct {
+	bytes         uint64
+	packets       uint64
+	conversations map[Conversation]*Conversation
+	protocols     map[uint8]*ProtocolCount
+}
+
+// flowTable adds up the flows the receivers hand it until the next flush.
+type flowTable struct {
+	mutex      sync.Mutex
+	start      time.Time
+	interfaces map[flowKey]*flowInterface
+}
+
+func newFlowTable() *flowTable {
+	return &flowTable{start: time.Now(), interfaces: map[flowKey]*flowInterface{}}
+}
+
+// add counts a flow against an interface.  direction is in or out, source
+// is the protocol that told us about it.
+func (t *flowTable) add(endpoint string, ifIndex uint32, direction string, source string, c Conversation) {
+	if ifIndex == 0 {
+		return
+	}
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	k := flowKey{endpoint, ifIndex, direction, source}
+	i := t.interfaces[k]
+	if i == nil {
+		i = &flowInterface{conversations: map[Conversation]*Conversation{}, protocols: map[uint8]*ProtocolCount{}}
+		t.interfaces[k] = i
+	}
+	i.bytes += c.Bytes
+	i.packets += c.Packets
+	p := i.protocols[c.Protocol]
+	if p == nil {
+		p = &ProtocolCount{Protocol: c.Protocol, Name: protocolNames[c.Protocol]}
+		i.protocols[c.Protocol] = p
+	}
+	p.Bytes += c.Bytes
+	p.Packets += c.Packets
+	id := c
+	id.Bytes, id.Packets = 0, 0
+	if sum, ok := i.conversations[id]; ok {
+		sum.Bytes += c.Bytes
+		sum.Packets += c.Packets
+	} else if len(i.conversations) < maxConversations {
+		i.conversations[id] = &c
+	}
+}
+
+// flush returns the summaries since the last flush by switch and starts
+// counting again.
+func (t *flowTable) flush(now time.Time) map[string][]FlowSummary {
+	t.mutex.Lock()
+	interfaces := t.interfaces
+	start := t.start
+	t.interfaces = map[flowKey]*flowInterface{}
+	t.start = now
+	t.mutex.Unlock()
+
+	out := map[string][]FlowSummary{}
+	for k, i := range interfaces {
+		ifId := strconv.FormatUint(uint64(k.ifIndex), 10)
+		sw, name := lookupInterface(k.endpoint, ifId)
+		talkers := []Conversation{}
+		for _, c := range i.conversations {
+			talkers = append(talkers, *c)
+		}
+		sort.Slice(talkers, func(a, b int) bool { return talkers[a].Bytes > talkers[b].Bytes })
+		if len(talkers) > flowSettings.TopN {
+			talkers = talkers[:flowSettings.TopN]
+		}
+		protocols := []ProtocolCount{}
+		for _, p := range i.protocols {
+			protocols = append(protocols, *p)
+		}
+		sort.Slice(protocols, func(a, b int) bool { return protocols[a].Bytes > protocols[b].Bytes })
+		out[sw] = append(out[sw], FlowSummary{
+			Switch:     sw,
+			IfName:     name,
+			IfId:       ifId,
+			Direction:  k.direction,
+			Source:     k.source,
+			TimeStamp:  now.Unix(),
+			Interval:   int64(now.Sub(start).Seconds()),
+			Bytes:      i.bytes,
+			Packets:    i.packets,
+			TopTalkers: talkers,
+			Protocols:  protocols,
+		})
+	}
+	for _, summaries := range out {
+		sort.Slice(summaries, func(a, b int) bool { return summaries[a].Bytes > summaries[b].Bytes })
+	}
+	return out
+}
+
+// sendFlows sends the summaries up every interval until ctx is cancelled.
+func sendFlows(ctx context.Context, t *flowTable) {
+	ticker := time.NewTicker(flowSettings.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			for sw, summaries := range t.flush(now) {
+				sendUpstream(map[string][]FlowSummary{sw: summaries})
+			}
+		}
+	}
+}
@@ -0,0 +1,341 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	"github.com/vallard/stickypipe-agent/yang"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// gNMI settings, set from the environment in main.
+var gnmiSettings struct {
+	Port           int
+	Plaintext      bool
+	SampleInterval time.Duration
+}
+
+// More options for dialing switches, the tests dial an in-memory server.
+var gnmiDialOptions []grpc.DialOption
+
+// What we subscribe to.  The counters are sampled every SampleInterval, the
+// status leaves are sent by the switch as soon as they change so we see a
+// link go down without waiting for the next sample.
+var gnmiSubscriptions = []struct {
+	Path string
+	Mode gpb.SubscriptionMode
+}{
+	{"interfaces/interface/state/counters", gpb.SubscriptionMode_SAMPLE},
+	{"interfaces/interface/state/oper-status", gpb.SubscriptionMode_ON_CHANGE},
+	{"interfaces/interface/state/admin-status", gpb.SubscriptionMode_ON_CHANGE},
+}
+
+// How long we wait before reconnecting a stream.  It doubles every time we
+// fail to get anything and goes back to the minimum once we do.
+const (
+	gnmiMinBackoff = time.Second
+	gnmiMaxBackoff = time.Minute
+)
+
+// gnmiPath turns interfaces/interface/state/counters into a path that matches
+// every interface.
+func gnmiPath(p string) *gpb.Path {
+	path := &gpb.Path{}
+	for _, name := range strings.Split(p, "/") {
+		e := &gpb.PathElem{Name: name}
+		if name == "interface" {
+			e.Key = map[string]string{"name": "*"}
+		}
+		path.Elem = append(path.Elem, e)
+	}
+	return path
+}
+
+func gnmiSubscribeRequest() *gpb.SubscribeRequest {
+	list := &gpb.SubscriptionList{Mode: gpb.SubscriptionList_STREAM}
+	for _, s := range gnmiSubscriptions {
+		sub := &gpb.Subscription{Path: gnmiPath(s.Path), Mode: s.Mode}
+		if s.Mode == gpb.SubscriptionMode_SAMPLE {
+			sub.SampleInterval = uint64(gnmiSettings.SampleInterval.Nanoseconds())
+		}
+		list.Subscription = append(list.Subscription, sub)
+	}
+	return &gpb.SubscribeRequest{Request: &gpb.SubscribeRequest_Subscribe{Subscribe: list}}
+}
+
+/* Stream interface counters with gNMI
+Arguments:
+ server - switch or router (10.93.234.7, spine01, or something reachable)
+ creds - user/password pair that looks like admin:cisco, sent as gRPC metadata
+ ctx - cancelled when the agent shuts down
+
+Unlike the other methods this isn't run every minute.  It keeps a Subscribe
+stream open for as long as the agent runs and sends samples as the switch
+streams them, reconnecting with backoff when the stream drops.
+*/
+func collectGNMI(ctx context.Context, server string, creds string) {
+	backoff := gnmiMinBackoff
+	for {
+		received, err := gnmiConnect(ctx, server, creds)
+		if ctx.Err() != nil {
+			return
+		}
+		if received {
+			backoff = gnmiMinBackoff
+		}
+		log.Println(server, "gNMI stream closed:", err, "reconnecting in", backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if !received {
+			backoff *= 2
+			if backoff > gnmiMaxBackoff {
+				backoff = gnmiMaxBackoff
+			}
+		}
+	}
+}
+
+// gnmiConnect dials the switch and streams until something goes wrong.  It
+// returns true if we got at least one notification.
+func gnmiConnect(ctx context.Context, server string, creds string) (bool, error) {
+	user, pass, err := splitCredentials(creds)
+	if err != nil {
+		return false, err
+	}
+	transport := credentials.NewTLS(tlsConfig)
+	if gnmiSettings.Plaintext {
+		transport = insecure.NewCredentials()
+	}
+	addr := net.JoinHostPort(server, strconv.Itoa(gnmiSettings.Port))
+	opts := append([]grpc.DialOption{grpc.WithTransportCredentials(transport)}, gnmiDialOptions...)
+	conn, err := grpc.NewClient(addr, opts...)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+	ctx = metadata.AppendToOutgoingContext(ctx, "username", user, "password", pass)
+	return gnmiSubscribe(ctx, gpb.NewGNMIClient(conn), server)
+}
+
+// gnmiSubscribe runs one Subscribe stream on client and sends samples for
+// the interfaces in every notification until the stream ends.
+func gnmiSubscribe(ctx context.Context, client gpb.GNMIClient, server string) (bool, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stream, err := client.Subscribe(ctx)
+	if err != nil {
+		return false, err
+	}
+	if err := stream.Send(gnmiSubscribeRequest()); err != nil {
+		return false, err
+	}
+	// notifications only carry what changed, so we keep the last value of
+	// everything to send whole samples.
+	cache := newSampleSet(server, 0)
+	received := false
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			return received, err
+		}
+		n := resp.GetUpdate()
+		if n == nil {
+			// sync_response just means the initial dump is done.
+			continue
+		}
+		received = true
+		if samples := applyGNMINotification(cache, n); len(samples) > 0 {
+			sendUpstream(map[string][]InterfaceSample{server: samples})
+		}
+	}
+}
+
+// applyGNMINotification updates the cached samples with the deletes and
+// updates in n and returns the samples for the interfaces that were in it.
+// Deletes come first, as the spec says.  A deleted interface is dropped
+// from the cache, a deleted leaf goes back to nothing.
+func applyGNMINotification(cache *sampleSet, n *gpb.Notification) []InterfaceSample {
+	now := n.Timestamp / int64(time.Second)
+	if now == 0 {
+		now = time.Now().Unix()
+	}
+	touched := newSampleSet(cache.sw, now)
+	for _, p := range n.Delete {
+		name, leaf := gnmiInterfaceLeaf(n.Prefix, p)
+		switch {
+		case name == "":
+			continue
+		case leaf == "":
+			cache.remove(name)
+		case cache.samples[name] != nil:
+			s := cache.samples[name]
+			s.TimeStamp = now
+			clearGNMILeaf(s, leaf)
+			touched.get(name)
+		}
+	}
+	for _, u := range n.Update {
+		name, leaf := gnmiInterfaceLeaf(n.Prefix, u.Path)
+		if name == "" {
+			continue
+		}
+		v, err := gnmiValue(u.Val)
+		if err != nil {
+			log.Println(cache.sw, name, leaf, err)
+			continue
+		}
+		s := cache.get(name)
+		s.TimeStamp = now
+		setGNMILeaf(s, leaf, v)
+		touched.get(name)
+	}
+	samples := []InterfaceSample{}
+	for _, name := range touched.order {
+		samples = append(samples, *cache.samples[name])
+	}
+	return samples
+}
+
+// gnmiInterfaceLeaf finds the interface name in prefix+path and what comes
+// after state, like counters/in-octets or oper-status.
+func gnmiInterfaceLeaf(prefix *gpb.Path, path *gpb.Path) (string, string) {
+	elems := append(append([]*gpb.PathElem{}, prefix.GetElem()...), path.GetElem()...)
+	name := ""
+	leaf := []string{}
+	for _, e := range elems {
+		switch {
+		case e.Name == "interface" && name == "":
+			name = e.Key["name"]
+		case name != "" && !(len(leaf) == 0 && e.Name == "state"):
+			leaf = append(leaf, e.Name)
+		}
+	}
+	return name, strings.Join(leaf, "/")
+}
+
+// gnmiValue returns the value in a TypedValue.  JSON values come back as
+// map[string]interface{} with json.Number for numbers so 64 bit counters
+// don't lose anything.
+func gnmiValue(tv *gpb.TypedValue) (interface{}, error) {
+	switch v := tv.GetValue().(type) {
+	case *gpb.TypedValue_UintVal:
+		return v.UintVal, nil
+	case *gpb.TypedValue_IntVal:
+		return v.IntVal, nil
+	case *gpb.TypedValue_StringVal:
+		return v.StringVal, nil
+	case *gpb.TypedValue_JsonVal:
+		return decodeGNMIJSON(v.JsonVal)
+	case *gpb.TypedValue_JsonIetfVal:
+		return decodeGNMIJSON(v.JsonIetfVal)
+	}
+	return nil, nil
+}
+
+func decodeGNMIJSON(b []byte) (interface{}, error) {
+	var v interface{}
+	d := json.NewDecoder(bytes.NewReader(b))
+	d.UseNumber()
+	err := d.Decode(&v)
+	return v, err
+}
+
+// setGNMILeaf puts an openconfig-interfaces state leaf into the sample.  A
+// JSON object (the whole counters container) is walked leaf by leaf.
+func setGNMILeaf(s *InterfaceSample, leaf string, v interface{}) {
+	if m, ok := v.(map[string]interface{}); ok {
+		for k, inner := range m {
+			// JSON_IETF qualifies names with the module.
+			if i := strings.Index(k, ":"); i >= 0 {
+				k = k[i+1:]
+			}
+			if leaf != "" {
+				k = leaf + "/" + k
+			}
+			setGNMILeaf(s, k, inner)
+		}
+		return
+	}
+	if set := gnmiLeaves[leaf]; set != nil {
+		set(s, v)
+	}
+}
+
+// clearGNMILeaf empties leaf, and everything under it if it's a container
+// like counters.
+func clearGNMILeaf(s *InterfaceSample, leaf string) {
+	for l, set := range gnmiLeaves {
+		if l == leaf || strings.HasPrefix(l, leaf+"/") {
+			set(s, nil)
+		}
+	}
+}
+
+// The openconfig-interfaces state leaves we know, after state/.
+var gnmiLeaves = map[string]func(s *InterfaceSample, v interface{}){
+	"description":                 func(s *InterfaceSample, v interface{}) { s.Description = gnmiString(v) },
+	"mtu":                         func(s *InterfaceSample, v interface{}) { s.MTU = int(gnmiUint(v)) },
+	"ifindex":                     func(s *InterfaceSample, v interface{}) { s.IfId = gnmiString(v) },
+	"admin-status":                func(s *InterfaceSample, v interface{}) { s.AdminStatus = yang.Status(gnmiString(v)) },
+	"oper-status":                 func(s *InterfaceSample, v interface{}) { s.OperStatus = yang.Status(gnmiString(v)) },
+	"counters/in-octets":          func(s *InterfaceSample, v interface{}) { s.IfHCInOctets = gnmiUint(v) },
+	"counters/in-unicast-pkts":    func(s *InterfaceSample, v interface{}) { s.InUcastPkts = gnmiUint(v) },
+	"counters/in-multicast-pkts":  func(s *InterfaceSample, v interface{}) { s.InMulticastPkts = gnmiUint(v) },
+	"counters/in-broadcast-pkts":  func(s *InterfaceSample, v interface{}) { s.InBroadcastPkts = gnmiUint(v) },
+	"counters/in-pkts":            func(s *InterfaceSample, v interface{}) { s.InPkts = gnmiUint(v) },
+	"counters/in-discards":        func(s *InterfaceSample, v interface{}) { s.InDiscards = gnmiUint(v) },
+	"counters/in-errors":          func(s *InterfaceSample, v interface{}) { s.InErrors = gnmiUint(v) },
+	"counters/in-fcs-errors":      func(s *InterfaceSample, v interface{}) { s.InCRC = gnmiUint(v) },
+	"counters/out-octets":         func(s *InterfaceSample, v interface{}) { s.IfHCOutOctets = gnmiUint(v) },
+	"counters/out-unicast-pkts":   func(s *InterfaceSample, v interface{}) { s.OutUcastPkts = gnmiUint(v) },
+	"counters/out-multicast-pkts": func(s *InterfaceSample, v interface{}) { s.OutMulticastPkts = gnmiUint(v) },
+	"counters/out-broadcast-pkts": func(s *InterfaceSample, v interface{}) { s.OutBroadcastPkts = gnmiUint(v) },
+	"counters/out-pkts":           func(s *InterfaceSample, v interface{}) { s.OutPkts = gnmiUint(v) },
+	"counters/out-discards":       func(s *InterfaceSample, v interface{}) { s.OutDiscards = gnmiUint(v) },
+	"counters/out-errors":         func(s *InterfaceSample, v interface{}) { s.OutErrors = gnmiUint(v) },
+}
+
+// gnmiUint reads a counter whichever way it was encoded.  JSON_IETF sends
+// 64 bit numbers as strings.
+func gnmiUint(v interface{}) uint64 {
+	switch n := v.(type) {
+	case uint64:
+		return n
+	case int64:
+		if n > 0 {
+			return uint64(n)
+		}
+	case json.Number:
+		return parseCounter(n.String())
+	case string:
+		return parseCounter(n)
+	}
+	return 0
+}
+
+func gnmiString(v interface{}) string {
+	switch s := v.(type) {
+	case string:
+		return s
+	case json.Number:
+		return s.String()
+	case uint64:
+		return strconv.FormatUint(s, 10)
+	case int64:
+		return strconv.FormatInt(s, 10)
+	}
+	return ""
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	gpb "github.com/openconfig/gnmi/proto/gnmi"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// testGNMIServer plays one script of responses per Subscribe.  It drops
+// the stream at the end of every script but the last.
+type testGNMIServer struct {
+	scripts  chan []*gpb.SubscribeResponse
+	requests chan *gpb.SubscribeRequest
+	users    chan string
+}
+
+func (s *testGNMIServer) Capabilities(context.Context, *gpb.CapabilityRequest) (*gpb.CapabilityResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *testGNMIServer) Get(context.Context, *gpb.GetRequest) (*gpb.GetResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *testGNMIServer) Set(context.Context, *gpb.SetRequest) (*gpb.SetResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (s *testGNMIServer) Subscribe(stream gpb.GNMI_SubscribeServer) error {
+	md, _ := metadata.FromIncomingContext(stream.Context())
+	s.users <- md.Get("username")[0] + ":" + md.Get("password")[0]
+	req, err := stream.Recv()
+	if err != nil {
+		return err
+	}
+	s.requests <- req
+	script := <-s.scripts
+	for _, resp := range script {
+		if err := stream.Send(resp); err != nil {
+			return err
+		}
+	}
+	if len(s.scripts) > 0 {
+		return errors.New("dropped")
+	}
+	<-stream.Context().Done()
+	return nil
+}
+
+// gnmiUpdate is a notification for one interface.
+func gnmiUpdate(name string, deletes []string, updates map[string]*gpb.TypedValue) *gpb.SubscribeResponse {
+	n := &gpb.Notification{
+		Timestamp: 1500000000 * int64(time.Second),
+		Prefix: &gpb.Path{Elem: []*gpb.PathElem{
+			{Name: "interfaces"},
+			{Name: "interface", Key: map[string]string{"name": name}},
+		}},
+	}
+	for _, d := range deletes {
+		n.Delete = append(n.Delete, gnmiTestPath(d))
+	}
+	for p, v := range updates {
+		n.Update = append(n.Update, &gpb.Update{Path: gnmiTestPath(p), Val: v})
+	}
+	return &gpb.SubscribeResponse{Response: &gpb.SubscribeResponse_Update{Update: n}}
+}
+
+func gnmiTestPath(p string) *gpb.Path {
+	if p == "" {
+		return &gpb.Path{}
+	}
+	return gnmiPath(p)
+}
+
+func jsonIETF(s string) *gpb.TypedValue {
+	return &gpb.TypedValue{Value: &gpb.TypedValue_JsonIetfVal{JsonIetfVal: []byte(s)}}
+}
+
+func stringVal(s string) *gpb.TypedValue {
+	return &gpb.TypedValue{Value: &gpb.TypedValue_StringVal{StringVal: s}}
+}
+
+func uintVal(u uint64) *gpb.TypedValue {
+	return &gpb.TypedValue{Value: &gpb.TypedValue_UintVal{UintVal: u}}
+}
+
+var syncResponse = &gpb.SubscribeResponse{Response: &gpb.SubscribeResponse_SyncResponse{SyncResponse: true}}
+
+func TestCollectGNMI(t *testing.T) {
+	lis := bufconn.Listen(1 << 20)
+	srv := &testGNMIServer{
+		scripts:  make(chan []*gpb.SubscribeResponse, 2),
+		requests: make(chan *gpb.SubscribeRequest, 2),
+		users:    make(chan string, 2),
+	}
+	s := grpc.NewServer()
+	gpb.RegisterGNMIServer(s, srv)
+	go s.Serve(lis)
+	defer s.Stop()
+
+	oldSettings, oldOptions := gnmiSettings, gnmiDialOptions
+	defer func() { gnmiSettings, gnmiDialOptions = oldSettings, oldOptions }()
+	gnmiSettings.Plaintext = true
+	gnmiSettings.Port = 57400
+	gnmiSettings.SampleInterval = 10 * time.Second
+	gnmiDialOptions = []grpc.DialOption{grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	})}
+
+	srv.scripts <- []*gpb.SubscribeResponse{
+		// the first SAMPLE, as JSON_IETF the way NX-OS and IOS XR send it.
+		gnmiUpdate("Ethernet1", nil, map[string]*gpb.TypedValue{
+			"state/counters": jsonIETF(`{"openconfig-interfaces:in-octets": "18446744073709551615", "openconfig-interfaces:out-octets": "7", "openconfig-interfaces:in-unicast-pkts": "3"}`),
+		}),
+		syncResponse,
+		// ON_CHANGE leaves come one at a time.
+		gnmiUpdate("Ethernet1", nil, map[string]*gpb.TypedValue{"state/oper-status": stringVal("DOWN")}),
+		gnmiUpdate("Ethernet2", nil, map[string]*gpb.TypedValue{"state/oper-status": stringVal("UP")}),
+		// the counters go away, then a whole interface.
+		gnmiUpdate("Ethernet1", []string{"state/counters"}, nil),
+		gnmiUpdate("Ethernet2", []string{""}, nil),
+		gnmiUpdate("Ethernet2", nil, map[string]*gpb.TypedValue{"state/counters/in-octets": uintVal(1)}),
+	}
+	// after the reconnect.
+	srv.scripts <- []*gpb.SubscribeResponse{
+		gnmiUpdate("Ethernet1", nil, map[string]*gpb.TypedValue{"state/counters/in-octets": uintVal(5)}),
+	}
+
+	want := []InterfaceSample{
+		{IfName: "Ethernet1", IfHCInOctets: 18446744073709551615, IfHCOutOctets: 7, InUcastPkts: 3},
+		{IfName: "Ethernet1", IfHCInOctets: 18446744073709551615, IfHCOutOctets: 7, InUcastPkts: 3, OperStatus: "down"},
+		{IfName: "Ethernet2", OperStatus: "up"},
+		{IfName: "Ethernet1", OperStatus: "down"},
+		// Ethernet2 was deleted so it starts again from nothing.
+		{IfName: "Ethernet2", IfHCInOctets: 1},
+		// a new stream starts from nothing too.
+		{IfName: "Ethernet1", IfHCInOctets: 5},
+	}
+
+	lines, stop := watchUpstream(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		collectGNMI(ctx, "127.0.0.1", "admin:cisco")
+		close(done)
+	}()
+	for i, w := range want {
+		var line string
+		select {
+		case line = <-lines:
+		case <-time.After(10 * time.Second):
+			stop()
+			t.Fatalf("sample %d never came", i)
+		}
+		var got map[string][]InterfaceSample
+		if err := json.Unmarshal([]byte(line), &got); err != nil {
+			stop()
+			t.Fatal(err)
+		}
+		w.Switch = "127.0.0.1"
+		w.IfKey = interfaceKey(w.IfName)
+		w.TimeStamp = 1500000000
+		if len(got["127.0.0.1"]) != 1 || got["127.0.0.1"][0] != w {
+			t.Errorf("sample %d:\ngot  %+v\nwant %+v", i, got, w)
+		}
+	}
+	cancel()
+	<-done
+	stop()
+
+	for i := 0; i < 2; i++ {
+		if u := <-srv.users; u != "admin:cisco" {
+			t.Errorf("logged in as %q", u)
+		}
+		list := (<-srv.requests).GetSubscribe()
+		if list.GetMode() != gpb.SubscriptionList_STREAM || len(list.Subscription) != len(gnmiSubscriptions) {
+			t.Fatalf("subscribed with %v", list)
+		}
+		for j, sub := range list.Subscription {
+			if sub.Mode != gnmiSubscriptions[j].Mode {
+				t.Errorf("%s: mode %v", gnmiSubscriptions[j].Path, sub.Mode)
+			}
+			if sub.Mode == gpb.SubscriptionMode_SAMPLE && sub.SampleInterval != uint64(10*time.Second) {
+				t.Errorf("%s: sample interval %d", gnmiSubscriptions[j].Path, sub.SampleInterval)
+			}
+		}
+	}
+}
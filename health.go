@@ -0,0 +1,415 @@
+package main
+
+import (
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vallard/stickypipe-agent/nxapi"
+)
+
+// CPUReading is how busy one CPU was, in percent over the last minute.
+type CPUReading struct {
+	Name        string  `json:"name"`
+	Utilization float64 `json:"utilization"`
+}
+
+// MemoryReading is one memory pool, in bytes.
+type MemoryReading struct {
+	Name string `json:"name"`
+	Used uint64 `json:"used"`
+	Free uint64 `json:"free"`
+}
+
+// EnvironmentReading is a temperature, fan or power supply.  Status is one
+// of ok, warning, critical, failed, notPresent or unknown.  Fans and power
+// supplies often only have a status.
+type EnvironmentReading struct {
+	Name     string  `json:"name"`
+	Type     string  `json:"type"`
+	Value    float64 `json:"value,omitempty"`
+	Unit     string  `json:"unit,omitempty"`
+	Warning  float64 `json:"warning,omitempty"`
+	Critical float64 `json:"critical,omitempty"`
+	Status   string  `json:"status"`
+}
+
+// HealthReport is the device level sample sent with the interface samples.
+type HealthReport struct {
+	Switch      string               `json:"switch"`
+	TimeStamp   int64                `json:"timeStamp"`
+	CPU         []CPUReading         `json:"cpu,omitempty"`
+	Memory      []MemoryReading      `json:"memory,omitempty"`
+	Environment []EnvironmentReading `json:"environment,omitempty"`
+}
+
+// healthProfile is the tables of one MIB and how to read them into a
+// report.  Switches just don't answer for MIBs they don't have so every
+// profile is tried, unless the device's metricProfile says which are worth
+// it.  names is entPhysicalName by entPhysicalIndex.
+type healthProfile struct {
+	mib  string
+	work map[string]string
+	read func(r *HealthReport, rows map[string]map[string]string, names map[string]string)
+}
+
+var healthProfiles = []healthProfile{
+	{
+		mib: "CISCO-PROCESS-MIB",
+		work: map[string]string{
+			".1.3.6.1.4.1.9.9.109.1.1.1.1.2":  "physicalIndex",
+			".1.3.6.1.4.1.9.9.109.1.1.1.1.7":  "total1minRev",
+			".1.3.6.1.4.1.9.9.109.1.1.1.1.12": "memoryUsed",
+			".1.3.6.1.4.1.9.9.109.1.1.1.1.13": "memoryFree",
+		},
+		read: readCiscoProcess,
+	},
+	{
+		mib: "CISCO-MEMORY-POOL-MIB",
+		work: map[string]string{
+			".1.3.6.1.4.1.9.9.48.1.1.1.2": "name",
+			".1.3.6.1.4.1.9.9.48.1.1.1.5": "used",
+			".1.3.6.1.4.1.9.9.48.1.1.1.6": "free",
+		},
+		read: readCiscoMemoryPool,
+	},
+	{
+		mib: "HOST-RESOURCES-MIB",
+		work: map[string]string{
+			".1.3.6.1.2.1.25.3.3.1.2": "processorLoad",
+			".1.3.6.1.2.1.25.2.3.1.2": "storageType",
+			".1.3.6.1.2.1.25.2.3.1.3": "storageDescr",
+			".1.3.6.1.2.1.25.2.3.1.4": "storageAllocationUnits",
+			".1.3.6.1.2.1.25.2.3.1.5": "storageSize",
+			".1.3.6.1.2.1.25.2.3.1.6": "storageUsed",
+		},
+		read: readHostResources,
+	},
+	{
+		mib: "ENTITY-SENSOR-MIB",
+		work: map[string]string{
+			".1.3.6.1.2.1.99.1.1.1.1": "type",
+			".1.3.6.1.2.1.99.1.1.1.2": "scale",
+			".1.3.6.1.2.1.99.1.1.1.3": "precision",
+			".1.3.6.1.2.1.99.1.1.1.4": "value",
+			".1.3.6.1.2.1.99.1.1.1.5": "status",
+		},
+		read: readEntitySensors,
+	},
+	{
+		mib: "CISCO-ENVMON-MIB",
+		work: map[string]string{
+			".1.3.6.1.4.1.9.9.13.1.3.1.2": "temperatureDescr",
+			".1.3.6.1.4.1.9.9.13.1.3.1.3": "temperatureValue",
+			".1.3.6.1.4.1.9.9.13.1.3.1.4": "temperatureThreshold",
+			".1.3.6.1.4.1.9.9.13.1.3.1.6": "temperatureState",
+		},
+		read: readCiscoEnvMonTemperatures,
+	},
+	{
+		mib: "CISCO-ENVMON-MIB",
+		work: map[string]string{
+			".1.3.6.1.4.1.9.9.13.1.4.1.2": "fanDescr",
+			".1.3.6.1.4.1.9.9.13.1.4.1.3": "fanState",
+		},
+		read: readCiscoEnvMonFans,
+	},
+	{
+		mib: "CISCO-ENVMON-MIB",
+		work: map[string]string{
+			".1.3.6.1.4.1.9.9.13.1.5.1.2": "supplyDescr",
+			".1.3.6.1.4.1.9.9.13.1.5.1.3": "supplyState",
+		},
+		read: readCiscoEnvMonSupplies,
+	},
+}
+
+// entPhysicalName, to name CPUs and sensors.
+const entPhysicalName = ".1.3.6.1.2.1.47.1.1.1.1.7"
+
+/*
+	Walk the health MIBs of a switch and send up its CPU, memory and
+	environment.
+
+Arguments:
+
+	server - the switch
+	creds - the SNMP community string
+	sw - the switch name from sysName
+	mibs - the MIBs of healthProfiles to walk, all of them if nil
+*/
+func collectSNMPHealth(server string, creds string, sw string, mibs []string) {
+	profiles := []healthProfile{}
+	for _, p := range healthProfiles {
+		if mibs == nil || contains(mibs, p.mib) {
+			profiles = append(profiles, p)
+		}
+	}
+	entities := map[string]map[string]string{}
+	tables := make([]map[string]map[string]string, len(profiles))
+	var wg sync.WaitGroup
+	wg.Add(len(profiles) + 1)
+	go func() {
+		defer wg.Done()
+		walkTable(server, creds, entPhysicalName, "name", entities)
+	}()
+	for i, p := range profiles {
+		tables[i] = map[string]map[string]string{}
+		go func(work map[string]string, m map[string]map[string]string) {
+			defer wg.Done()
+			walkColumns(server, creds, work, m)
+		}(p.work, tables[i])
+	}
+	wg.Wait()
+
+	names := map[string]string{}
+	for index, v := range entities {
+		names[index] = v["name"]
+	}
+	r := HealthReport{Switch: sw, TimeStamp: time.Now().Unix()}
+	for i, p := range profiles {
+		if len(tables[i]) > 0 {
+			p.read(&r, tables[i], names)
+		}
+	}
+	sendHealth(r)
+}
+
+// sendHealth sends the report if there is anything in it.
+func sendHealth(r HealthReport) {
+	if len(r.CPU) == 0 && len(r.Memory) == 0 && len(r.Environment) == 0 {
+		return
+	}
+	sendUpstream(r)
+}
+
+func readCiscoProcess(r *HealthReport, rows map[string]map[string]string, names map[string]string) {
+	for index, v := range rows {
+		name := names[v["physicalIndex"]]
+		if name == "" {
+			name = "cpu " + index
+		}
+		if v["total1minRev"] != "" {
+			r.CPU = append(r.CPU, CPUReading{Name: name, Utilization: parseFloat(v["total1minRev"])})
+		}
+		// NX-OS has no memory pools, just this.  It is in KB.
+		if v["memoryUsed"] != "" {
+			r.Memory = append(r.Memory, MemoryReading{
+				Name: name,
+				Used: parseCounter(v["memoryUsed"]) * 1024,
+				Free: parseCounter(v["memoryFree"]) * 1024,
+			})
+		}
+	}
+}
+
+func readCiscoMemoryPool(r *HealthReport, rows map[string]map[string]string, names map[string]string) {
+	for _, v := range rows {
+		r.Memory = append(r.Memory, MemoryReading{
+			Name: v["name"],
+			Used: parseCounter(v["used"]),
+			Free: parseCounter(v["free"]),
+		})
+	}
+}
+
+// hrStorageRam
+const hrStorageRam = "1.3.6.1.2.1.25.2.1.2"
+
+func readHostResources(r *HealthReport, rows map[string]map[string]string, names map[string]string) {
+	for index, v := range rows {
+		if v["processorLoad"] != "" {
+			r.CPU = append(r.CPU, CPUReading{Name: "cpu " + index, Utilization: parseFloat(v["processorLoad"])})
+		}
+		if strings.TrimPrefix(v["storageType"], ".") == hrStorageRam {
+			units := parseCounter(v["storageAllocationUnits"])
+			size := parseCounter(v["storageSize"]) * units
+			used := parseCounter(v["storageUsed"]) * units
+			if used > size {
+				used = size
+			}
+			r.Memory = append(r.Memory, MemoryReading{Name: v["storageDescr"], Used: used, Free: size - used})
+		}
+	}
+}
+
+// EntitySensorDataType, what the reading is and its unit.
+var sensorTypes = map[string][2]string{
+	"3":  {"voltage", "VAC"},
+	"4":  {"voltage", "VDC"},
+	"5":  {"current", "A"},
+	"6":  {"power", "W"},
+	"7":  {"frequency", "Hz"},
+	"8":  {"temperature", "C"},
+	"9":  {"humidity", "%RH"},
+	"10": {"fan", "rpm"},
+	"11": {"airflow", "cmm"},
+	"12": {"status", ""},
+}
+
+func readEntitySensors(r *HealthReport, rows map[string]map[string]string, names map[string]string) {
+	for index, v := range rows {
+		t, ok := sensorTypes[v["type"]]
+		if !ok {
+			continue
+		}
+		name := names[index]
+		if name == "" {
+			name = "sensor " + index
+		}
+		status := "unknown"
+		switch v["status"] {
+		case "1":
+			status = "ok"
+		case "3":
+			status = "failed"
+		}
+		r.Environment = append(r.Environment, EnvironmentReading{
+			Name:   name,
+			Type:   t[0],
+			Value:  sensorValue(v["value"], v["scale"], v["precision"]),
+			Unit:   t[1],
+			Status: status,
+		})
+	}
+}
+
+// sensorValue applies the scale (units is 9, each step either side is a
+// factor of 1000) and precision (decimal places) of an entity sensor.
+func sensorValue(value string, scale string, precision string) float64 {
+	v := parseFloat(value)
+	s, err := strconv.Atoi(scale)
+	if err != nil {
+		s = 9
+	}
+	p, _ := strconv.Atoi(precision)
+	return v * math.Pow10((s-9)*3-p)
+}
+
+// CiscoEnvMonState
+func envMonStatus(state string) string {
+	switch state {
+	case "1":
+		return "ok"
+	case "2":
+		return "warning"
+	case "3":
+		return "critical"
+	case "4", "6":
+		return "failed"
+	case "5":
+		return "notPresent"
+	}
+	return "unknown"
+}
+
+func readCiscoEnvMonTemperatures(r *HealthReport, rows map[string]map[string]string, names map[string]string) {
+	for _, v := range rows {
+		r.Environment = append(r.Environment, EnvironmentReading{
+			Name:     v["temperatureDescr"],
+			Type:     "temperature",
+			Value:    parseFloat(v["temperatureValue"]),
+			Unit:     "C",
+			Critical: parseFloat(v["temperatureThreshold"]),
+			Status:   envMonStatus(v["temperatureState"]),
+		})
+	}
+}
+
+func readCiscoEnvMonFans(r *HealthReport, rows map[string]map[string]string, names map[string]string) {
+	for _, v := range rows {
+		r.Environment = append(r.Environment, EnvironmentReading{
+			Name:   v["fanDescr"],
+			Type:   "fan",
+			Status: envMonStatus(v["fanState"]),
+		})
+	}
+}
+
+func readCiscoEnvMonSupplies(r *HealthReport, rows map[string]map[string]string, names map[string]string) {
+	for _, v := range rows {
+		r.Environment = append(r.Environment, EnvironmentReading{
+			Name:   v["supplyDescr"],
+			Type:   "powerSupply",
+			Status: envMonStatus(v["supplyState"]),
+		})
+	}
+}
+
+// turn show system resources and show environment into a report.  Either
+// can be missing.
+func nxapiHealth(sw string, now int64, res *nxapi.SystemResources, env *nxapi.Environment) HealthReport {
+	r := HealthReport{Switch: sw, TimeStamp: now}
+	if res != nil {
+		r.CPU = append(r.CPU, CPUReading{Name: "total", Utilization: 100 - res.Cpu_State_Idle})
+		for _, c := range res.Cpu_Usage {
+			r.CPU = append(r.CPU, CPUReading{Name: "cpu " + c.Cpuid, Utilization: 100 - c.Idle})
+		}
+		if res.Memory_Usage_Total > 0 {
+			r.Memory = append(r.Memory, MemoryReading{
+				Name: "system",
+				Used: res.Memory_Usage_Used * 1024,
+				Free: res.Memory_Usage_Free * 1024,
+			})
+		}
+	}
+	if env != nil {
+		for _, t := range env.Temperatures {
+			r.Environment = append(r.Environment, EnvironmentReading{
+				Name:     strings.TrimSpace(t.Tempmod + " " + t.Sensor),
+				Type:     "temperature",
+				Value:    parseFloat(t.Curtemp),
+				Unit:     "C",
+				Warning:  parseFloat(t.Minthres),
+				Critical: parseFloat(t.Majthres),
+				Status:   nxapiHealthStatus(t.Alarmstatus),
+			})
+		}
+		for _, f := range env.Fans {
+			r.Environment = append(r.Environment, EnvironmentReading{
+				Name:   f.Fanname,
+				Type:   "fan",
+				Status: nxapiHealthStatus(f.Fanstatus),
+			})
+		}
+		for _, p := range env.PowerSupplies {
+			r.Environment = append(r.Environment, EnvironmentReading{
+				Name:   "Power Supply " + p.Psnum,
+				Type:   "powerSupply",
+				Value:  parseFloat(strings.TrimSuffix(strings.TrimSpace(p.Actual_Out), " W")),
+				Unit:   "W",
+				Status: nxapiHealthStatus(p.Ps_Status),
+			})
+		}
+	}
+	return r
+}
+
+// NX-OS statuses are words like Ok, Minor, Major, Absent or Fail/Shutdown.
+func nxapiHealthStatus(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	switch {
+	case s == "ok" || s == "normal":
+		return "ok"
+	case s == "minor":
+		return "warning"
+	case s == "major":
+		return "critical"
+	case strings.Contains(s, "absent") || strings.Contains(s, "not present"):
+		return "notPresent"
+	case strings.Contains(s, "fail") || strings.Contains(s, "shut"):
+		return "failed"
+	}
+	return "unknown"
+}
+
+// parseFloat reads a number we got as a string, 0 if it isn't one.
+func parseFloat(s string) float64 {
+	f, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil {
+		return 0
+	}
+	return f
+}
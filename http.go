@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// All the collectors that talk HTTP to a switch (NXAPI, NXAPI-REST, ...)
+// share this client so they get the same timeouts and TLS settings.
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// The TLS settings for everything that talks to a switch over TLS, HTTPS or
+// not (gNMI).
+var tlsConfig = &tls.Config{}
+
+// setupHTTPClient sets up TLS for the shared client.  Most switches ship with
+// a self signed certificate so we let the user either skip verification or
+// hand us the CA that signed the switch certificates.
+func setupHTTPClient(insecure bool, caFile string) error {
+	tlsConfig = &tls.Config{InsecureSkipVerify: insecure}
+	if caFile != "" {
+		pem, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", caFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	httpClient.Transport = &http.Transport{
+		Proxy:           http.ProxyFromEnvironment,
+		TLSClientConfig: tlsConfig,
+	}
+	return nil
+}
+
+// splitCredentials takes credentials that look like admin:cisco where admin
+// is the user and cisco is the password.  The password may have :'s in it,
+// the user may not.
+func splitCredentials(creds string) (string, string, error) {
+	up := strings.SplitN(creds, ":", 2)
+	// make sure that we parsed the username and password.
+	if len(up) < 2 {
+		return "", "", errors.New("Credentials must be of form user:password")
+	}
+	return up[0], up[1], nil
+}
+
+// newJSONRequest starts an HTTP request to a switch.  If creds are given they
+// are sent with basic auth.
+func newJSONRequest(method string, url string, body []byte, creds string) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(body))
+	if err != nil {
+		return nil, err
+	}
+	// The header has to be set to application/json
+	req.Header.Set("content-type", "application/json")
+	if creds != "" {
+		user, pass, err := splitCredentials(creds)
+		if err != nil {
+			return nil, err
+		}
+		// add the username and password to the header.
+		req.SetBasicAuth(user, pass)
+	}
+	return req, nil
+}
+
+// httpError is a response that came back but wasn't a 2xx.
+type httpError struct {
+	Method     string
+	URL        string
+	StatusCode int
+	Status     string
+}
+
+func (e *httpError) Error() string {
+	return fmt.Sprintf("%s %s: %s", e.Method, e.URL, e.Status)
+}
+
+// doJSON executes req with the shared client and unmarshals the response
+// body into v.
+func doJSON(req *http.Request, v interface{}) error {
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &httpError{req.Method, req.URL.String(), resp.StatusCode, resp.Status}
+	}
+	// 204 No Content and friends.
+	if len(body) == 0 {
+		return nil
+	}
+	// numbers that end up in an interface{} (NX-API bodies) are kept as
+	// json.Number, as float64 counters over 2^53 lose their low digits.
+	d := json.NewDecoder(bytes.NewReader(body))
+	d.UseNumber()
+	if err := d.Decode(v); err != nil {
+		return fmt.Errorf("Error unmarshalling: %v", err)
+	}
+	return nil
+}
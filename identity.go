@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// InterfaceIdentity is everything we've seen an interface called.  Key is
+// what samples carry as ifKey: the interface name spelled out in full and
+// lower case, so Eth1/1 from ifName, Ethernet1/1 from ifDescr and NX-API
+// all come out as ethernet1/1.  IfIndex can change when a switch reloads,
+// Key doesn't.
+type InterfaceIdentity struct {
+	Key      string `json:"key"`
+	IfIndex  string `json:"ifIndex,omitempty"`
+	IfName   string `json:"ifName,omitempty"`
+	IfDescr  string `json:"ifDescr,omitempty"`
+	IfAlias  string `json:"ifAlias,omitempty"`
+	NXOSName string `json:"nxosName,omitempty"`
+}
+
+// deviceInterfaces is the interfaces of one switch in the interface file.
+type deviceInterfaces struct {
+	Name       string                        `json:"name"`
+	Endpoint   string                        `json:"endpoint,omitempty"`
+	Interfaces map[string]*InterfaceIdentity `json:"interfaces"`
+}
+
+// The interfaces of every switch we've polled by device name, which is the
+// same whichever method we poll it with.  Written to file, if there is one,
+// so the ifIndex to name mapping is there for flows and traps as soon as we
+// start.
+var identities = struct {
+	sync.Mutex
+	file    string
+	devices map[string]*deviceInterfaces
+}{devices: map[string]*deviceInterfaces{}}
+
+// the long names of the abbreviations switches use in ifName and the CLI.
+var interfaceAbbreviations = map[string]string{
+	"e":    "ethernet",
+	"et":   "ethernet",
+	"eth":  "ethernet",
+	"fa":   "fastethernet",
+	"gi":   "gigabitethernet",
+	"gig":  "gigabitethernet",
+	"te":   "tengigabitethernet",
+	"ten":  "tengigabitethernet",
+	"twe":  "twentyfivegige",
+	"fo":   "fortygigabitethernet",
+	"hu":   "hundredgige",
+	"po":   "port-channel",
+	"lo":   "loopback",
+	"vl":   "vlan",
+	"tu":   "tunnel",
+	"mgmt": "mgmt",
+}
+
+// interfaceKey turns any of the names of an interface into its Key.
+func interfaceKey(name string) string {
+	name = strings.ToLower(strings.Replace(name, " ", "", -1))
+	i := strings.IndexFunc(name, func(r rune) bool { return !unicode.IsLetter(r) })
+	if i <= 0 {
+		return name
+	}
+	if long, ok := interfaceAbbreviations[name[:i]]; ok {
+		return long + name[i:]
+	}
+	return name
+}
+
+// deviceKey is the name we keep a switch's interfaces under.
+func deviceKey(sw string) string {
+	return strings.ToLower(sw)
+}
+
+// findDevice returns the interfaces of sw, nil if we don't have them.
+// sysName is often the FQDN where the NX-OS hostname isn't, so leaf1 and
+// leaf1.example.com are the same switch as long as there's only one leaf1
+// it could be.  Two FQDNs are only the same if they're the same name.
+// endpoint, if we know it, picks between switches with the same hostname.
+// Must hold the lock.
+func findDevice(sw string, endpoint string) *deviceInterfaces {
+	k := deviceKey(sw)
+	if d := identities.devices[k]; d != nil || net.ParseIP(k) != nil {
+		return d
+	}
+	host := strings.Split(k, ".")[0]
+	found := []*deviceInterfaces{}
+	for other, d := range identities.devices {
+		if net.ParseIP(other) == nil && strings.Split(other, ".")[0] == host && (other == host || k == host) {
+			found = append(found, d)
+		}
+	}
+	if len(found) > 1 && endpoint != "" {
+		same := []*deviceInterfaces{}
+		for _, d := range found {
+			if d.Endpoint == endpoint {
+				same = append(same, d)
+			}
+		}
+		found = same
+	}
+	if len(found) != 1 {
+		return nil
+	}
+	return found[0]
+}
+
+// loadIdentities reads the interface file, if there is one yet, and
+// remembers it so changes get saved to it.
+func loadIdentities(file string) error {
+	identities.Lock()
+	defer identities.Unlock()
+	identities.file = file
+	b, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, &identities.devices)
+}
+
+func saveIdentities() {
+	if identities.file == "" {
+		return
+	}
+	b, err := json.MarshalIndent(identities.devices, "", "  ")
+	if err == nil {
+		err = writeFileAtomic(identities.file, b)
+	}
+	if err != nil {
+		log.Println(identities.file, err)
+	}
+}
+
+// identityDevice returns the interfaces of sw, creating them if needed.
+// Must hold the lock.
+func identityDevice(sw string, endpoint string) *deviceInterfaces {
+	d := findDevice(sw, endpoint)
+	if d == nil {
+		d = &deviceInterfaces{Name: sw, Interfaces: map[string]*InterfaceIdentity{}}
+		identities.devices[deviceKey(sw)] = d
+	}
+	if endpoint != "" {
+		d.Endpoint = endpoint
+	}
+	return d
+}
+
+/*
+	Update the identities of a switch's interfaces from an SNMP poll.
+
+Arguments:
+
+	endpoint - the switch we polled
+	sw - the switch name from sysName
+	m - what we walked, by ifIndex
+
+Returns the Key of each ifIndex.  An ifIndex that now belongs to another
+interface is taken off the one it used to be.
+*/
+func identifySNMPInterfaces(endpoint string, sw string, m map[string]map[string]string) map[string]string {
+	keys := map[string]string{}
+	// nothing answered.
+	if sw == "" {
+		return keys
+	}
+	identities.Lock()
+	defer identities.Unlock()
+	d := identityDevice(sw, endpoint)
+	changed := false
+	byIndex := map[string]*InterfaceIdentity{}
+	for _, i := range d.Interfaces {
+		if i.IfIndex != "" {
+			byIndex[i.IfIndex] = i
+		}
+	}
+	for ifIndex, v := range m {
+		name := v["name"]
+		if name == "" {
+			name = v["ifName"]
+		}
+		if name == "" {
+			continue
+		}
+		k := interfaceKey(name)
+		keys[ifIndex] = k
+		i := d.Interfaces[k]
+		if i == nil {
+			i = &InterfaceIdentity{Key: k}
+			d.Interfaces[k] = i
+			changed = true
+		}
+		if old := byIndex[ifIndex]; old != nil && old != i && old.IfIndex == ifIndex {
+			log.Println(sw, "ifIndex", ifIndex, "moved from", old.Key, "to", k)
+			old.IfIndex = ""
+			changed = true
+		}
+		if i.IfIndex != "" && i.IfIndex != ifIndex {
+			log.Println(sw, k, "renumbered from ifIndex", i.IfIndex, "to", ifIndex)
+		}
+		n := InterfaceIdentity{Key: k, IfIndex: ifIndex, IfName: v["ifName"], IfDescr: v["name"], IfAlias: v["ifAlias"], NXOSName: i.NXOSName}
+		if n != *i {
+			*i = n
+			changed = true
+		}
+	}
+	if changed {
+		saveIdentities()
+	}
+	return keys
+}
+
+// identifyNXAPIInterfaces records what NX-API calls the interfaces of sw
+// and, from show interface snmp-ifindex, their ifIndexes by Key.
+func identifyNXAPIInterfaces(endpoint string, sw string, names []string, ifIndexes map[string]string) {
+	identities.Lock()
+	defer identities.Unlock()
+	d := identityDevice(sw, endpoint)
+	changed := false
+	for _, name := range names {
+		k := interfaceKey(name)
+		i := d.Interfaces[k]
+		if i == nil {
+			i = &InterfaceIdentity{Key: k}
+			d.Interfaces[k] = i
+			changed = true
+		}
+		if i.NXOSName != name {
+			i.NXOSName = name
+			changed = true
+		}
+		if ifIndex := ifIndexes[k]; ifIndex != "" && i.IfIndex != ifIndex {
+			for _, other := range d.Interfaces {
+				if other != i && other.IfIndex == ifIndex {
+					other.IfIndex = ""
+				}
+			}
+			i.IfIndex = ifIndex
+			changed = true
+		}
+	}
+	if changed {
+		saveIdentities()
+	}
+}
+
+// interfaceIdentity returns what we know of an interface of sw by any of
+// its names.
+func interfaceIdentity(sw string, name string) (InterfaceIdentity, bool) {
+	identities.Lock()
+	defer identities.Unlock()
+	d := findDevice(sw, "")
+	if d == nil {
+		return InterfaceIdentity{}, false
+	}
+	i := d.Interfaces[interfaceKey(name)]
+	if i == nil {
+		return InterfaceIdentity{}, false
+	}
+	return *i, true
+}
+
+// identityByIndex finds the interface with ifIndex on the switch we poll
+// at endpoint, for when we haven't polled it since we started.
+func identityByIndex(endpoint string, ifIndex string) (string, InterfaceIdentity, bool) {
+	identities.Lock()
+	defer identities.Unlock()
+	for _, d := range identities.devices {
+		if d.Endpoint != endpoint {
+			continue
+		}
+		for _, i := range d.Interfaces {
+			if i.IfIndex == ifIndex {
+				return d.Name, *i, true
+			}
+		}
+	}
+	return "", InterfaceIdentity{}, false
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// freshIdentities starts the test with no switches known, and the ones it
+// learns kept in file if there is one.
+func freshIdentities(t *testing.T, file string) {
+	identities.Lock()
+	old, oldFile := identities.devices, identities.file
+	identities.devices = map[string]*deviceInterfaces{}
+	identities.file = file
+	identities.Unlock()
+	t.Cleanup(func() {
+		identities.Lock()
+		identities.devices, identities.file = old, oldFile
+		identities.Unlock()
+	})
+}
+
+func TestInterfaceKey(t *testing.T) {
+	tests := []struct {
+		names []string
+		key   string
+	}{
+		{[]string{"Eth1/1", "Ethernet1/1", "ethernet1/1", "Ethernet 1/1", "Et1/1", "e1/1"}, "ethernet1/1"},
+		{[]string{"Gi0/1", "GigabitEthernet0/1", "Gig0/1"}, "gigabitethernet0/1"},
+		{[]string{"Te1/0/1", "TenGigabitEthernet1/0/1"}, "tengigabitethernet1/0/1"},
+		{[]string{"Twe1/0/1", "TwentyFiveGigE1/0/1"}, "twentyfivegige1/0/1"},
+		{[]string{"Hu1/0/49", "HundredGigE1/0/49"}, "hundredgige1/0/49"},
+		{[]string{"Po10", "port-channel10", "Port-channel10"}, "port-channel10"},
+		{[]string{"Vl20", "Vlan20"}, "vlan20"},
+		{[]string{"Lo0", "loopback0"}, "loopback0"},
+		{[]string{"mgmt0"}, "mgmt0"},
+		// names we don't know the long form of are only lower cased.
+		{[]string{"Null0"}, "null0"},
+		{[]string{"1/1/1"}, "1/1/1"},
+	}
+	for _, tt := range tests {
+		for _, name := range tt.names {
+			if k := interfaceKey(name); k != tt.key {
+				t.Errorf("%s: key %s, want %s", name, k, tt.key)
+			}
+		}
+	}
+}
+
+func TestDeviceNames(t *testing.T) {
+	freshIdentities(t, "")
+	identifyNXAPIInterfaces("10.0.0.1", "leaf1", []string{"Ethernet1/1"}, nil)
+	identifyNXAPIInterfaces("10.0.1.1", "spine1.dc1.example.com", []string{"Ethernet1/1"}, nil)
+	identifyNXAPIInterfaces("10.0.2.1", "spine1.dc2.example.com", []string{"Ethernet1/2"}, nil)
+
+	tests := []struct {
+		sw       string
+		endpoint string
+		want     string
+	}{
+		{"leaf1", "", "leaf1"},
+		{"LEAF1", "", "leaf1"},
+		// sysName with the domain is the NX-OS hostname's switch.
+		{"leaf1.dc1.example.com", "", "leaf1"},
+		{"spine1.dc1.example.com", "", "spine1.dc1.example.com"},
+		{"spine1.dc2.example.com", "", "spine1.dc2.example.com"},
+		// another domain is another switch.
+		{"spine1.dc3.example.com", "", ""},
+		// which spine1 is only known by where it is.
+		{"spine1", "", ""},
+		{"spine1", "10.0.2.1", "spine1.dc2.example.com"},
+		{"spine1", "10.0.9.1", ""},
+		{"10.0.0.1", "", ""},
+	}
+	identities.Lock()
+	defer identities.Unlock()
+	for _, tt := range tests {
+		d := findDevice(tt.sw, tt.endpoint)
+		got := ""
+		if d != nil {
+			got = d.Name
+		}
+		if got != tt.want {
+			t.Errorf("%s at %q: got %q, want %q", tt.sw, tt.endpoint, got, tt.want)
+		}
+	}
+}
+
+func TestIdentifyInterfaces(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "interfaces.json")
+	freshIdentities(t, file)
+
+	walk := map[string]map[string]string{
+		"1":  {"ifName": "Eth1/1", "name": "Ethernet1/1", "ifAlias": "uplink"},
+		"2":  {"ifName": "Eth1/2", "name": "Ethernet1/2"},
+		"10": {"ifName": "Po10", "name": "port-channel10"},
+	}
+	keys := identifySNMPInterfaces("10.0.0.1", "leaf1.example.com", walk)
+	if keys["1"] != "ethernet1/1" || keys["2"] != "ethernet1/2" || keys["10"] != "port-channel10" {
+		t.Errorf("keys %v", keys)
+	}
+
+	// NX-API knows it by its hostname and adds its own names.
+	identifyNXAPIInterfaces("10.0.0.1", "leaf1", []string{"Ethernet1/1", "Ethernet1/2", "port-channel10"},
+		map[string]string{"ethernet1/1": "1", "ethernet1/2": "2", "port-channel10": "10"})
+	if i, ok := interfaceIdentity("leaf1", "Eth1/1"); !ok || i.IfIndex != "1" || i.IfAlias != "uplink" || i.NXOSName != "Ethernet1/1" {
+		t.Errorf("Eth1/1 %+v %v", i, ok)
+	}
+
+	// after a reload the port channel has a new ifIndex and Ethernet1/2
+	// has the one Ethernet1/1 had.
+	walk = map[string]map[string]string{
+		"1":         {"ifName": "Eth1/2", "name": "Ethernet1/2"},
+		"369098761": {"ifName": "Po10", "name": "port-channel10"},
+	}
+	identifySNMPInterfaces("10.0.0.1", "leaf1.example.com", walk)
+	tests := []struct {
+		name    string
+		ifIndex string
+	}{
+		{"Ethernet1/1", ""},
+		{"Ethernet1/2", "1"},
+		{"Po10", "369098761"},
+	}
+	for _, tt := range tests {
+		i, ok := interfaceIdentity("leaf1.example.com", tt.name)
+		if !ok || i.IfIndex != tt.ifIndex {
+			t.Errorf("%s: %+v %v, want ifIndex %q", tt.name, i, ok, tt.ifIndex)
+		}
+	}
+	if sw, i, ok := identityByIndex("10.0.0.1", "1"); !ok || sw != "leaf1.example.com" || i.Key != "ethernet1/2" || i.NXOSName != "Ethernet1/2" {
+		t.Errorf("ifIndex 1: %s %+v %v", sw, i, ok)
+	}
+	if _, _, ok := identityByIndex("10.0.0.1", "10"); ok {
+		t.Error("old port channel ifIndex still found")
+	}
+
+	// and it's all in the file for next time, under the name it was first
+	// seen by.
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := map[string]*deviceInterfaces{}
+	if err := json.Unmarshal(b, &saved); err != nil {
+		t.Fatal(err)
+	}
+	if len(saved) != 1 || saved["leaf1.example.com"] == nil || saved["leaf1.example.com"].Interfaces["port-channel10"].IfIndex != "369098761" {
+		t.Errorf("saved %s", b)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vallard/stickypipe-agent/nxapi"
+)
+
+// InventoryItem is one physical part of a switch: the chassis, a line card,
+// a power supply, a transceiver.
+type InventoryItem struct {
+	Index       string `json:"index,omitempty"`
+	ContainedIn string `json:"containedIn,omitempty"`
+	Class       string `json:"class"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Vendor      string `json:"vendor,omitempty"`
+	PartNumber  string `json:"partNumber,omitempty"`
+	Serial      string `json:"serial,omitempty"`
+	HardwareRev string `json:"hardwareRev,omitempty"`
+	FirmwareRev string `json:"firmwareRev,omitempty"`
+	SoftwareRev string `json:"softwareRev,omitempty"`
+	FRU         bool   `json:"fru,omitempty"`
+}
+
+// InventoryReport is everything racked in one switch.  It is sent every
+// SP_INVENTORY_INTERVAL rather than with the counters.
+type InventoryReport struct {
+	Switch    string          `json:"switch"`
+	TimeStamp int64           `json:"timeStamp"`
+	Items     []InventoryItem `json:"items"`
+}
+
+// Inventory settings, set from the environment in main.
+var inventoryInterval time.Duration
+
+// inventorySchedule is when the inventory of each device is next due.  A
+// device's time only moves on once its inventory came back, so one that
+// was down or didn't answer is asked again the next time around.
+type inventorySchedule struct {
+	mutex sync.Mutex
+	next  map[string]time.Time
+}
+
+func newInventorySchedule() *inventorySchedule {
+	return &inventorySchedule{next: map[string]time.Time{}}
+}
+
+// due says if the device's inventory should be collected now.  A device
+// we haven't collected from yet is always due.
+func (s *inventorySchedule) due(device string, now time.Time) bool {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return !now.Before(s.next[device])
+}
+
+// collected moves the device's time on after a successful inventory.
+func (s *inventorySchedule) collected(device string, now time.Time) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.next[device] = now.Add(inventoryInterval)
+}
+
+// entPhysicalTable columns.
+var entityWork = map[string]string{
+	".1.3.6.1.2.1.47.1.1.1.1.2":  "descr",
+	".1.3.6.1.2.1.47.1.1.1.1.4":  "containedIn",
+	".1.3.6.1.2.1.47.1.1.1.1.5":  "class",
+	".1.3.6.1.2.1.47.1.1.1.1.7":  "name",
+	".1.3.6.1.2.1.47.1.1.1.1.8":  "hardwareRev",
+	".1.3.6.1.2.1.47.1.1.1.1.9":  "firmwareRev",
+	".1.3.6.1.2.1.47.1.1.1.1.10": "softwareRev",
+	".1.3.6.1.2.1.47.1.1.1.1.11": "serial",
+	".1.3.6.1.2.1.47.1.1.1.1.12": "mfgName",
+	".1.3.6.1.2.1.47.1.1.1.1.13": "modelName",
+	".1.3.6.1.2.1.47.1.1.1.1.16": "isFRU",
+}
+
+// PhysicalClass from ENTITY-MIB.
+var entityClasses = map[string]string{
+	"1":  "other",
+	"2":  "unknown",
+	"3":  "chassis",
+	"4":  "backplane",
+	"5":  "container",
+	"6":  "powerSupply",
+	"7":  "fan",
+	"8":  "sensor",
+	"9":  "module",
+	"10": "port",
+	"11": "stack",
+	"12": "cpu",
+}
+
+/*
+	Walk ENTITY-MIB on a switch and send up its inventory.
+
+Arguments:
+
+	server - the switch
+	creds - the SNMP community string
+	sw - the switch name from sysName
+
+Switches list every slot, port and temperature sensor as an entity.  Those
+are left out unless they have a serial number, which is how transceivers
+show up on most switches.  It returns an error if the switch didn't answer,
+a switch without ENTITY-MIB isn't one.
+*/
+func collectSNMPInventory(server string, creds string, sw string) error {
+	m := map[string]map[string]string{}
+	if err := walkColumns(server, creds, entityWork, m); err != nil {
+		return err
+	}
+
+	items := []InventoryItem{}
+	for index, v := range m {
+		class := entityClasses[v["class"]]
+		if v["serial"] == "" && (class == "container" || class == "sensor" || class == "port" || class == "backplane") {
+			continue
+		}
+		containedIn := v["containedIn"]
+		if containedIn == "0" {
+			containedIn = ""
+		}
+		items = append(items, InventoryItem{
+			Index:       index,
+			ContainedIn: containedIn,
+			Class:       class,
+			Name:        v["name"],
+			Description: v["descr"],
+			Vendor:      v["mfgName"],
+			PartNumber:  v["modelName"],
+			Serial:      strings.TrimSpace(v["serial"]),
+			HardwareRev: v["hardwareRev"],
+			FirmwareRev: v["firmwareRev"],
+			SoftwareRev: v["softwareRev"],
+			FRU:         v["isFRU"] == "1",
+		})
+	}
+	if len(items) == 0 {
+		return nil
+	}
+	sendUpstream(InventoryReport{Switch: sw, TimeStamp: time.Now().Unix(), Items: items})
+	return nil
+}
+
+// turn the output of show inventory into inventory items.  NX-OS doesn't
+// say what class a part is so we go by its name.
+func nxapiInventory(inv []nxapi.InventoryItem) []InventoryItem {
+	items := []InventoryItem{}
+	for _, i := range inv {
+		items = append(items, InventoryItem{
+			Class:       nxapiInventoryClass(i.Name),
+			Name:        i.Name,
+			Description: i.Desc,
+			Vendor:      "Cisco",
+			PartNumber:  i.Productid,
+			Serial:      i.Serialnum,
+			HardwareRev: i.Vendorid,
+		})
+	}
+	return items
+}
+
+func nxapiInventoryClass(name string) string {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasPrefix(name, "chassis"):
+		return "chassis"
+	case strings.HasPrefix(name, "slot"), strings.HasPrefix(name, "module"):
+		return "module"
+	case strings.HasPrefix(name, "power supply"):
+		return "powerSupply"
+	case strings.HasPrefix(name, "fan"):
+		return "fan"
+	case strings.HasPrefix(name, "eth"):
+		return "port"
+	}
+	return "other"
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInventorySchedule(t *testing.T) {
+	old := inventoryInterval
+	defer func() { inventoryInterval = old }()
+	inventoryInterval = time.Hour
+
+	s := newInventorySchedule()
+	now := time.Now()
+	if !s.due("leaf1", now) || !s.due("leaf2", now) {
+		t.Fatal("new devices not due")
+	}
+	s.collected("leaf1", now)
+	// leaf2 failed so it's still due next poll.
+	now = now.Add(time.Minute)
+	if s.due("leaf1", now) {
+		t.Error("leaf1 due a minute after its inventory")
+	}
+	if !s.due("leaf2", now) {
+		t.Error("leaf2 not due after failing")
+	}
+	if !s.due("leaf1", now.Add(time.Hour)) {
+		t.Error("leaf1 not due an interval later")
+	}
+}
@@ -13,12 +13,9 @@ then pipes the output up to sitckypipe in a JSON based string:
 package main
 
 import (
-	"bytes"
-	"encoding/json"
+	"context"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
 	"os/signal"
 	"strings"
@@ -40,18 +37,11 @@ func handleError(err error) {
 /* Get NXAPI information
 Arguments:
  server - Nexus Switch (10.93.234.2, sw001, or something reachable)
- creds - user/password pair that looks like admin:cisco (notice no :'s are supported in the password.)
+ creds - user/password pair that looks like admin:cisco
  map - map we want to store this stuff.
 */
 
 func getNXAPIData(server string, command string, outputName string, creds string, m map[string]interface{}) {
-	// argument for string looks like: admin:cisco where admin is the user and cisco is the password.
-	up := strings.Split(creds, ":")
-	// make sure that we parsed the username and password.
-	if len(up) < 2 {
-		log.Fatal("Credentials must be of form user:password")
-		return
-	}
 	// The command we run to get the port interface statistics.
 	/*
 		nxcmd := NewNXAPIPost(command)
@@ -70,70 +60,182 @@ func getNXAPIData(server string, command string, outputName string, creds string
 					}
 						`)
 	// Start formatting our HTTP POST request.
-	req, err := http.NewRequest("POST", "http://"+server+"/ins", bytes.NewBuffer(jsonStr))
+	req, err := newJSONRequest("POST", "http://"+server+"/ins", jsonStr, creds)
 	if err != nil {
 		log.Println("HTTP Post: ", err)
+		return
 	}
-	// The header has to be set to application/json
-	req.Header.Set("content-type", "application/json")
-	// add the username and password to the header.
-	req.SetBasicAuth(up[0], up[1])
-
-	// create a new http client to execute the request.
-	client := &http.Client{}
-	// execute the request.
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Fatal("response error: ", err)
-	}
-	defer resp.Body.Close()
-
-	//fmt.Println("response Status: ", resp.Status)
-	//fmt.Println("response Headers: ", resp.Header)
-	body, err := ioutil.ReadAll(resp.Body)
-	//fmt.Println("responseBody:", string(body))
 	var rr nxapi.NXAPI_Response
-	//var rr interface{}
-	err = json.Unmarshal(body, &rr)
-	if err != nil {
-		log.Fatal("Error unmarshalling: ", err)
+	if err := doJSON(req, &rr); err != nil {
+		log.Println(server, err)
+		return
 	}
 	// Print out the raw string to debug.
 	for _, b := range rr.Ins_api.Outputs {
 		// process show version
 		if b.Input == "show version" {
-			h, ok := b.Body["host_name"].(string)
-			if !ok {
+			v, err := nxapi.NewVersion(b.Body)
+			if err != nil {
+				log.Println(server, err)
+			}
+			if v.Host_Name == "" {
 				continue
-			} else {
-				mutex.Lock()
-				{
-					if m[server] != nil {
-						p := m[server].(map[string]interface{})
-						p["hostname"] = h
-					} else {
-						m[server] = map[string]interface{}{"hostname": h}
-					}
-				}
-				mutex.Unlock()
 			}
+			storeNXAPIData(server, "Version", v, m)
 
 			// process show interface counters
 		} else if b.Input == "show interface counters" {
-			mutex.Lock()
-			{
-				if m[server] != nil {
-					p := m[server].(map[string]interface{})
-					p["InterfaceCounters"] = nxapi.NewInterfaceCounters(b.Body)
-				} else {
-					m[server] = map[string]interface{}{"InterfaceCounters": nxapi.NewInterfaceCounters(b.Body)}
-				}
+			ic, err := nxapi.NewInterfaceCounters(b.Body)
+			if err != nil {
+				// we still got most of the counters so keep going.
+				log.Println(server, err)
 			}
-			mutex.Unlock()
+			storeNXAPIData(server, "InterfaceCounters", ic, m)
+
+			// process show interface
+		} else if b.Input == "show interface" {
+			ifaces, err := nxapi.NewInterfaces(b.Body)
+			if err != nil {
+				log.Println(server, err)
+			}
+			storeNXAPIData(server, "Interfaces", ifaces, m)
+
+			// process show lldp neighbors detail
+		} else if b.Input == "show lldp neighbors detail" {
+			n, err := nxapi.NewLLDPNeighbors(b.Body)
+			if err != nil {
+				log.Println(server, err)
+			}
+			storeNXAPIData(server, "LLDPNeighbors", n, m)
+
+			// process show cdp neighbors detail
+		} else if b.Input == "show cdp neighbors detail" {
+			n, err := nxapi.NewCDPNeighbors(b.Body)
+			if err != nil {
+				log.Println(server, err)
+			}
+			storeNXAPIData(server, "CDPNeighbors", n, m)
+
+			// process show inventory
+		} else if b.Input == "show inventory" {
+			inv, err := nxapi.NewInventory(b.Body)
+			if err != nil {
+				log.Println(server, err)
+			}
+			storeNXAPIData(server, "Inventory", inv, m)
+
+			// process show system resources
+		} else if b.Input == "show system resources" {
+			r, err := nxapi.NewSystemResources(b.Body)
+			if err != nil {
+				log.Println(server, err)
+			}
+			storeNXAPIData(server, "SystemResources", r, m)
+
+			// process show environment
+		} else if b.Input == "show environment" {
+			env, err := nxapi.NewEnvironment(b.Body)
+			if err != nil {
+				log.Println(server, err)
+			}
+			storeNXAPIData(server, "Environment", env, m)
+
+			// process show interface transceiver details
+		} else if b.Input == "show interface transceiver details" {
+			t, err := nxapi.NewTransceivers(b.Body)
+			if err != nil {
+				log.Println(server, err)
+			}
+			storeNXAPIData(server, "Transceivers", t, m)
+
+			// process show ip bgp summary
+		} else if b.Input == "show ip bgp summary" {
+			bgp, err := nxapi.NewBGPSummary(b.Body)
+			if err != nil {
+				log.Println(server, err)
+			}
+			storeNXAPIData(server, "BGPSummary", bgp, m)
+
+			// process show ip ospf neighbors
+		} else if b.Input == "show ip ospf neighbors" {
+			ospf, err := nxapi.NewOSPFNeighbors(b.Body)
+			if err != nil {
+				log.Println(server, err)
+			}
+			storeNXAPIData(server, "OSPFNeighbors", ospf, m)
+
+			// process show port-channel summary
+		} else if b.Input == "show port-channel summary" {
+			pc, err := nxapi.NewPortChannels(b.Body)
+			if err != nil {
+				log.Println(server, err)
+			}
+			storeNXAPIData(server, "PortChannels", pc, m)
+
+			// process show vpc brief
+		} else if b.Input == "show vpc brief" {
+			vpc, err := nxapi.NewVPCBrief(b.Body)
+			if err != nil {
+				log.Println(server, err)
+			}
+			storeNXAPIData(server, "VPC", vpc, m)
+
+			// process show vlan brief
+		} else if b.Input == "show vlan brief" {
+			vlans, err := nxapi.NewVLANs(b.Body)
+			if err != nil {
+				log.Println(server, err)
+			}
+			storeNXAPIData(server, "VLANs", vlans, m)
+
+			// process show mac address-table
+		} else if b.Input == "show mac address-table" {
+			macs, err := nxapi.NewMACAddresses(b.Body)
+			if err != nil {
+				log.Println(server, err)
+			}
+			storeNXAPIData(server, "MACAddresses", macs, m)
+
+			// process show mac address-table count
+		} else if b.Input == "show mac address-table count" {
+			c, err := nxapi.NewMACCount(b.Body)
+			if err != nil {
+				log.Println(server, err)
+			}
+			storeNXAPIData(server, "MACCount", c, m)
+
+			// process show queuing interface
+		} else if b.Input == "show queuing interface" {
+			q, err := nxapi.NewQueuingInterfaces(b.Body)
+			if err != nil {
+				log.Println(server, err)
+			}
+			storeNXAPIData(server, "Queuing", q, m)
+
+			// process show interface snmp-ifindex
+		} else if b.Input == "show interface snmp-ifindex" {
+			idx, err := nxapi.NewSNMPIfIndexes(b.Body)
+			if err != nil {
+				log.Println(server, err)
+			}
+			storeNXAPIData(server, "IfIndexes", idx, m)
 		}
 	}
 }
 
+// storeNXAPIData puts what one command returned in the switch's map.  The
+// commands run at the same time so this has to hold the lock.
+func storeNXAPIData(server string, name string, v interface{}, m map[string]interface{}) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	if m[server] != nil {
+		p := m[server].(map[string]interface{})
+		p[name] = v
+	} else {
+		m[server] = map[string]interface{}{name: v}
+	}
+}
+
 /* walkvalues:
  Arguments:
 	server - like a switch (10.93.234.2, or c2960-001, or something like that. )
@@ -156,19 +258,7 @@ func walkValue(server string, creds string, oid string, key string, m map[string
 		for _, pdu := range resp {
 			oidbits := strings.Split(pdu.Name, ".")
 			ifIndex := oidbits[len(oidbits)-1]
-			value := ""
-			switch pdu.Type {
-			case gosnmp.OctetString:
-				value = pdu.Value.(string)
-			case gosnmp.Counter32:
-				value = fmt.Sprintf("%d", pdu.Value.(int))
-			case gosnmp.Counter64:
-				value = fmt.Sprintf("%d", pdu.Value.(int64))
-			case gosnmp.Gauge32:
-				value = fmt.Sprintf("%d", pdu.Value.(int))
-			default:
-				value = "decode this"
-			}
+			value := pduValue(pdu)
 			//fmt.Printf("%s / %s\n", key, value)
 			mutex.Lock()
 			{
@@ -185,66 +275,321 @@ func walkValue(server string, creds string, oid string, key string, m map[string
 
 }
 
+// walkTable walks one column of an SNMP table and stores its values by row.
+// Unlike walkValue the row is the whole index after the column, tables like
+// lldpRemTable have more than one number in theirs.
+func walkTable(server string, creds string, oid string, key string, m map[string]map[string]string) error {
+	s, err := gosnmp.NewGoSNMP(server, creds, gosnmp.Version2c, 5)
+	if err != nil {
+		handleError(err)
+		return err
+	}
+	defer s.Close()
+
+	resp, err := s.Walk(oid)
+	if err != nil {
+		handleError(err)
+		return err
+	}
+	column := strings.TrimPrefix(oid, ".") + "."
+	for _, pdu := range resp {
+		name := strings.TrimPrefix(pdu.Name, ".")
+		if !strings.HasPrefix(name, column) {
+			continue
+		}
+		row := name[len(column):]
+		value := pduValue(pdu)
+		mutex.Lock()
+		if m[row] != nil {
+			m[row][key] = value
+		} else {
+			m[row] = map[string]string{key: value}
+		}
+		mutex.Unlock()
+	}
+	return nil
+}
+
+// walkColumns walks the columns in work at the same time with walkTable.
+// It returns an error if any of the walks failed.
+func walkColumns(server string, creds string, work map[string]string, m map[string]map[string]string) error {
+	var wg sync.WaitGroup
+	errs := make(chan error, len(work))
+	wg.Add(len(work))
+	for oid, name := range work {
+		go func(o string, n string) {
+			defer wg.Done()
+			if err := walkTable(server, creds, o, n, m); err != nil {
+				errs <- err
+			}
+		}(oid, name)
+	}
+	wg.Wait()
+	close(errs)
+	return <-errs
+}
+
+// pduValue turns a value gosnmp decoded into the string we store.  Walks
+// and traps both go through here.
+func pduValue(pdu gosnmp.SnmpPDU) string {
+	value := ""
+	switch pdu.Type {
+	case gosnmp.OctetString:
+		value = pdu.Value.(string)
+	case gosnmp.Integer:
+		value = fmt.Sprintf("%d", pdu.Value.(int))
+	case gosnmp.Counter32:
+		value = fmt.Sprintf("%d", pdu.Value.(int))
+	case gosnmp.Counter64:
+		value = fmt.Sprintf("%d", pdu.Value.(int64))
+	case gosnmp.Gauge32:
+		value = fmt.Sprintf("%d", pdu.Value.(int))
+	case gosnmp.TimeTicks:
+		value = fmt.Sprintf("%d", pdu.Value.(int))
+	case gosnmp.ObjectIdentifier, gosnmp.IpAddress:
+		value = fmt.Sprintf("%v", pdu.Value)
+	default:
+		value = "decode this"
+	}
+	return value
+}
+
 func main() {
-	// We require each program to have endpoints defined.
+	// We require each program to have endpoints defined, or somewhere to
+	// discover them.
 	var params struct {
-		Endpoints   string `env:"SP_ENDPOINTS,required"`
-		Credentials string `env:"SP_ENDPOINT_CREDENTIALS,required"`
+		Endpoints   string `env:"SP_ENDPOINTS"`
+		Credentials string `env:"SP_ENDPOINT_CREDENTIALS"`
+		// switches usually have self signed certificates.
+		TLSInsecure bool   `env:"SP_TLS_INSECURE,default=false"`
+		TLSCA       string `env:"SP_TLS_CA"`
+		// for the SSH method
+		SSHPort       int    `env:"SP_SSH_PORT,default=22"`
+		SSHKey        string `env:"SP_SSH_KEY"`
+		SSHKnownHosts string `env:"SP_SSH_KNOWN_HOSTS"`
+		SSHInsecure   bool   `env:"SP_SSH_INSECURE,default=false"`
+		NetconfPort   int    `env:"SP_NETCONF_PORT,default=830"`
+		// for the RESTCONF method
+		RestconfPageSize int `env:"SP_RESTCONF_PAGE_SIZE,default=100"`
+		// for the GNMI method
+		GNMIPort           int           `env:"SP_GNMI_PORT,default=57400"`
+		GNMIPlaintext      bool          `env:"SP_GNMI_PLAINTEXT,default=false"`
+		GNMISampleInterval time.Duration `env:"SP_GNMI_SAMPLE_INTERVAL,default=10s"`
+		// the trap receiver only runs if we're given somewhere to listen.
+		TrapListen      string `env:"SP_TRAP_LISTEN"`
+		TrapCommunities string `env:"SP_TRAP_COMMUNITIES"`
+		TrapUsers       string `env:"SP_TRAP_USERS"`
+		TrapEngineID    string `env:"SP_TRAP_ENGINE_ID"`
+		// flow receivers, also only if there is somewhere to listen.
+		SFlowListen   string        `env:"SP_SFLOW_LISTEN"`
+		NetFlowListen string        `env:"SP_NETFLOW_LISTEN"`
+		FlowInterval  time.Duration `env:"SP_FLOW_INTERVAL,default=60s"`
+		FlowTopN      int           `env:"SP_FLOW_TOP,default=10"`
+		// hardware doesn't change often.
+		InventoryInterval time.Duration `env:"SP_INVENTORY_INTERVAL,default=1h"`
+		// discovery sweeps these networks for switches to poll.
+		DiscoverNetworks    string        `env:"SP_DISCOVER_NETWORKS"`
+		DiscoverCommunities string        `env:"SP_DISCOVER_COMMUNITIES"`
+		DiscoverCredentials string        `env:"SP_DISCOVER_CREDENTIALS"`
+		DiscoverRate        int           `env:"SP_DISCOVER_RATE,default=10"`
+		DiscoverInterval    time.Duration `env:"SP_DISCOVER_INTERVAL,default=24h"`
+		DiscoverPrint       bool          `env:"SP_DISCOVER_PRINT,default=false"`
+		// follow LLDP and CDP neighbors to find more.
+		CrawlNeighbors bool   `env:"SP_CRAWL_NEIGHBORS,default=false"`
+		CrawlAllow     string `env:"SP_CRAWL_ALLOW"`
+		CrawlDeny      string `env:"SP_CRAWL_DENY"`
+		// where what discovery found is kept across restarts.
+		DeviceFile string `env:"SP_DEVICE_FILE"`
+		// more sysObjectID fingerprints.
+		FingerprintFile string `env:"SP_FINGERPRINT_FILE"`
+		// where the interfaces of each switch are kept across restarts.
+		InterfaceFile string `env:"SP_INTERFACE_FILE"`
 	}
 
 	if err := envdecode.Decode(&params); err != nil {
 		log.Fatalln(err)
 	}
+	if err := setupHTTPClient(params.TLSInsecure, params.TLSCA); err != nil {
+		log.Fatalln(err)
+	}
+	sshSettings.Port = params.SSHPort
+	sshSettings.KeyFile = params.SSHKey
+	sshSettings.KnownHosts = params.SSHKnownHosts
+	sshSettings.Insecure = params.SSHInsecure
+	if params.SSHInsecure && params.SSHKnownHosts == "" {
+		log.Println("WARNING: SP_SSH_INSECURE is set, SSH and NETCONF host keys are not checked")
+	}
+	sshSettings.NetconfPort = params.NetconfPort
+	restconfPageSize = params.RestconfPageSize
+	gnmiSettings.Port = params.GNMIPort
+	gnmiSettings.Plaintext = params.GNMIPlaintext
+	gnmiSettings.SampleInterval = params.GNMISampleInterval
+	flowSettings.Interval = params.FlowInterval
+	flowSettings.TopN = params.FlowTopN
+	inventoryInterval = params.InventoryInterval
+
+	if params.FingerprintFile != "" {
+		if err := loadFingerprints(params.FingerprintFile); err != nil {
+			log.Fatalln(params.FingerprintFile, err)
+		}
+	}
+
+	if params.InterfaceFile != "" {
+		if err := loadIdentities(params.InterfaceFile); err != nil {
+			log.Fatalln(params.InterfaceFile, err)
+		}
+	}
+
+	networks, err := parseNetworks(params.DiscoverNetworks)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	discoverySettings.Networks = networks
+	discoverySettings.Communities = splitList(params.DiscoverCommunities)
+	discoverySettings.Credentials = splitList(params.DiscoverCredentials)
+	discoverySettings.Rate = params.DiscoverRate
+	discoverySettings.Interval = params.DiscoverInterval
+	if params.DiscoverPrint {
+		if len(networks) == 0 {
+			log.Fatal("SP_DISCOVER_PRINT needs SP_DISCOVER_NETWORKS")
+		}
+		printDiscoveredConfig(context.Background())
+		return
+	}
 
-	endpoints := strings.Split(params.Endpoints, ",")
-	creds := strings.Split(params.Credentials, ",")
+	endpoints := splitList(params.Endpoints)
+	creds := splitList(params.Credentials)
 	if len(endpoints) != len(creds) {
 		log.Fatal("Each endpoint should have a corresponding credential")
 	}
+	devices := newEndpointList(endpoints, creds)
+	if params.DeviceFile != "" {
+		if err := devices.load(params.DeviceFile); err != nil {
+			log.Fatalln(params.DeviceFile, err)
+		}
+	}
+	if known, _ := devices.list(); len(known) == 0 && len(networks) == 0 {
+		log.Fatal("please export SP_ENDPOINTS or SP_DISCOVER_NETWORKS")
+	}
+	if params.CrawlNeighbors {
+		if len(discoverySettings.Communities) == 0 && len(discoverySettings.Credentials) == 0 {
+			log.Fatal("SP_CRAWL_NEIGHBORS needs SP_DISCOVER_COMMUNITIES or SP_DISCOVER_CREDENTIALS")
+		}
+		if crawlSettings.Allow, err = parseCIDRs(params.CrawlAllow); err != nil {
+			log.Fatalln(err)
+		}
+		if crawlSettings.Deny, err = parseCIDRs(params.CrawlDeny); err != nil {
+			log.Fatalln(err)
+		}
+		crawler = newNeighborCrawler(devices)
+	}
 
 	// All the OIDs we'll snmp walk through to get
 	oidWork := map[string]string{
 		".1.3.6.1.2.1.1.5":         "sysName",
 		".1.3.6.1.2.1.2.2.1.2":     "name",
+		".1.3.6.1.2.1.2.2.1.4":     "ifMtu",
+		".1.3.6.1.2.1.2.2.1.7":     "ifAdminStatus",
+		".1.3.6.1.2.1.2.2.1.8":     "ifOperStatus",
 		".1.3.6.1.2.1.2.2.1.10":    "ifInOctets",
+		".1.3.6.1.2.1.2.2.1.13":    "ifInDiscards",
+		".1.3.6.1.2.1.2.2.1.14":    "ifInErrors",
 		".1.3.6.1.2.1.2.2.1.16":    "ifOutOctets",
+		".1.3.6.1.2.1.2.2.1.19":    "ifOutDiscards",
+		".1.3.6.1.2.1.2.2.1.20":    "ifOutErrors",
+		".1.3.6.1.2.1.31.1.1.1.1":  "ifName",
 		".1.3.6.1.2.1.31.1.1.1.6":  "ifHCInOctets",
 		".1.3.6.1.2.1.31.1.1.1.10": "ifHCOutOctets",
 		".1.3.6.1.2.1.31.1.1.1.15": "ifHighSpeed",
+		".1.3.6.1.2.1.31.1.1.1.18": "ifAlias",
 	}
 
 	// all the commands we walk through NXAPI to get.
 	nxapiWork := map[string]string{
-		"show version":            "version",
-		"show interface counters": "counters",
+		"show version":                       "version",
+		"show interface counters":            "counters",
+		"show interface":                     "interface",
+		"show lldp neighbors detail":         "lldp",
+		"show cdp neighbors detail":          "cdp",
+		"show system resources":              "resources",
+		"show environment":                   "environment",
+		"show interface transceiver details": "transceivers",
+		"show ip bgp summary":                "bgp",
+		"show ip ospf neighbors":             "ospf",
+		"show port-channel summary":          "portchannel",
+		"show vpc brief":                     "vpc",
+		"show vlan brief":                    "vlan",
+		"show mac address-table count":       "maccount",
+		"show queuing interface":             "queuing",
+		"show interface snmp-ifindex":        "ifindex",
 	}
 
 	// The main waitgroup for each switch waits for
 	// each switch to finish its job.
 	var mainWg sync.WaitGroup
-	// The array of waitgroups are the jobs that each
-	// switch must proccess.
-	wg := make([]sync.WaitGroup, len(endpoints))
-
 	// we will run in a continuous loop forever!
 	// or at least until the user hits ctrl-c or we get a signal interrupt.
 	stop := false
 	signalChan := make(chan os.Signal, 1)
 	interruptChan := make(chan struct{}, 1)
+	// streaming collectors run until this is cancelled.
+	ctx, cancel := context.WithCancel(context.Background())
 	go func() {
 		<-signalChan
 		stop = true
 		log.Println("Cleaning up...")
+		cancel()
 		// send stuff to the channel so that it closes.  That way we don't have to wait so long.
 		interruptChan <- struct{}{}
 	}()
 	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGTERM)
 
+	// traps and flows only tell us the address they came from.
+	var addresses map[string]string
+	if params.TrapListen != "" || params.SFlowListen != "" || params.NetFlowListen != "" {
+		addresses = endpointAddresses(endpoints)
+	}
+	if params.TrapListen != "" {
+		r, err := newTrapReceiver(params.TrapCommunities, params.TrapUsers, params.TrapEngineID)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		go receiveTraps(ctx, params.TrapListen, r, addresses)
+	}
+	if params.SFlowListen != "" || params.NetFlowListen != "" {
+		flows := newFlowTable()
+		go sendFlows(ctx, flows)
+		if params.SFlowListen != "" {
+			go receiveSFlow(ctx, params.SFlowListen, addresses, flows)
+		}
+		if params.NetFlowListen != "" {
+			go receiveNetFlow(ctx, params.NetFlowListen, addresses, flows)
+		}
+	}
+
+	if len(networks) > 0 {
+		go discover(ctx, devices)
+	}
+	if crawler != nil {
+		go crawler.run(ctx)
+	}
+
+	// inventory is collected from each device the first time around and
+	// then every inventoryInterval.
+	inventories := newInventorySchedule()
+	// gNMI switches stream to us so they get started the first time we see
+	// them, not every time around the loop.
+	streaming := map[string]bool{}
 	for {
 
 		if stop {
 			break
 		}
+		// discovery may have added switches since last time.
+		endpoints, creds := devices.list()
+		// The array of waitgroups are the jobs that each
+		// switch must proccess.
+		wg := make([]sync.WaitGroup, len(endpoints))
 		// make sure we wait for each of the switches
 		mainWg.Add(len(endpoints))
 
@@ -254,7 +599,7 @@ func main() {
 			em := strings.Split(endpoint, ":")
 			if len(em) < 2 {
 				fmt.Println("Invalid input: ", endpoint)
-				fmt.Println("please export SP_ENDPOINTS=<name>:<method> where method is SNMP or NXAPI")
+				fmt.Println("please export SP_ENDPOINTS=<name>:<method> where method is SNMP, NXAPI, NXAPI-REST, EAPI, SSH, NETCONF, RESTCONF, GNMI or AUTO")
 				// don't wait for me any more.
 				mainWg.Add(-1)
 				// go to the next switch
@@ -268,9 +613,12 @@ func main() {
 			}
 			*/
 			m := make(map[string]map[string]map[string]string)
-			if em[1] == "SNMP" {
-				go func(e string, c string, w sync.WaitGroup) {
+			switch em[1] {
+			case "SNMP":
+				go func(e string, c string, w *sync.WaitGroup) {
 					defer mainWg.Done()
+					// walkValue fills in the rows of this switch.
+					m[e] = map[string]map[string]string{}
 					// mapping hash table for interface names.
 					w.Add(len(oidWork))
 					// concurrently execute all of the snmp walks
@@ -281,24 +629,50 @@ func main() {
 						}(oid, name)
 					}
 					w.Wait()
-					processCollectedSNMPData(m[e])
-				}(em[0], creds[i], wg[i])
-			} else if em[1] == "NXAPI" {
+					processCollectedSNMPData(e, m[e])
+					// what else we collect depends on what the device is.
+					profile := identifySNMP(e, c).profile()
+					collectSNMPHealth(e, c, m[e]["0"]["sysName"], profile.health)
+					for _, collect := range profile.collectors {
+						collect(e, c, m[e]["0"]["sysName"])
+					}
+					if inventories.due(e, time.Now()) {
+						if err := collectSNMPInventory(e, c, m[e]["0"]["sysName"]); err != nil {
+							log.Println(e, "inventory:", err)
+						} else {
+							for _, collect := range profile.inventory {
+								collect(e, c, m[e]["0"]["sysName"])
+							}
+							inventories.collected(e, time.Now())
+						}
+					}
+				}(em[0], creds[i], &wg[i])
+			case "NXAPI":
 				// Yes.. this is hard to process, so let's walk through this.
 				// If this switch is an NXAPI endpoint, we are going to kick off a goroutine
 				// This go routine is going to call several commands against the switch.
-				go func(e string, cre string, w sync.WaitGroup) {
+				go func(e string, cre string, w *sync.WaitGroup) {
 					// When we finish processing all the commands against this switch, tell the main workGroup we are done.
 					defer mainWg.Done()
 
 					nxapiHash := map[string]interface{}{}
+					work := nxapiWork
+					inventory := inventories.due(e, time.Now())
+					// the whole MAC address table is as slow to fetch as
+					// the inventory and changes as little.
+					if inventory {
+						work = map[string]string{"show inventory": "inventory", "show mac address-table": "mac"}
+						for cmd, name := range nxapiWork {
+							work[cmd] = name
+						}
+					}
 					// we need to add a waitgroup for this task.
 					// This waitgroup is specific for this switch.
 					// We dont' want to wait for all the other switches to finish processing before
 					// sending the data to the cloud
-					w.Add(len(nxapiWork))
+					w.Add(len(work))
 					// Go through each command that we want to process.
-					for cmd, name := range nxapiWork {
+					for cmd, name := range work {
 						// kick off a go routine for each of the commands we want to get
 						go func(c string, outputName string) {
 							// make sure we decrement the switch waitgroup.
@@ -312,7 +686,59 @@ func main() {
 					// wait for all the switch waitgroups to finish.
 					// now we have all the data for this switch, let's process it.
 					processCollectedNXAPIData(e, nxapiHash)
-				}(em[0], creds[i], wg[i])
+					if inventory {
+						data, _ := nxapiHash[e].(map[string]interface{})
+						if inv, ok := data["Inventory"].([]nxapi.InventoryItem); ok && len(inv) > 0 {
+							inventories.collected(e, time.Now())
+						}
+					}
+				}(em[0], creds[i], &wg[i])
+			case "NXAPI-REST":
+				go func(e string, cre string) {
+					defer mainWg.Done()
+					collectNXAPIREST(e, cre)
+				}(em[0], creds[i])
+			case "EAPI":
+				go func(e string, cre string) {
+					defer mainWg.Done()
+					collectEAPI(e, cre)
+				}(em[0], creds[i])
+			case "SSH":
+				go func(e string, cre string) {
+					defer mainWg.Done()
+					collectSSH(e, cre)
+				}(em[0], creds[i])
+			case "NETCONF":
+				go func(e string, cre string) {
+					defer mainWg.Done()
+					collectNETCONF(e, cre)
+				}(em[0], creds[i])
+			case "RESTCONF":
+				go func(e string, cre string) {
+					defer mainWg.Done()
+					collectRESTCONF(e, cre)
+				}(em[0], creds[i])
+			case "GNMI":
+				if !streaming[endpoint] {
+					streaming[endpoint] = true
+					go collectGNMI(ctx, em[0], creds[i])
+				}
+				mainWg.Add(-1)
+			case "AUTO":
+				// find out what it is, it gets polled from next time.
+				go func(endpoint string, e string, cre string) {
+					defer mainWg.Done()
+					p, ok := resolveAuto(e, cre)
+					if !ok {
+						log.Println(e, "didn't answer SNMP or NXAPI")
+						return
+					}
+					log.Println(e, "polling with", p.method)
+					devices.resolve(endpoint, savedEndpoint{Endpoint: p.endpoint(), Credential: p.cred})
+				}(endpoint, em[0], creds[i])
+			default:
+				fmt.Println("Unknown method: ", em[1])
+				mainWg.Add(-1)
 			}
 		}
 		// wait for all the snmpwalks to finish.
@@ -339,74 +765,138 @@ func main() {
 // process NXAPI data
 func processCollectedNXAPIData(sw string, completeMap map[string]interface{}) {
 	fmt.Println("processing switch: ", sw)
-	swi := ""
-	counterData := []string{}
-	for k, v := range completeMap[sw].(map[string]interface{}) {
-		fmt.Println("k: ", k)
-		switch v.(type) {
-		case string:
-			swi = v.(string)
-		case nxapi.InterfaceCounters:
-			ifaceCs := v.(nxapi.InterfaceCounters)
-			rx := ifaceCs.RX_Table.Row
-			tx := ifaceCs.TX_Table.Row
-			for port, _ := range rx {
-				sendMe := fmt.Sprintf("'iface':'%s', 'inpkts':'%f', 'inbytes':'%f','inucast':'%f','inmcast':'%f', 'inbcast': '%f','outpkts': '%f', 'outbytes':'%f', 'outucast':'%f', 'outmcast':'%f', 'outbcast':'%f'",
-					port,
-					rx[port].Eth_inpkts,
-					rx[port].Eth_inbytes,
-					rx[port].Eth_inucast,
-					rx[port].Eth_inmcast,
-					rx[port].Eth_inbcast,
-					tx[port].Eth_outpkts,
-					tx[port].Eth_outbytes,
-					tx[port].Eth_outucast,
-					tx[port].Eth_outmcast,
-					tx[port].Eth_outbcast,
-				)
-				counterData = append(counterData, sendMe)
-			}
+	swi := sw
+	now := time.Now().Unix()
+	data, ok := completeMap[sw].(map[string]interface{})
+	if !ok {
+		log.Println("no data collected from ", sw)
+		return
+	}
+	// get the name of the switch first so every sample carries it.
+	if ver, ok := data["Version"].(nxapi.Version); ok {
+		swi = ver.Host_Name
+		sendUpstream(DeviceReport{
+			Switch:    swi,
+			TimeStamp: now,
+			Device:    nxapiDeviceInfo(ver),
+		})
+	}
 
-		default:
-			fmt.Println("don't know what this is")
+	// show interface counters and show interface both report per interface
+	// so we join them on the interface name.
+	samples := newSampleSet(swi, now)
+	if ifaceCs, ok := data["InterfaceCounters"].(nxapi.InterfaceCounters); ok {
+		for _, c := range ifaceCs.Merged() {
+			s := samples.get(c.Interface)
+			s.IfHCInOctets = c.Eth_inbytes
+			s.InPkts = c.Eth_inpkts
+			s.InUcastPkts = c.Eth_inucast
+			s.InMulticastPkts = c.Eth_inmcast
+			s.InBroadcastPkts = c.Eth_inbcast
+			s.IfHCOutOctets = c.Eth_outbytes
+			s.OutPkts = c.Eth_outpkts
+			s.OutUcastPkts = c.Eth_outucast
+			s.OutMulticastPkts = c.Eth_outmcast
+			s.OutBroadcastPkts = c.Eth_outbcast
+		}
+	}
+	if ifaces, ok := data["Interfaces"].([]nxapi.Interface); ok {
+		for _, i := range ifaces {
+			samples.get(i.Interface).addNXAPIInterface(i)
+		}
+	}
+	if pc, ok := data["PortChannels"].([]nxapi.PortChannel); ok {
+		var vpc *nxapi.VPCBrief
+		// switches without feature vpc answer with nothing.
+		if v, ok := data["VPC"].(nxapi.VPCBrief); ok && v.Vpc_Domain_Id != "" {
+			vpc = &v
+		}
+		samples.annotateBundles(pc, vpc)
+	}
+	ifIndexes := map[string]string{}
+	if idx, ok := data["IfIndexes"].([]nxapi.SNMPIfIndex); ok {
+		for _, i := range idx {
+			ifIndexes[interfaceKey(i.Interface)] = i.Snmp_Ifindex
 		}
 	}
-	// now that we're done, make all the turn this into JSON and send the string.
-	fmt.Printf("{ %s: { %s }}", sw, strings.Join(counterData, "},{"))
+	identifyNXAPIInterfaces(sw, swi, samples.order, ifIndexes)
+	sendUpstream(map[string][]InterfaceSample{swi: samples.list()})
+
+	var res *nxapi.SystemResources
+	if r, ok := data["SystemResources"].(nxapi.SystemResources); ok {
+		res = &r
+	}
+	var env *nxapi.Environment
+	if e, ok := data["Environment"].(nxapi.Environment); ok {
+		env = &e
+	}
+	if res != nil || env != nil {
+		sendHealth(nxapiHealth(swi, now, res, env))
+	}
+
+	if t, ok := data["Transceivers"].([]nxapi.Transceiver); ok {
+		if samples := nxapiTransceivers(t); len(samples) > 0 {
+			sendUpstream(TransceiverReport{Switch: swi, TimeStamp: now, Transceivers: samples})
+		}
+	}
+
+	bgp, _ := data["BGPSummary"].([]nxapi.BGPVrf)
+	ospf, _ := data["OSPFNeighbors"].([]nxapi.OSPFInstance)
+	sendRouting(sw, RoutingReport{Switch: swi, TimeStamp: now, Peers: nxapiRoutingPeers(bgp, ospf)})
+
+	vlans, _ := data["VLANs"].([]nxapi.VLAN)
+	macs, _ := data["MACAddresses"].([]nxapi.MACAddress)
+	var count *nxapi.MACCount
+	if c, ok := data["MACCount"].(nxapi.MACCount); ok {
+		count = &c
+	}
+	if len(vlans) > 0 || len(macs) > 0 {
+		sendUpstream(nxapiVLANs(swi, now, vlans, macs, count))
+	}
+	if len(macs) > 0 {
+		sendUpstream(nxapiPortMACs(swi, now, macs))
+	}
+
+	if q, ok := data["Queuing"].([]nxapi.QueuingInterface); ok {
+		if interfaces := nxapiQueues(q); len(interfaces) > 0 {
+			sendUpstream(QueueReport{Switch: swi, TimeStamp: now, Interfaces: interfaces})
+		}
+	}
+
+	lldp, _ := data["LLDPNeighbors"].([]nxapi.LLDPNeighbor)
+	cdp, _ := data["CDPNeighbors"].([]nxapi.CDPNeighbor)
+	sendNeighbors(NeighborReport{Switch: swi, TimeStamp: now, Neighbors: nxapiNeighbors(lldp, cdp)})
+	if inv, ok := data["Inventory"].([]nxapi.InventoryItem); ok && len(inv) > 0 {
+		sendUpstream(InventoryReport{Switch: swi, TimeStamp: now, Items: nxapiInventory(inv)})
+	}
 }
 
 // take all the data we were given and format it to JSON to send up
 // to the server.
-func processCollectedSNMPData(m map[string]map[string]string) {
+func processCollectedSNMPData(e string, m map[string]map[string]string) {
 	// get the name of the switch:
 	sw := m["0"]["sysName"]
 	// get the timestamp
 	now := time.Now()
 
-	sendMap := make(map[string][]string)
-	var sendStrings []string
+	sendSamples := []InterfaceSample{}
+	names := map[string]string{}
+	keys := identifySNMPInterfaces(e, sw, m)
 	//go through each switch for k, v := range m {
 	for k, v := range m {
+		if v["name"] != "" {
+			names[k] = v["name"]
+		}
 		// don't send if there is no data to send.
 		if emptyValues(v) {
 			continue
 		}
-		sendMe := fmt.Sprintf("'switch':'%s', 'ifName':'%s','timeStamp':'%d','ifInOctets':'%s', 'ifHCInOctets': '%s', 'ifOutOctets': '%s', 'ifHCOutOctets': '%s', 'ifHighSpeed': '%s', 'ifId': '%s'\n",
-			sw,
-			v["name"],
-			now.Unix(),
-			v["ifInOctets"],
-			v["ifHCInOctets"],
-			v["ifOutOctets"],
-			v["ifHCOutOctets"],
-			v["ifHighSpeed"],
-			k)
-
-		sendStrings = append(sendStrings, sendMe)
-	}
-	sendMap[sw] = sendStrings
-	// Todo: Send this up to the main server.
-	fmt.Println(sendMap)
+		s := newSNMPSample(sw, k, v, now.Unix())
+		s.IfKey = keys[k]
+		sendSamples = append(sendSamples, s)
+	}
+	rememberInterfaces(e, sw, names)
+	sendUpstream(map[string][]InterfaceSample{sw: sendSamples})
 }
 
 // see if any of the values are empty.
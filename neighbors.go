@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/hex"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/vallard/stickypipe-agent/nxapi"
+)
+
+// Neighbor is a device we see on the other end of one of our ports, from
+// LLDP or CDP.
+type Neighbor struct {
+	Protocol          string `json:"protocol"`
+	LocalPort         string `json:"localPort"`
+	RemoteSystem      string `json:"remoteSystem"`
+	RemotePort        string `json:"remotePort"`
+	ChassisId         string `json:"chassisId,omitempty"`
+	MgmtAddress       string `json:"mgmtAddress,omitempty"`
+	Platform          string `json:"platform,omitempty"`
+	SystemDescription string `json:"systemDescription,omitempty"`
+	Capabilities      string `json:"capabilities,omitempty"`
+}
+
+// NeighborReport is the neighbor list of one switch, which is what
+// stickypipe draws the physical topology from.
+type NeighborReport struct {
+	Switch    string     `json:"switch"`
+	TimeStamp int64      `json:"timeStamp"`
+	Neighbors []Neighbor `json:"neighbors"`
+}
+
+func nxapiNeighbors(lldp []nxapi.LLDPNeighbor, cdp []nxapi.CDPNeighbor) []Neighbor {
+	neighbors := []Neighbor{}
+	for _, n := range lldp {
+		mgmt := n.Mgmt_Addr
+		if mgmt == "" || mgmt == "not advertised" {
+			mgmt = n.Mgmt_Addr_Ipv6
+		}
+		if mgmt == "not advertised" {
+			mgmt = ""
+		}
+		neighbors = append(neighbors, Neighbor{
+			Protocol:          "lldp",
+			LocalPort:         n.LocalPort(),
+			RemoteSystem:      n.Sys_Name,
+			RemotePort:        n.Port_Id,
+			ChassisId:         n.Chassis_Id,
+			MgmtAddress:       mgmt,
+			SystemDescription: n.Sys_Desc,
+			Capabilities:      n.Enabled_Capability,
+		})
+	}
+	for _, n := range cdp {
+		system := n.Sysname
+		if system == "" {
+			system = n.Device_Id
+		}
+		mgmt := n.V4mgmtaddr
+		if mgmt == "" {
+			mgmt = n.V4addr
+		}
+		neighbors = append(neighbors, Neighbor{
+			Protocol:          "cdp",
+			LocalPort:         n.Intf_Id,
+			RemoteSystem:      system,
+			RemotePort:        n.Port_Id,
+			ChassisId:         n.Device_Id,
+			MgmtAddress:       mgmt,
+			Platform:          n.Platform_Id,
+			SystemDescription: n.Version,
+			Capabilities:      strings.Join(n.Capability, ", "),
+		})
+	}
+	return neighbors
+}
+
+// The LLDP-MIB and CISCO-CDP-MIB columns we walk.
+var lldpWork = map[string]string{
+	".1.0.8802.1.1.2.1.4.1.1.4":  "chassisIdSubtype",
+	".1.0.8802.1.1.2.1.4.1.1.5":  "chassisId",
+	".1.0.8802.1.1.2.1.4.1.1.6":  "portIdSubtype",
+	".1.0.8802.1.1.2.1.4.1.1.7":  "portId",
+	".1.0.8802.1.1.2.1.4.1.1.8":  "portDesc",
+	".1.0.8802.1.1.2.1.4.1.1.9":  "sysName",
+	".1.0.8802.1.1.2.1.4.1.1.10": "sysDesc",
+	".1.0.8802.1.1.2.1.4.1.1.12": "sysCapEnabled",
+}
+
+var lldpLocalWork = map[string]string{
+	".1.0.8802.1.1.2.1.3.7.1.3": "portId",
+	".1.0.8802.1.1.2.1.3.7.1.4": "portDesc",
+}
+
+// the index of this one has the address in it, the value doesn't matter.
+const lldpRemManAddrIfSubtype = ".1.0.8802.1.1.2.1.4.2.1.3"
+
+var cdpWork = map[string]string{
+	".1.3.6.1.4.1.9.9.23.1.2.1.1.3": "addressType",
+	".1.3.6.1.4.1.9.9.23.1.2.1.1.4": "address",
+	".1.3.6.1.4.1.9.9.23.1.2.1.1.5": "version",
+	".1.3.6.1.4.1.9.9.23.1.2.1.1.6": "deviceId",
+	".1.3.6.1.4.1.9.9.23.1.2.1.1.7": "devicePort",
+	".1.3.6.1.4.1.9.9.23.1.2.1.1.8": "platform",
+	".1.3.6.1.4.1.9.9.23.1.2.1.1.9": "capabilities",
+}
+
+// lldpRemSysCapEnabled bits, most significant first.
+var lldpCapabilities = []string{"Other", "Repeater", "Bridge", "WLAN AP", "Router", "Telephone", "DOCSIS", "Station"}
+
+// cdpCacheCapabilities bits, least significant first.
+var cdpCapabilities = []string{"Router", "Trans-Bridge", "Source-Route-Bridge", "Switch", "Host", "IGMP", "Repeater"}
+
+/*
+	Walk the LLDP and CDP tables of a switch and send up its neighbors.
+
+Arguments:
+
+	server - the switch
+	creds - the SNMP community string
+	sw - the switch name from sysName
+
+Run after processCollectedSNMPData so the interface names are known for
+CDP, which only gives us the ifIndex of our port.
+*/
+func collectSNMPNeighbors(server string, creds string, sw string) {
+	remote := map[string]map[string]string{}
+	local := map[string]map[string]string{}
+	addresses := map[string]map[string]string{}
+	cdp := map[string]map[string]string{}
+	walkColumns(server, creds, lldpWork, remote)
+	walkColumns(server, creds, lldpLocalWork, local)
+	walkTable(server, creds, lldpRemManAddrIfSubtype, "ifSubtype", addresses)
+	walkColumns(server, creds, cdpWork, cdp)
+
+	// management addresses by lldpRemTable row.
+	mgmt := map[string]string{}
+	for row := range addresses {
+		bits := strings.Split(row, ".")
+		if len(bits) < 5 {
+			continue
+		}
+		key := strings.Join(bits[:3], ".")
+		if a := indexAddress(bits[3], bits[5:]); a != "" && mgmt[key] == "" {
+			mgmt[key] = a
+		}
+	}
+
+	neighbors := []Neighbor{}
+	for row, v := range remote {
+		bits := strings.Split(row, ".")
+		if len(bits) != 3 {
+			continue
+		}
+		port := local[bits[1]]["portDesc"]
+		if port == "" {
+			port = local[bits[1]]["portId"]
+		}
+		if port == "" {
+			_, port = lookupInterface(server, bits[1])
+		}
+		neighbors = append(neighbors, Neighbor{
+			Protocol:          "lldp",
+			LocalPort:         port,
+			RemoteSystem:      v["sysName"],
+			RemotePort:        lldpID(v["portIdSubtype"], "3", v["portId"]),
+			ChassisId:         lldpID(v["chassisIdSubtype"], "4", v["chassisId"]),
+			MgmtAddress:       mgmt[row],
+			SystemDescription: v["sysDesc"],
+			Capabilities:      capabilityNames(lldpCapabilities, bitsMSBFirst(v["sysCapEnabled"])),
+		})
+	}
+	for row, v := range cdp {
+		bits := strings.Split(row, ".")
+		if len(bits) != 2 {
+			continue
+		}
+		_, port := lookupInterface(server, bits[0])
+		address := ""
+		// type 1 is IP.
+		if v["addressType"] == "1" && len(v["address"]) == 4 {
+			address = net.IP(v["address"]).String()
+		}
+		neighbors = append(neighbors, Neighbor{
+			Protocol:          "cdp",
+			LocalPort:         port,
+			RemoteSystem:      v["deviceId"],
+			RemotePort:        v["devicePort"],
+			ChassisId:         v["deviceId"],
+			MgmtAddress:       address,
+			Platform:          v["platform"],
+			SystemDescription: v["version"],
+			Capabilities:      capabilityNames(cdpCapabilities, bitsLSBFirst(v["capabilities"])),
+		})
+	}
+	sendNeighbors(NeighborReport{Switch: sw, TimeStamp: time.Now().Unix(), Neighbors: neighbors})
+}
+
+// indexAddress reads an address out of the lldpRemManAddrTable index, which
+// is the address family then one number per byte.
+func indexAddress(family string, b []string) string {
+	ip := net.IP{}
+	for _, s := range b {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return ""
+		}
+		ip = append(ip, byte(n))
+	}
+	if (family == "1" && len(ip) == 4) || (family == "2" && len(ip) == 16) {
+		return ip.String()
+	}
+	return ""
+}
+
+// lldpID formats a chassis or port ID.  MAC addresses come as raw bytes and
+// so can anything else a vendor likes, those get shown in hex.
+func lldpID(subtype string, macSubtype string, id string) string {
+	if subtype == macSubtype && len(id) == 6 {
+		return net.HardwareAddr(id).String()
+	}
+	for _, r := range id {
+		if !unicode.IsPrint(r) {
+			return hex.EncodeToString([]byte(id))
+		}
+	}
+	return id
+}
+
+func bitsMSBFirst(s string) []bool {
+	bits := []bool{}
+	for i := 0; i < len(s); i++ {
+		for j := 7; j >= 0; j-- {
+			bits = append(bits, s[i]&(1<<uint(j)) != 0)
+		}
+	}
+	return bits
+}
+
+// cdpCacheCapabilities is a 4 byte number.
+func bitsLSBFirst(s string) []bool {
+	bits := []bool{}
+	for i := len(s) - 1; i >= 0; i-- {
+		for j := 0; j < 8; j++ {
+			bits = append(bits, s[i]&(1<<uint(j)) != 0)
+		}
+	}
+	return bits
+}
+
+func capabilityNames(names []string, bits []bool) string {
+	set := []string{}
+	for i, name := range names {
+		if i < len(bits) && bits[i] {
+			set = append(set, name)
+		}
+	}
+	return strings.Join(set, ", ")
+}
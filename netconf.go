@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/vallard/stickypipe-agent/netconf"
+	"github.com/vallard/stickypipe-agent/yang"
+	"golang.org/x/crypto/ssh"
+)
+
+// The subtree filters we run <get> with.
+var netconfFilters = map[string]string{
+	"interfaces-state": `<interfaces-state xmlns="` + yang.IETFInterfacesNamespace + `"/>`,
+	"interfaces":       `<interfaces xmlns="` + yang.IETFInterfacesNamespace + `"/>`,
+	"openconfig":       `<interfaces xmlns="` + yang.OpenConfigInterfacesNamespace + `"/>`,
+	"system":           `<system xmlns="` + yang.IETFSystemNamespace + `"><hostname/></system>`,
+	"system-state":     `<system-state xmlns="` + yang.IETFSystemNamespace + `"><platform/></system-state>`,
+}
+
+// netconfGet runs a <get> and unmarshals the one element that comes back in
+// <data> into v.  It returns false if the device had nothing to say.
+func netconfGet(s *netconf.Session, server string, filter string, v interface{}) bool {
+	data, err := s.Get(netconfFilters[filter])
+	if err != nil {
+		log.Println(server, filter, err)
+		return false
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return false
+	}
+	if err := xml.Unmarshal(data, v); err != nil {
+		log.Println(server, filter, err)
+		return false
+	}
+	return true
+}
+
+/* Get interface statistics over NETCONF
+Arguments:
+ server - switch or router (10.93.234.4, csr1000v, or something reachable)
+ creds - user/password pair that looks like admin:cisco
+
+Logs in with the same SSH settings as the SSH method, but on the NETCONF port
+and asking for the netconf subsystem instead of running commands.
+*/
+func collectNETCONF(server string, creds string) {
+	config, err := sshClientConfig(creds)
+	if err != nil {
+		log.Println(server, err)
+		return
+	}
+	addr := net.JoinHostPort(server, strconv.Itoa(sshSettings.NetconfPort))
+	client, err := ssh.Dial("tcp", addr, config)
+	if err != nil {
+		log.Println(server, err)
+		return
+	}
+	defer client.Close()
+	session, err := client.NewSession()
+	if err != nil {
+		log.Println(server, err)
+		return
+	}
+	defer session.Close()
+	stdin, err := session.StdinPipe()
+	if err != nil {
+		log.Println(server, err)
+		return
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		log.Println(server, err)
+		return
+	}
+	if err := session.RequestSubsystem("netconf"); err != nil {
+		log.Println(server, err)
+		return
+	}
+	nc, err := netconf.NewSession(stdout, stdin)
+	if err != nil {
+		log.Println(server, err)
+		return
+	}
+	defer nc.Close()
+
+	var system yang.IETFSystem
+	var systemState yang.IETFSystemState
+	netconfGet(nc, server, "system", &system)
+	netconfGet(nc, server, "system-state", &systemState)
+
+	// RFC 7223 devices have interfaces-state, RFC 8343 (NMDA) devices
+	// put the same thing under interfaces.
+	var ietf yang.IETFInterfaces
+	if !netconfGet(nc, server, "interfaces-state", &ietf) || len(ietf.Interfaces) == 0 {
+		netconfGet(nc, server, "interfaces", &ietf)
+	}
+	var oc yang.OpenConfigInterfaces
+	if nc.HasCapability(yang.OpenConfigInterfacesNamespace) {
+		netconfGet(nc, server, "openconfig", &oc)
+	}
+	processCollectedYANGData(server, system, systemState, ietf, oc)
+}
+
+// process the ietf/openconfig models that NETCONF and RESTCONF give us into a
+// device report and interface samples.
+func processCollectedYANGData(sw string, system yang.IETFSystem, state yang.IETFSystemState, ietf yang.IETFInterfaces, oc yang.OpenConfigInterfaces) {
+	now := time.Now().Unix()
+	swi := sw
+	if system.Hostname != "" {
+		swi = system.Hostname
+		sendUpstream(DeviceReport{
+			Switch:    swi,
+			TimeStamp: now,
+			Device: DeviceInfo{
+				Hostname:  system.Hostname,
+				Model:     state.Platform.Machine,
+				OS:        state.Platform.OSName,
+				OSVersion: state.Platform.OSRelease,
+			},
+		})
+	}
+
+	samples := newSampleSet(swi, now)
+	for _, i := range ietf.Interfaces {
+		samples.get(i.Name).addIETFInterface(i)
+	}
+	// openconfig has a few more counters (FCS errors) and the MTU.
+	for _, i := range oc.Interfaces {
+		samples.get(i.Name).addOpenConfigInterface(i)
+	}
+	sendUpstream(map[string][]InterfaceSample{swi: samples.list()})
+}
@@ -0,0 +1,231 @@
+package netconf
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+/* A small NETCONF (RFC 6241) client.  It only knows how to say hello and run
+<get>, which is all we need to read counters.
+
+The session runs over any reader/writer pair.  In the agent that is the netconf
+SSH subsystem (RFC 6242) but it can just as well be a pipe to a stand-in
+server.  Messages are framed with ]]>]]> until both sides have said hello; if
+both speak base:1.1 we switch to chunked framing after that.
+*/
+
+const (
+	Base10 = "urn:ietf:params:netconf:base:1.0"
+	Base11 = "urn:ietf:params:netconf:base:1.1"
+
+	// the XML namespace every NETCONF message lives in.
+	Namespace = "urn:ietf:params:xml:ns:netconf:base:1.0"
+
+	endOfMessage = "]]>]]>"
+)
+
+// The biggest chunk and message we'll read.  RFC 6242 lets a chunk be up to
+// 4294967295 bytes, far more than any reply we ask for, and we don't want a
+// broken or hostile server to have us allocate that.
+var (
+	maxChunkSize   = 16 << 20
+	maxMessageSize = 64 << 20
+)
+
+type Session struct {
+	r         *bufio.Reader
+	w         io.Writer
+	chunked   bool
+	messageID int
+	// What the device told us it supports in its hello.
+	ServerCapabilities []string
+	SessionID          int
+}
+
+type hello struct {
+	XMLName      xml.Name `xml:"urn:ietf:params:xml:ns:netconf:base:1.0 hello"`
+	Capabilities []string `xml:"capabilities>capability"`
+	SessionID    int      `xml:"session-id,omitempty"`
+}
+
+type rpcReply struct {
+	XMLName   xml.Name   `xml:"rpc-reply"`
+	MessageID string     `xml:"message-id,attr"`
+	Errors    []RPCError `xml:"rpc-error"`
+	Data      struct {
+		Inner []byte `xml:",innerxml"`
+	} `xml:"data"`
+}
+
+// RPCError is an <rpc-error> from the device.
+type RPCError struct {
+	Type     string `xml:"error-type"`
+	Tag      string `xml:"error-tag"`
+	Severity string `xml:"error-severity"`
+	Message  string `xml:"error-message"`
+}
+
+func (e RPCError) Error() string {
+	return fmt.Sprintf("netconf %s error %s: %s", e.Type, e.Tag, strings.TrimSpace(e.Message))
+}
+
+// NewSession exchanges hellos over r and w.
+func NewSession(r io.Reader, w io.Writer) (*Session, error) {
+	s := &Session{r: bufio.NewReader(r), w: w}
+	h, err := xml.Marshal(hello{Capabilities: []string{Base10, Base11}})
+	if err != nil {
+		return nil, err
+	}
+	// both sides send hello as soon as the session opens so we have to
+	// read theirs while ours is going out or we can deadlock.
+	sent := make(chan error, 1)
+	go func() {
+		sent <- s.write(append([]byte(xml.Header), h...))
+	}()
+	msg, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	if err := <-sent; err != nil {
+		return nil, err
+	}
+	var server hello
+	if err := xml.Unmarshal(msg, &server); err != nil {
+		return nil, fmt.Errorf("netconf: bad hello: %v", err)
+	}
+	s.ServerCapabilities = server.Capabilities
+	s.SessionID = server.SessionID
+	s.chunked = s.HasCapability(Base11)
+	return s, nil
+}
+
+// HasCapability tells us if the device advertised a capability starting with
+// prefix.  Module capabilities carry ?module=...&revision=... on the end so a
+// prefix match is what you want.
+func (s *Session) HasCapability(prefix string) bool {
+	for _, c := range s.ServerCapabilities {
+		if strings.HasPrefix(strings.TrimSpace(c), prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Get runs <get> with a subtree filter and returns what was inside <data>.
+func (s *Session) Get(filter string) ([]byte, error) {
+	return s.rpc(`<get><filter type="subtree">` + filter + `</filter></get>`)
+}
+
+// Close ends the session politely.
+func (s *Session) Close() error {
+	_, err := s.rpc(`<close-session/>`)
+	return err
+}
+
+func (s *Session) rpc(op string) ([]byte, error) {
+	s.messageID++
+	id := strconv.Itoa(s.messageID)
+	msg := `<rpc message-id="` + id + `" xmlns="` + Namespace + `">` + op + `</rpc>`
+	if err := s.write([]byte(msg)); err != nil {
+		return nil, err
+	}
+	b, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+	var reply rpcReply
+	if err := xml.Unmarshal(b, &reply); err != nil {
+		return nil, fmt.Errorf("netconf: bad rpc-reply: %v", err)
+	}
+	if reply.MessageID != "" && reply.MessageID != id {
+		return nil, fmt.Errorf("netconf: reply for message %s, wanted %s", reply.MessageID, id)
+	}
+	for _, e := range reply.Errors {
+		// warnings don't stop us.
+		if e.Severity != "warning" {
+			return nil, e
+		}
+	}
+	return reply.Data.Inner, nil
+}
+
+func (s *Session) write(msg []byte) error {
+	var err error
+	if s.chunked {
+		_, err = fmt.Fprintf(s.w, "\n#%d\n%s\n##\n", len(msg), msg)
+	} else {
+		_, err = s.w.Write(append(msg, endOfMessage...))
+	}
+	return err
+}
+
+func (s *Session) read() ([]byte, error) {
+	if s.chunked {
+		return s.readChunked()
+	}
+	var msg []byte
+	for {
+		b, err := s.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		msg = append(msg, b)
+		if bytes.HasSuffix(msg, []byte(endOfMessage)) {
+			return bytes.TrimSpace(msg[:len(msg)-len(endOfMessage)]), nil
+		}
+		if len(msg) > maxMessageSize+len(endOfMessage) {
+			return nil, fmt.Errorf("netconf: message longer than %d bytes", maxMessageSize)
+		}
+	}
+}
+
+// readChunked reads chunks that look like \n#<size>\n<data> until the
+// \n##\n that ends the message.
+func (s *Session) readChunked() ([]byte, error) {
+	var msg []byte
+	for {
+		// skip the newline (and anything else a sloppy server sends) up to #
+		for {
+			b, err := s.r.ReadByte()
+			if err != nil {
+				return nil, err
+			}
+			if b == '#' {
+				break
+			}
+			if b != '\n' && b != '\r' && b != ' ' {
+				return nil, errors.New("netconf: bad chunk header")
+			}
+		}
+		line, err := s.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimSpace(line)
+		if line == "#" {
+			return msg, nil
+		}
+		n, err := strconv.ParseUint(line, 10, 32)
+		if err != nil || n == 0 {
+			return nil, fmt.Errorf("netconf: bad chunk size %q", line)
+		}
+		if n > uint64(maxChunkSize) {
+			return nil, fmt.Errorf("netconf: chunk of %d bytes is longer than %d", n, maxChunkSize)
+		}
+		size := int(n)
+		if len(msg)+size > maxMessageSize {
+			return nil, fmt.Errorf("netconf: message longer than %d bytes", maxMessageSize)
+		}
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(s.r, chunk); err != nil {
+			return nil, err
+		}
+		msg = append(msg, chunk...)
+	}
+}
@@ -0,0 +1,276 @@
+package netconf
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// standIn is the device end of a net.Pipe.  It speaks the framing by hand
+// so the client is checked against the wire format, not against itself.
+type standIn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	chunked bool
+}
+
+// startStandIn opens a session to a stand-in that says hello with
+// capabilities and then runs serve.  Whatever serve returns comes back on
+// the channel.
+func startStandIn(t *testing.T, capabilities []string, serve func(d *standIn) error) (*Session, <-chan error) {
+	client, server := net.Pipe()
+	t.Cleanup(func() { client.Close(); server.Close() })
+	d := &standIn{conn: server, r: bufio.NewReader(server)}
+	done := make(chan error, 1)
+	go func() {
+		caps := ""
+		for _, c := range capabilities {
+			caps += "<capability>" + c + "</capability>"
+		}
+		hello := `<?xml version="1.0" encoding="UTF-8"?><hello xmlns="` + Namespace + `"><capabilities>` + caps + `</capabilities><session-id>4242</session-id></hello>`
+		// the client's hello and ours cross on the wire.
+		sent := make(chan error, 1)
+		go func() {
+			_, err := io.WriteString(server, hello+endOfMessage)
+			sent <- err
+		}()
+		theirs, err := d.readEOM()
+		if err != nil {
+			done <- err
+			return
+		}
+		if err := <-sent; err != nil {
+			done <- err
+			return
+		}
+		if !strings.Contains(theirs, "<capability>"+Base10+"</capability>") || !strings.Contains(theirs, "<capability>"+Base11+"</capability>") {
+			done <- fmt.Errorf("client hello %s", theirs)
+			return
+		}
+		for _, c := range capabilities {
+			if c == Base11 {
+				d.chunked = true
+			}
+		}
+		done <- serve(d)
+	}()
+	s, err := NewSession(client, client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s, done
+}
+
+func (d *standIn) readEOM() (string, error) {
+	msg := ""
+	for !strings.HasSuffix(msg, endOfMessage) {
+		b, err := d.r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		msg += string(b)
+	}
+	return strings.TrimSuffix(msg, endOfMessage), nil
+}
+
+func (d *standIn) readChunked() (string, error) {
+	msg := ""
+	for {
+		if _, err := d.r.ReadString('#'); err != nil {
+			return "", err
+		}
+		line, err := d.r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		if line == "#\n" {
+			return msg, nil
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(line))
+		if err != nil {
+			return "", err
+		}
+		chunk := make([]byte, n)
+		if _, err := io.ReadFull(d.r, chunk); err != nil {
+			return "", err
+		}
+		msg += string(chunk)
+	}
+}
+
+func (d *standIn) read() (string, error) {
+	if d.chunked {
+		return d.readChunked()
+	}
+	return d.readEOM()
+}
+
+// send sends msg, in chunks of at most size bytes when chunked.
+func (d *standIn) send(msg string, size int) error {
+	if !d.chunked {
+		_, err := io.WriteString(d.conn, msg+endOfMessage)
+		return err
+	}
+	framed := ""
+	for len(msg) > 0 {
+		n := size
+		if n > len(msg) {
+			n = len(msg)
+		}
+		framed += fmt.Sprintf("\n#%d\n%s", n, msg[:n])
+		msg = msg[n:]
+	}
+	_, err := io.WriteString(d.conn, framed+"\n##\n")
+	return err
+}
+
+// answer reads an rpc, checks it has want in it and sends reply.
+func (d *standIn) answer(want string, reply string, size int) error {
+	rpc, err := d.read()
+	if err != nil {
+		return err
+	}
+	if !strings.Contains(rpc, want) {
+		return fmt.Errorf("got rpc %s, wanted %s in it", rpc, want)
+	}
+	return d.send(reply, size)
+}
+
+const interfaces = `<interfaces xmlns="urn:ietf:params:xml:ns:yang:ietf-interfaces"><interface><name>GigabitEthernet1</name></interface></interfaces>`
+
+func dataReply(id int) string {
+	return `<rpc-reply message-id="` + strconv.Itoa(id) + `" xmlns="` + Namespace + `"><data>` + interfaces + `</data></rpc-reply>`
+}
+
+func TestHello(t *testing.T) {
+	s, done := startStandIn(t, []string{
+		Base10,
+		"urn:ietf:params:xml:ns:yang:ietf-interfaces?module=ietf-interfaces&amp;revision=2014-05-08",
+	}, func(d *standIn) error {
+		if err := d.answer(`<rpc message-id="1" xmlns="`+Namespace+`"><get><filter type="subtree"><interfaces/></filter></get></rpc>`, dataReply(1), 0); err != nil {
+			return err
+		}
+		return d.answer("<close-session/>", `<rpc-reply message-id="2" xmlns="`+Namespace+`"><ok/></rpc-reply>`, 0)
+	})
+	if s.chunked {
+		t.Error("chunked without base:1.1")
+	}
+	if s.SessionID != 4242 {
+		t.Errorf("session ID %d", s.SessionID)
+	}
+	if !s.HasCapability("urn:ietf:params:xml:ns:yang:ietf-interfaces") || s.HasCapability("urn:ietf:params:xml:ns:yang:ietf-ip") {
+		t.Errorf("capabilities %v", s.ServerCapabilities)
+	}
+	data, err := s.Get("<interfaces/>")
+	if err != nil || string(data) != interfaces {
+		t.Errorf("got %s %v", data, err)
+	}
+	if err := s.Close(); err != nil {
+		t.Error(err)
+	}
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestChunked(t *testing.T) {
+	s, done := startStandIn(t, []string{Base10, Base11}, func(d *standIn) error {
+		// a reply in one chunk, then one cut into pieces mid-tag.
+		if err := d.answer(`message-id="1"`, dataReply(1), 4096); err != nil {
+			return err
+		}
+		return d.answer(`message-id="2"`, dataReply(2), 7)
+	})
+	if !s.chunked {
+		t.Fatal("not chunked with base:1.1 on both sides")
+	}
+	for i := 0; i < 2; i++ {
+		data, err := s.Get("<interfaces/>")
+		if err != nil || string(data) != interfaces {
+			t.Errorf("%d: got %s %v", i, data, err)
+		}
+	}
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRPCError(t *testing.T) {
+	s, done := startStandIn(t, []string{Base10}, func(d *standIn) error {
+		if err := d.answer(`message-id="1"`, `<rpc-reply message-id="1" xmlns="`+Namespace+`"><rpc-error>
+			<error-type>application</error-type>
+			<error-tag>operation-not-supported</error-tag>
+			<error-severity>error</error-severity>
+			<error-message xml:lang="en">
+				get is not supported
+			</error-message>
+		</rpc-error></rpc-reply>`, 0); err != nil {
+			return err
+		}
+		// a warning doesn't stop the data.
+		return d.answer(`message-id="2"`, `<rpc-reply message-id="2" xmlns="`+Namespace+`"><rpc-error>
+			<error-type>application</error-type>
+			<error-tag>partial-operation</error-tag>
+			<error-severity>warning</error-severity>
+		</rpc-error><data>`+interfaces+`</data></rpc-reply>`, 0)
+	})
+	_, err := s.Get("<interfaces/>")
+	var e RPCError
+	if !errors.As(err, &e) || e.Tag != "operation-not-supported" || err.Error() != "netconf application error operation-not-supported: get is not supported" {
+		t.Errorf("got %v", err)
+	}
+	data, err := s.Get("<interfaces/>")
+	if err != nil || string(data) != interfaces {
+		t.Errorf("with a warning: got %s %v", data, err)
+	}
+	if err := <-done; err != nil {
+		t.Error(err)
+	}
+}
+
+func TestReadChunked(t *testing.T) {
+	oldChunk, oldMessage := maxChunkSize, maxMessageSize
+	defer func() { maxChunkSize, maxMessageSize = oldChunk, oldMessage }()
+	maxChunkSize, maxMessageSize = 16, 24
+
+	tests := []struct {
+		in   string
+		want string
+		err  bool
+	}{
+		{in: "\n#5\nhello\n##\n", want: "hello"},
+		{in: "\n#3\nhel\n#2\nlo\n#1\n!\n##\n", want: "hello!"},
+		// sloppy whitespace before the header.
+		{in: "\r\n #5\nhello\n##\n", want: "hello"},
+		{in: "\n#0\n\n##\n", err: true},
+		{in: "\n#-1\nx\n##\n", err: true},
+		{in: "\n#abc\nx\n##\n", err: true},
+		{in: "\nx#5\nhello\n##\n", err: true},
+		{in: "\n#9223372036854775807\nx\n##\n", err: true},
+		{in: "\n#4294967296\nx\n##\n", err: true},
+		// bigger than a chunk may be.
+		{in: "\n#17\n" + strings.Repeat("x", 17) + "\n##\n", err: true},
+		// chunks that are fine on their own but too much together.
+		{in: "\n#16\n" + strings.Repeat("x", 16) + "\n#9\n" + strings.Repeat("x", 9) + "\n##\n", err: true},
+		// cut short.
+		{in: "\n#5\nhel", err: true},
+		{in: "\n#5\nhello\n#", err: true},
+	}
+	for _, tt := range tests {
+		s := &Session{r: bufio.NewReader(strings.NewReader(tt.in)), chunked: true}
+		got, err := s.read()
+		if (err != nil) != tt.err || string(got) != tt.want {
+			t.Errorf("%q: got %q %v", tt.in, got, err)
+		}
+	}
+
+	s := &Session{r: bufio.NewReader(strings.NewReader(strings.Repeat("x", 100) + endOfMessage))}
+	if _, err := s.read(); err == nil {
+		t.Error("read a message longer than the limit")
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+
+	"github.com/vallard/stickypipe-agent/netflow"
+)
+
+/*
+	Receive NetFlow v5, v9 and IPFIX from routers
+
+Arguments:
+
+	listen - address to listen on, like :2055
+	devices - what endpointAddresses returned, to find the switch name
+	flows - where the flows get added up
+
+Flows are counted against both their input and output interface and sent
+up every interval with the sFlow ones.  Runs until ctx is cancelled.
+*/
+func receiveNetFlow(ctx context.Context, listen string, devices map[string]string, flows *flowTable) {
+	conn, err := net.ListenPacket("udp", listen)
+	if err != nil {
+		log.Println("netflow receiver: ", err)
+		return
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	decoder := netflow.NewDecoder()
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Println("netflow receiver: ", err)
+			continue
+		}
+		source, _, _ := net.SplitHostPort(addr.String())
+		fs, err := decoder.Decode(source, buf[:n])
+		if err != nil {
+			// we still use the flows before the bad one.
+			log.Println("netflow from", addr, err)
+		}
+		processNetFlows(flowEndpoint(devices, nil, source), fs, flows)
+	}
+}
+
+func processNetFlows(endpoint string, fs []netflow.Flow, flows *flowTable) {
+	for _, f := range fs {
+		if f.SrcAddr == nil || f.DstAddr == nil {
+			continue
+		}
+		c := Conversation{
+			SrcAddr:  f.SrcAddr.String(),
+			DstAddr:  f.DstAddr.String(),
+			Protocol: f.Protocol,
+			SrcPort:  f.SrcPort,
+			DstPort:  f.DstPort,
+			Bytes:    f.Bytes * uint64(f.SamplingInterval),
+			Packets:  f.Packets * uint64(f.SamplingInterval),
+		}
+		flows.add(endpoint, f.Input, "in", "netflow", c)
+		flows.add(endpoint, f.Output, "out", "netflow", c)
+	}
+}
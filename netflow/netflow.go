@@ -0,0 +1,380 @@
+/*
+Package netflow decodes NetFlow v5, NetFlow v9 (RFC 3954) and IPFIX (RFC
+7011) export packets into flows.
+
+v9 and IPFIX data can't be read without the templates the exporter sends
+every so often, so a Decoder remembers them per exporter.  Data for a
+template we haven't seen yet is dropped.
+*/
+package netflow
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+)
+
+// Flow is one flow record, whichever version it came in.  Input and Output
+// are ifIndexes.
+type Flow struct {
+	SrcAddr  net.IP
+	DstAddr  net.IP
+	Protocol uint8
+	TOS      uint8
+	SrcPort  uint16
+	DstPort  uint16
+	Input    uint32
+	Output   uint32
+	Bytes    uint64
+	Packets  uint64
+	// 1 in how many packets were sampled, 1 if we weren't told.
+	SamplingInterval uint32
+}
+
+// The information elements we use.  The numbers are the same in v9 and
+// IPFIX.
+const (
+	fieldInBytes                   = 1
+	fieldInPkts                    = 2
+	fieldProtocol                  = 4
+	fieldTOS                       = 5
+	fieldL4SrcPort                 = 7
+	fieldIPv4SrcAddr               = 8
+	fieldInputSNMP                 = 10
+	fieldL4DstPort                 = 11
+	fieldIPv4DstAddr               = 12
+	fieldOutputSNMP                = 14
+	fieldIPv6SrcAddr               = 27
+	fieldIPv6DstAddr               = 28
+	fieldSamplingInterval          = 34
+	fieldFlowSamplerRandomInterval = 50
+	fieldOctetTotalCount           = 85
+	fieldPacketTotalCount          = 86
+	fieldSamplingPacketInterval    = 305
+)
+
+// variable length IPFIX fields.
+const variableLength = 65535
+
+var errShort = errors.New("netflow: packet too short")
+
+type field struct {
+	id     uint16
+	length uint16
+	// IPFIX enterprise specific fields, which we skip.
+	enterprise bool
+}
+
+type template struct {
+	fields []field
+	// options templates carry exporter settings like the sampling rate,
+	// not flows.
+	options bool
+}
+
+type templateKey struct {
+	exporter string
+	domain   uint32
+	id       uint16
+}
+
+// Decoder decodes export packets and keeps the templates.  It's safe to use
+// from more than one goroutine.
+type Decoder struct {
+	mutex     sync.Mutex
+	templates map[templateKey]template
+	sampling  map[string]uint32
+}
+
+func NewDecoder() *Decoder {
+	return &Decoder{templates: map[templateKey]template{}, sampling: map[string]uint32{}}
+}
+
+// Decode decodes one packet from exporter, which is anything that tells
+// exporters apart, usually the address it came from.
+func (d *Decoder) Decode(exporter string, b []byte) ([]Flow, error) {
+	if len(b) < 2 {
+		return nil, errShort
+	}
+	switch v := binary.BigEndian.Uint16(b); v {
+	case 5:
+		return decodeV5(b)
+	case 9:
+		return d.decodeV9(exporter, b)
+	case 10:
+		return d.decodeIPFIX(exporter, b)
+	default:
+		return nil, fmt.Errorf("netflow: unsupported version %d", v)
+	}
+}
+
+func decodeV5(b []byte) ([]Flow, error) {
+	const headerLen, recordLen = 24, 48
+	if len(b) < headerLen {
+		return nil, errShort
+	}
+	count := int(binary.BigEndian.Uint16(b[2:]))
+	// the top two bits are the sampling mode.
+	interval := uint32(binary.BigEndian.Uint16(b[22:]) & 0x3fff)
+	if interval == 0 {
+		interval = 1
+	}
+	flows := []Flow{}
+	for i := 0; i < count; i++ {
+		r := b[headerLen+i*recordLen:]
+		if len(r) < recordLen {
+			return flows, errShort
+		}
+		flows = append(flows, Flow{
+			SrcAddr:          copyIP(r[0:4]),
+			DstAddr:          copyIP(r[4:8]),
+			Input:            uint32(binary.BigEndian.Uint16(r[12:])),
+			Output:           uint32(binary.BigEndian.Uint16(r[14:])),
+			Packets:          uint64(binary.BigEndian.Uint32(r[16:])),
+			Bytes:            uint64(binary.BigEndian.Uint32(r[20:])),
+			SrcPort:          binary.BigEndian.Uint16(r[32:]),
+			DstPort:          binary.BigEndian.Uint16(r[34:]),
+			Protocol:         r[38],
+			TOS:              r[39],
+			SamplingInterval: interval,
+		})
+	}
+	return flows, nil
+}
+
+func (d *Decoder) decodeV9(exporter string, b []byte) ([]Flow, error) {
+	const headerLen = 20
+	if len(b) < headerLen {
+		return nil, errShort
+	}
+	domain := binary.BigEndian.Uint32(b[16:])
+	return d.decodeSets(exporter, domain, b[headerLen:], false)
+}
+
+func (d *Decoder) decodeIPFIX(exporter string, b []byte) ([]Flow, error) {
+	const headerLen = 16
+	if len(b) < headerLen {
+		return nil, errShort
+	}
+	length := int(binary.BigEndian.Uint16(b[2:]))
+	if length < headerLen || length > len(b) {
+		return nil, errShort
+	}
+	domain := binary.BigEndian.Uint32(b[12:])
+	return d.decodeSets(exporter, domain, b[headerLen:length], true)
+}
+
+// decodeSets reads the flowsets (v9) or sets (IPFIX) that make up the rest
+// of the packet.  They are laid out the same, only the set IDs and the
+// template formats differ a little.
+func (d *Decoder) decodeSets(exporter string, domain uint32, b []byte, ipfix bool) ([]Flow, error) {
+	templateSet, optionsSet := uint16(0), uint16(1)
+	if ipfix {
+		templateSet, optionsSet = 2, 3
+	}
+	flows := []Flow{}
+	for len(b) > 0 {
+		if len(b) < 4 {
+			return flows, errShort
+		}
+		id := binary.BigEndian.Uint16(b)
+		length := int(binary.BigEndian.Uint16(b[2:]))
+		if length < 4 || length > len(b) {
+			return flows, errShort
+		}
+		body := b[4:length]
+		b = b[length:]
+		var err error
+		switch {
+		case id == templateSet:
+			err = d.readTemplates(exporter, domain, body, ipfix, false)
+		case id == optionsSet:
+			err = d.readTemplates(exporter, domain, body, ipfix, true)
+		case id >= 256:
+			var fs []Flow
+			fs, err = d.readData(exporter, domain, id, body)
+			flows = append(flows, fs...)
+		}
+		if err != nil {
+			return flows, err
+		}
+	}
+	return flows, nil
+}
+
+func (d *Decoder) readTemplates(exporter string, domain uint32, b []byte, ipfix bool, options bool) error {
+	// anything shorter than a template header is padding.
+	for len(b) >= 4 {
+		id := binary.BigEndian.Uint16(b)
+		count := int(binary.BigEndian.Uint16(b[2:]))
+		b = b[4:]
+		if options {
+			if len(b) < 2 {
+				return errShort
+			}
+			if ipfix {
+				// field count, then the scope field count which we
+				// don't need, the scope fields come first either way.
+				b = b[2:]
+			} else {
+				// scope and option lengths in bytes.
+				optionLen := int(binary.BigEndian.Uint16(b))
+				count = (count + optionLen) / 4
+				b = b[2:]
+			}
+		}
+		if count == 0 {
+			// withdrawal
+			d.mutex.Lock()
+			delete(d.templates, templateKey{exporter, domain, id})
+			d.mutex.Unlock()
+			continue
+		}
+		t := template{options: options}
+		for i := 0; i < count; i++ {
+			if len(b) < 4 {
+				return errShort
+			}
+			f := field{id: binary.BigEndian.Uint16(b), length: binary.BigEndian.Uint16(b[2:])}
+			b = b[4:]
+			if ipfix && f.id&0x8000 != 0 {
+				if len(b) < 4 {
+					return errShort
+				}
+				f.id &^= 0x8000
+				f.enterprise = true
+				b = b[4:]
+			}
+			t.fields = append(t.fields, f)
+		}
+		d.mutex.Lock()
+		d.templates[templateKey{exporter, domain, id}] = t
+		d.mutex.Unlock()
+	}
+	return nil
+}
+
+func (d *Decoder) readData(exporter string, domain uint32, id uint16, b []byte) ([]Flow, error) {
+	d.mutex.Lock()
+	t, ok := d.templates[templateKey{exporter, domain, id}]
+	sampling := d.sampling[exporter]
+	d.mutex.Unlock()
+	if !ok {
+		return nil, nil
+	}
+	flows := []Flow{}
+	for len(b) > 0 {
+		f := Flow{}
+		rest, complete := t.record(b, &f)
+		if !complete {
+			// the rest is padding.
+			break
+		}
+		b = rest
+		if t.options {
+			if f.SamplingInterval != 0 {
+				d.mutex.Lock()
+				d.sampling[exporter] = f.SamplingInterval
+				d.mutex.Unlock()
+				sampling = f.SamplingInterval
+			}
+			continue
+		}
+		if f.SamplingInterval == 0 {
+			f.SamplingInterval = sampling
+		}
+		if f.SamplingInterval == 0 {
+			f.SamplingInterval = 1
+		}
+		flows = append(flows, f)
+	}
+	return flows, nil
+}
+
+// record reads one data record into f.  It returns false if there isn't a
+// whole record left.
+func (t template) record(b []byte, f *Flow) ([]byte, bool) {
+	if len(t.fields) == 0 {
+		return b, false
+	}
+	for _, field := range t.fields {
+		n := int(field.length)
+		if field.length == variableLength {
+			if len(b) < 1 {
+				return b, false
+			}
+			n = int(b[0])
+			b = b[1:]
+			if n == 255 {
+				if len(b) < 2 {
+					return b, false
+				}
+				n = int(binary.BigEndian.Uint16(b))
+				b = b[2:]
+			}
+		}
+		if len(b) < n || (n == 0 && field.length != variableLength) {
+			return b, false
+		}
+		v := b[:n]
+		b = b[n:]
+		if !field.enterprise {
+			f.set(field.id, v)
+		}
+	}
+	return b, true
+}
+
+func (f *Flow) set(id uint16, v []byte) {
+	switch id {
+	case fieldInBytes:
+		f.Bytes = number(v)
+	case fieldOctetTotalCount:
+		if f.Bytes == 0 {
+			f.Bytes = number(v)
+		}
+	case fieldInPkts:
+		f.Packets = number(v)
+	case fieldPacketTotalCount:
+		if f.Packets == 0 {
+			f.Packets = number(v)
+		}
+	case fieldProtocol:
+		f.Protocol = uint8(number(v))
+	case fieldTOS:
+		f.TOS = uint8(number(v))
+	case fieldL4SrcPort:
+		f.SrcPort = uint16(number(v))
+	case fieldL4DstPort:
+		f.DstPort = uint16(number(v))
+	case fieldIPv4SrcAddr, fieldIPv6SrcAddr:
+		f.SrcAddr = copyIP(v)
+	case fieldIPv4DstAddr, fieldIPv6DstAddr:
+		f.DstAddr = copyIP(v)
+	case fieldInputSNMP:
+		f.Input = uint32(number(v))
+	case fieldOutputSNMP:
+		f.Output = uint32(number(v))
+	case fieldSamplingInterval, fieldFlowSamplerRandomInterval, fieldSamplingPacketInterval:
+		f.SamplingInterval = uint32(number(v))
+	}
+}
+
+// number reads an unsigned number of any length up to 8 bytes.  IPFIX
+// lets exporters send counters shorter than their real size.
+func number(v []byte) uint64 {
+	var n uint64
+	for _, c := range v {
+		n = n<<8 | uint64(c)
+	}
+	return n
+}
+
+func copyIP(v []byte) net.IP {
+	if len(v) != 4 && len(v) != 16 {
+		return nil
+	}
+	return append(net.IP{}, v...)
+}
@@ -0,0 +1,247 @@
+package netflow
+
+import (
+	"encoding/binary"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// be builds big endian packets: ints are 16 bits, uint32s and uint64s
+// their own size, bytes and addresses as they are.
+func be(parts ...interface{}) []byte {
+	b := []byte{}
+	for _, p := range parts {
+		switch v := p.(type) {
+		case int:
+			b = binary.BigEndian.AppendUint16(b, uint16(v))
+		case uint32:
+			b = binary.BigEndian.AppendUint32(b, v)
+		case uint64:
+			b = binary.BigEndian.AppendUint64(b, v)
+		case byte:
+			b = append(b, v)
+		case []byte:
+			b = append(b, v...)
+		case [][]byte:
+			for _, s := range v {
+				b = append(b, s...)
+			}
+		case net.IP:
+			if v4 := v.To4(); v4 != nil {
+				v = v4
+			}
+			b = append(b, v...)
+		}
+	}
+	return b
+}
+
+// set is a flowset or set with its header.
+func set(id int, parts ...interface{}) []byte {
+	body := be(parts...)
+	return be(id, len(body)+4, body)
+}
+
+func v9(sets ...[]byte) []byte {
+	// version, count, uptime, secs, sequence, source ID.
+	return be(9, len(sets), uint32(1000), uint32(1500000000), uint32(1), uint32(7), sets)
+}
+
+func ipfix(sets ...[]byte) []byte {
+	body := be(sets)
+	// version, length, export time, sequence, domain.
+	return be(10, 16+len(body), uint32(1500000000), uint32(1), uint32(7), body)
+}
+
+func ip(s string) net.IP {
+	if v4 := net.ParseIP(s).To4(); v4 != nil {
+		return v4
+	}
+	return net.ParseIP(s)
+}
+
+func TestDecodeV5(t *testing.T) {
+	record := func(src string, dst string, in int, out int, pkts uint32, bytes uint32, sport int, dport int, proto byte) []byte {
+		return be(ip(src), ip(dst), ip("0.0.0.0"), in, out, pkts, bytes,
+			uint32(0), uint32(0), sport, dport, byte(0), byte(0x18), proto, byte(0x20), 65000, 65001, byte(24), byte(24), 0)
+	}
+	header := func(count int, sampling int) []byte {
+		return be(5, count, uint32(1000), uint32(1500000000), uint32(0), uint32(1), byte(0), byte(0), sampling)
+	}
+	records := be(record("10.1.1.1", "10.2.2.2", 5, 7, 10, 15000, 49152, 443, 6), record("10.3.3.3", "10.4.4.4", 6, 8, 1, 100, 53, 33000, 17))
+	want := []Flow{
+		{SrcAddr: ip("10.1.1.1"), DstAddr: ip("10.2.2.2"), Protocol: 6, TOS: 0x20, SrcPort: 49152, DstPort: 443, Input: 5, Output: 7, Bytes: 15000, Packets: 10, SamplingInterval: 100},
+		{SrcAddr: ip("10.3.3.3"), DstAddr: ip("10.4.4.4"), Protocol: 17, TOS: 0x20, SrcPort: 53, DstPort: 33000, Input: 6, Output: 8, Bytes: 100, Packets: 1, SamplingInterval: 100},
+	}
+
+	d := NewDecoder()
+	// deterministic sampling, 1 in 100.
+	got, err := d.Decode("10.0.0.1", be(header(2, 0x4064), records))
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v %v", got, err)
+	}
+
+	got, err = d.Decode("10.0.0.1", be(header(1, 0), records[:48]))
+	if err != nil || len(got) != 1 || got[0].SamplingInterval != 1 {
+		t.Errorf("unsampled: got %+v %v", got, err)
+	}
+
+	// more records than there are.
+	got, err = d.Decode("10.0.0.1", be(header(3, 0x4064), records))
+	if err == nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("short: got %+v %v", got, err)
+	}
+}
+
+// The v9 templates look like an IOS XE exporter's: 256 for IPv4 flows and
+// options template 257 with the sampling interval scoped to the system.
+var (
+	v9Template = set(0,
+		256, 10,
+		8, 4, 12, 4, 7, 2, 11, 2, 4, 1, 5, 1, 10, 2, 14, 2, 1, 4, 2, 4)
+	v9Options = set(1,
+		// template, scope length, option length, scope System, SAMPLING_INTERVAL.
+		257, 4, 4, 1, 4, 34, 4,
+		// padding.
+		0)
+	v9Sampling = set(257, uint32(0), uint32(1000), 0)
+	v9Data     = set(256,
+		ip("10.1.1.1"), ip("10.2.2.2"), 49152, 443, byte(6), byte(0x20), 5, 7, uint32(15000), uint32(10),
+		ip("10.3.3.3"), ip("10.4.4.4"), 53, 33000, byte(17), byte(0), 6, 8, uint32(100), uint32(1),
+		// padding.
+		0)
+	v9Flows = []Flow{
+		{SrcAddr: ip("10.1.1.1"), DstAddr: ip("10.2.2.2"), Protocol: 6, TOS: 0x20, SrcPort: 49152, DstPort: 443, Input: 5, Output: 7, Bytes: 15000, Packets: 10, SamplingInterval: 1000},
+		{SrcAddr: ip("10.3.3.3"), DstAddr: ip("10.4.4.4"), Protocol: 17, SrcPort: 53, DstPort: 33000, Input: 6, Output: 8, Bytes: 100, Packets: 1, SamplingInterval: 1000},
+	}
+)
+
+func TestDecodeV9(t *testing.T) {
+	d := NewDecoder()
+
+	// data before its template is dropped.
+	if got, err := d.Decode("10.0.0.1", v9(v9Data)); err != nil || len(got) != 0 {
+		t.Errorf("before the template: got %+v %v", got, err)
+	}
+
+	got, err := d.Decode("10.0.0.1", v9(v9Template, v9Options, v9Sampling, v9Data))
+	if err != nil || !reflect.DeepEqual(got, v9Flows) {
+		t.Errorf("got %+v %v", got, err)
+	}
+
+	// the templates and the sampling interval are remembered.
+	got, err = d.Decode("10.0.0.1", v9(v9Data))
+	if err != nil || !reflect.DeepEqual(got, v9Flows) {
+		t.Errorf("later: got %+v %v", got, err)
+	}
+
+	// but only for that exporter.
+	if got, err := d.Decode("10.0.0.2", v9(v9Data)); err != nil || len(got) != 0 {
+		t.Errorf("another exporter: got %+v %v", got, err)
+	}
+	got, err = d.Decode("10.0.0.2", v9(v9Template, v9Data))
+	if err != nil || len(got) != 2 || got[0].SamplingInterval != 1 {
+		t.Errorf("another exporter, unsampled: got %+v %v", got, err)
+	}
+}
+
+// The IPFIX template has IPv6 addresses, reduced size counters and
+// enterprise fields, fixed and variable length, to skip.
+var (
+	ipfixTemplate = set(2,
+		300, 10,
+		27, 16, 28, 16, 4, 1, 7, 2, 11, 2,
+		0x8000|1, 4, uint32(9),
+		85, 4, 86, 8,
+		0x8000|2, 65535, uint32(9),
+		10, 4)
+	ipfixOptions = set(3,
+		// template, field count, scope field count, meteringProcessId,
+		// samplingPacketInterval.
+		301, 2, 1, 143, 4, 305, 4)
+	ipfixSampling = set(301, uint32(1), uint32(512))
+	ipfixData     = set(300,
+		ip("2001:db8::1"), ip("2001:db8::2"), byte(6), 49152, 443, uint32(0xdeadbeef), uint32(15000), uint64(10),
+		byte(3), []byte("abc"), uint32(5),
+		ip("2001:db8::3"), ip("2001:db8::4"), byte(17), 53, 33000, uint32(0xdeadbeef), uint32(100), uint64(1),
+		byte(255), 300, make([]byte, 300), uint32(6))
+	ipfixFlows = []Flow{
+		{SrcAddr: ip("2001:db8::1"), DstAddr: ip("2001:db8::2"), Protocol: 6, SrcPort: 49152, DstPort: 443, Input: 5, Bytes: 15000, Packets: 10, SamplingInterval: 512},
+		{SrcAddr: ip("2001:db8::3"), DstAddr: ip("2001:db8::4"), Protocol: 17, SrcPort: 53, DstPort: 33000, Input: 6, Bytes: 100, Packets: 1, SamplingInterval: 512},
+	}
+)
+
+func TestDecodeIPFIX(t *testing.T) {
+	d := NewDecoder()
+	if got, err := d.Decode("10.0.0.1", ipfix(ipfixData)); err != nil || len(got) != 0 {
+		t.Errorf("before the template: got %+v %v", got, err)
+	}
+
+	got, err := d.Decode("10.0.0.1", ipfix(ipfixTemplate, ipfixOptions, ipfixSampling, ipfixData))
+	if err != nil || !reflect.DeepEqual(got, ipfixFlows) {
+		t.Errorf("got %+v %v", got, err)
+	}
+
+	got, err = d.Decode("10.0.0.1", ipfix(ipfixData))
+	if err != nil || !reflect.DeepEqual(got, ipfixFlows) {
+		t.Errorf("later: got %+v %v", got, err)
+	}
+
+	// withdrawn.
+	if got, err := d.Decode("10.0.0.1", ipfix(set(2, 300, 0))); err != nil || len(got) != 0 {
+		t.Errorf("withdrawal: got %+v %v", got, err)
+	}
+	if got, err := d.Decode("10.0.0.1", ipfix(ipfixData)); err != nil || len(got) != 0 {
+		t.Errorf("after the withdrawal: got %+v %v", got, err)
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	d := NewDecoder()
+	d.Decode("v9", v9(v9Template, v9Options, v9Sampling))
+	d.Decode("ipfix", ipfix(ipfixTemplate, ipfixOptions, ipfixSampling))
+	tests := []struct {
+		exporter string
+		b        []byte
+	}{
+		{"v9", v9(v9Template, v9Options, v9Sampling, v9Data)},
+		{"ipfix", ipfix(ipfixTemplate, ipfixOptions, ipfixSampling, ipfixData)},
+	}
+	for _, tt := range tests {
+		for i := 0; i < len(tt.b); i++ {
+			got, _ := d.Decode(tt.exporter, tt.b[:i])
+			if len(got) != 0 {
+				t.Errorf("%s: %d of %d bytes gave %+v", tt.exporter, i, len(tt.b), got)
+			}
+		}
+	}
+
+	bad := []struct {
+		name string
+		b    []byte
+	}{
+		{"flowset longer than the packet", be(v9(v9Data)[:20], 256, 100, make([]byte, 20))},
+		{"flowset shorter than its header", be(v9(v9Data)[:20], 256, 2)},
+		{"template with more fields than it has", v9(set(0, 258, 5, 8, 4))},
+		{"options template without its lengths", v9(set(1, 258, 4))},
+		{"enterprise field without its number", ipfix(set(2, 302, 1, 0x8001, 4))},
+		{"IPFIX length longer than the packet", be(10, 100, uint32(0), uint32(0), uint32(0))},
+		{"short header", []byte{0, 9, 0}},
+	}
+	for _, tt := range bad {
+		if _, err := NewDecoder().Decode("10.0.0.1", tt.b); err == nil {
+			t.Errorf("%s: decoded", tt.name)
+		}
+	}
+
+	// a record cut short at the end of its set is dropped.
+	got, err := d.Decode("v9", v9(set(256, v9Data[4:4+30])))
+	if err != nil || len(got) != 1 {
+		t.Errorf("partial record: got %+v %v", got, err)
+	}
+	got, err = d.Decode("ipfix", ipfix(set(300, ipfixData[4:len(ipfixData)-10])))
+	if err != nil || len(got) != 1 {
+		t.Errorf("partial variable length record: got %+v %v", got, err)
+	}
+}
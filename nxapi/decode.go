@@ -0,0 +1,303 @@
+package nxapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+/* Every list that comes back from NX-API is wrapped the same way:
+
+	"TABLE_rx_counters": {
+		"ROW_rx_counters": [ { ... }, { ... } ]
+	}
+
+except when there is only one row, in which case ROW_ is a single object
+instead of an array.  On top of that the N9K likes to split one interface
+across several rows (one with the byte counters, one with the packet counters)
+so rows have to be merged back together.
+
+DecodeTable and DecodeRow take care of all of that.  Struct fields are matched
+to NX-API keys by lower casing the field name (Eth_inbytes -> eth_inbytes), so
+most structs need no tags at all.  A tag can rename the key or add options:
+
+	Interface_rx string `nxapi:",key"`           // merge rows sharing this value
+	Desc         string `nxapi:"eth_desc"`       // different key than the field
+	Skipped      string `nxapi:"-"`              // never decoded
+
+A field that is a slice of structs is decoded as a nested TABLE_/ROW_ pair
+using the field's key as the table name.  A slice of strings takes a JSON
+list or a single string.
+*/
+
+// DecodeTable decodes TABLE_<name>/ROW_<name> found in body into the slice of
+// structs that v points to.  Rows are kept in the order the switch sent them.
+// A missing table is not an error, it just means the switch had nothing to
+// report.  When a value can't be converted the rest of the rows are still
+// decoded and the first error is returned.
+func DecodeTable(body interface{}, name string, v interface{}) error {
+	sp := reflect.ValueOf(v)
+	if sp.Kind() != reflect.Ptr || sp.Elem().Kind() != reflect.Slice || sp.Elem().Type().Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("nxapi: DecodeTable needs a pointer to a slice of structs, not %T", v)
+	}
+	return decodeTable(body, name, sp.Elem())
+}
+
+// DecodeRow copies the values in m into the struct v points to.  Keys that
+// aren't in m leave their fields alone, which is what lets us merge rows.
+func DecodeRow(m map[string]interface{}, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("nxapi: DecodeRow needs a pointer to a struct, not %T", v)
+	}
+	return decodeRow(m, rv.Elem())
+}
+
+// Rows returns the raw rows of TABLE_<name>/ROW_<name> in body, smoothing over
+// the single object vs. array difference.
+func Rows(body interface{}, name string) []map[string]interface{} {
+	b, ok := body.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	t, ok := b["TABLE_"+name].(map[string]interface{})
+	if !ok {
+		return nil
+	}
+	switch r := t["ROW_"+name].(type) {
+	case map[string]interface{}:
+		return []map[string]interface{}{r}
+	case []interface{}:
+		rows := make([]map[string]interface{}, 0, len(r))
+		for _, row := range r {
+			if m, ok := row.(map[string]interface{}); ok {
+				rows = append(rows, m)
+			}
+		}
+		return rows
+	}
+	return nil
+}
+
+func decodeTable(body interface{}, name string, slice reflect.Value) error {
+	var firstErr error
+	key := ""
+	for _, f := range fields(slice.Type().Elem()) {
+		if f.key {
+			key = f.name
+		}
+	}
+	// where we put each key so duplicate rows land on the same element.
+	seen := map[string]int{}
+	for _, row := range Rows(body, name) {
+		var err error
+		// rows without the key can't be merged with anything.
+		if key != "" && row[key] != nil {
+			k := fmt.Sprint(row[key])
+			if i, ok := seen[k]; ok {
+				err = decodeRow(row, slice.Index(i))
+			} else {
+				slice.Set(reflect.Append(slice, reflect.New(slice.Type().Elem()).Elem()))
+				seen[k] = slice.Len() - 1
+				err = decodeRow(row, slice.Index(slice.Len()-1))
+			}
+		} else {
+			slice.Set(reflect.Append(slice, reflect.New(slice.Type().Elem()).Elem()))
+			err = decodeRow(row, slice.Index(slice.Len()-1))
+		}
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("nxapi: TABLE_%s: %v", name, err)
+		}
+	}
+	return firstErr
+}
+
+func decodeRow(m map[string]interface{}, s reflect.Value) error {
+	var firstErr error
+	for _, f := range fields(s.Type()) {
+		fv := s.Field(f.index)
+		if fv.Kind() == reflect.Slice && fv.Type().Elem().Kind() == reflect.Struct {
+			if err := decodeTable(m, f.name, fv); err != nil && firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		val, ok := m[f.name]
+		if !ok || val == nil {
+			continue
+		}
+		if err := setValue(fv, val); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("%s: %v", f.name, err)
+		}
+	}
+	return firstErr
+}
+
+type field struct {
+	index int
+	name  string
+	key   bool
+}
+
+func fields(t reflect.Type) []field {
+	var fs []field
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.PkgPath != "" {
+			continue
+		}
+		tag := sf.Tag.Get("nxapi")
+		if tag == "-" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		f := field{index: i, name: parts[0]}
+		if f.name == "" {
+			f.name = strings.ToLower(sf.Name)
+		}
+		for _, opt := range parts[1:] {
+			if opt == "key" {
+				f.key = true
+			}
+		}
+		fs = append(fs, f)
+	}
+	return fs
+}
+
+// setValue converts whatever JSON gave us into the field's type.  NX-API is
+// not consistent about quoting numbers so strings and numbers go both ways.
+func setValue(fv reflect.Value, val interface{}) error {
+	switch fv.Kind() {
+	case reflect.String:
+		switch x := val.(type) {
+		case string:
+			fv.SetString(x)
+		case float64:
+			fv.SetString(strconv.FormatFloat(x, 'f', -1, 64))
+		case json.Number:
+			fv.SetString(x.String())
+		case bool:
+			fv.SetString(strconv.FormatBool(x))
+		default:
+			return fmt.Errorf("can't use %T as a string", val)
+		}
+	case reflect.Float32, reflect.Float64:
+		f, err := toFloat(val)
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if s, ok := numberString(val); ok {
+			i, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+			if err == nil {
+				if fv.OverflowInt(i) {
+					return fmt.Errorf("%v overflows %s", val, fv.Type())
+				}
+				fv.SetInt(i)
+				return nil
+			}
+		}
+		f, err := toFloat(val)
+		if err != nil {
+			return err
+		}
+		if f < math.MinInt64 || f >= math.MaxInt64 || fv.OverflowInt(int64(f)) {
+			return fmt.Errorf("%v overflows %s", val, fv.Type())
+		}
+		fv.SetInt(int64(f))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if s, ok := numberString(val); ok {
+			// big counters lose precision as floats so parse these directly.
+			u, err := strconv.ParseUint(strings.TrimSpace(s), 10, 64)
+			if err == nil {
+				if fv.OverflowUint(u) {
+					return fmt.Errorf("%v overflows %s", val, fv.Type())
+				}
+				fv.SetUint(u)
+				return nil
+			}
+		}
+		f, err := toFloat(val)
+		if err != nil {
+			return err
+		}
+		if f < 0 {
+			return fmt.Errorf("%v is negative", val)
+		}
+		if f >= math.MaxUint64 || fv.OverflowUint(uint64(f)) {
+			return fmt.Errorf("%v overflows %s", val, fv.Type())
+		}
+		fv.SetUint(uint64(f))
+	case reflect.Bool:
+		switch x := val.(type) {
+		case bool:
+			fv.SetBool(x)
+		case string:
+			b, err := strconv.ParseBool(strings.TrimSpace(x))
+			if err != nil {
+				return err
+			}
+			fv.SetBool(b)
+		default:
+			return fmt.Errorf("can't use %T as a bool", val)
+		}
+	case reflect.Slice:
+		if fv.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported field type %s", fv.Type())
+		}
+		// lists of words (CDP capabilities) come back as a plain string
+		// when there is only one.
+		list, ok := val.([]interface{})
+		if !ok {
+			list = []interface{}{val}
+		}
+		strs := reflect.MakeSlice(fv.Type(), len(list), len(list))
+		for i, x := range list {
+			if err := setValue(strs.Index(i), x); err != nil {
+				return err
+			}
+		}
+		fv.Set(strs)
+	default:
+		return fmt.Errorf("unsupported field type %s", fv.Type())
+	}
+	return nil
+}
+
+// numberString is val as text if it came as a string or a json.Number, so
+// integers can be parsed without going through a float64.
+func numberString(val interface{}) (string, bool) {
+	switch x := val.(type) {
+	case string:
+		return x, true
+	case json.Number:
+		return x.String(), true
+	}
+	return "", false
+}
+
+func toFloat(val interface{}) (float64, error) {
+	switch x := val.(type) {
+	case float64:
+		return x, nil
+	case json.Number:
+		return x.Float64()
+	case string:
+		s := strings.TrimSpace(x)
+		if s == "" {
+			return 0, nil
+		}
+		return strconv.ParseFloat(s, 64)
+	case bool:
+		if x {
+			return 1, nil
+		}
+		return 0, nil
+	}
+	return 0, fmt.Errorf("can't use %T as a number", val)
+}
@@ -0,0 +1,149 @@
+package nxapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// body parses a JSON body the way it comes back from the switch.
+func body(t *testing.T, s string) map[string]interface{} {
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+type testRow struct {
+	Name  string `nxapi:",key"`
+	Count uint64
+	Delta int
+	Rate  float64
+	Up    bool
+	Tags  []string
+}
+
+type testOuter struct {
+	Name  string
+	Inner []testInner `nxapi:"inner"`
+}
+
+type testInner struct {
+	Value string
+}
+
+func TestDecodeTable(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want []testRow
+	}{
+		{
+			name: "single row",
+			body: `{"TABLE_row": {"ROW_row": {"name": "a", "count": 1}}}`,
+			want: []testRow{{Name: "a", Count: 1}},
+		},
+		{
+			name: "array of rows",
+			body: `{"TABLE_row": {"ROW_row": [{"name": "a", "count": 1}, {"name": "b", "count": 2}]}}`,
+			want: []testRow{{Name: "a", Count: 1}, {Name: "b", Count: 2}},
+		},
+		{
+			name: "rows merged on the key",
+			body: `{"TABLE_row": {"ROW_row": [{"name": "a", "count": 1}, {"name": "b"}, {"name": "a", "delta": -3}]}}`,
+			want: []testRow{{Name: "a", Count: 1, Delta: -3}, {Name: "b"}},
+		},
+		{
+			name: "rows without the key are not merged",
+			body: `{"TABLE_row": {"ROW_row": [{"count": 1}, {"count": 2}]}}`,
+			want: []testRow{{Count: 1}, {Count: 2}},
+		},
+		{
+			name: "quoted and unquoted numbers",
+			body: `{"TABLE_row": {"ROW_row": [{"name": "a", "count": "18446744073709551615", "delta": "-7", "rate": "1.5"}, {"name": "b", "count": 42, "delta": 7, "rate": 2.5}]}}`,
+			want: []testRow{{Name: "a", Count: 18446744073709551615, Delta: -7, Rate: 1.5}, {Name: "b", Count: 42, Delta: 7, Rate: 2.5}},
+		},
+		{
+			name: "bools",
+			body: `{"TABLE_row": {"ROW_row": [{"name": "a", "up": true}, {"name": "b", "up": "true"}]}}`,
+			want: []testRow{{Name: "a", Up: true}, {Name: "b", Up: true}},
+		},
+		{
+			name: "string list from a string",
+			body: `{"TABLE_row": {"ROW_row": [{"name": "a", "tags": "Router"}, {"name": "b", "tags": ["Router", "Switch"]}]}}`,
+			want: []testRow{{Name: "a", Tags: []string{"Router"}}, {Name: "b", Tags: []string{"Router", "Switch"}}},
+		},
+		{
+			name: "missing table",
+			body: `{}`,
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		var got []testRow
+		if err := DecodeTable(body(t, tt.body), "row", &got); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %+v, want %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeNestedTable(t *testing.T) {
+	b := body(t, `{"TABLE_outer": {"ROW_outer": [
+		{"name": "x", "TABLE_inner": {"ROW_inner": {"value": "1"}}},
+		{"name": "y", "TABLE_inner": {"ROW_inner": [{"value": "2"}, {"value": "3"}]}}
+	]}}`)
+	var got []testOuter
+	if err := DecodeTable(b, "outer", &got); err != nil {
+		t.Fatal(err)
+	}
+	want := []testOuter{
+		{Name: "x", Inner: []testInner{{"1"}}},
+		{Name: "y", Inner: []testInner{{"2"}, {"3"}}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestDecodeOverflow(t *testing.T) {
+	type small struct {
+		I8  int8
+		U8  uint8
+		U64 uint64
+		I64 int64
+	}
+	for _, row := range []string{
+		`{"i8": 300}`,
+		`{"i8": "-129"}`,
+		`{"u8": 256}`,
+		`{"u8": "256"}`,
+		`{"u64": -1}`,
+		`{"u64": 1e20}`,
+		`{"i64": 1e19}`,
+	} {
+		var s small
+		if err := DecodeRow(body(t, row), &s); err == nil {
+			t.Errorf("%s: no error, decoded %+v", row, s)
+		}
+	}
+	var s small
+	if err := DecodeRow(body(t, `{"i8": -128, "u8": "255"}`), &s); err != nil || s.I8 != -128 || s.U8 != 255 {
+		t.Errorf("in range: %+v %v", s, err)
+	}
+}
+
+func TestDecodeErrorsKeepGoing(t *testing.T) {
+	var got []testRow
+	err := DecodeTable(body(t, `{"TABLE_row": {"ROW_row": [{"name": "a", "count": "lots"}, {"name": "b", "count": 2}]}}`), "row", &got)
+	if err == nil {
+		t.Error("no error for a bad count")
+	}
+	if len(got) != 2 || got[1].Count != 2 {
+		t.Errorf("rest of the rows not decoded: %+v", got)
+	}
+}
@@ -0,0 +1,77 @@
+package nxapi
+
+// SystemResources is the output of "show system resources".  CPU is in
+// percent, memory in KB.
+type SystemResources struct {
+	Load_Avg_1min      float64
+	Load_Avg_5min      float64
+	Load_Avg_15min     float64
+	Cpu_State_User     float64
+	Cpu_State_Kernel   float64
+	Cpu_State_Idle     float64
+	Memory_Usage_Total uint64
+	Memory_Usage_Used  uint64
+	Memory_Usage_Free  uint64
+	Cpu_Usage          []CPUUsage
+}
+
+// CPUUsage is one core in show system resources.
+type CPUUsage struct {
+	Cpuid  string
+	User   float64
+	Kernel float64
+	Idle   float64
+}
+
+func NewSystemResources(m map[string]interface{}) (SystemResources, error) {
+	r := SystemResources{}
+	err := DecodeRow(m, &r)
+	return r, err
+}
+
+// Environment is the output of "show environment".  The fan and power
+// supply tables are one level further down than the temperatures.
+type Environment struct {
+	Temperatures  []Temperature
+	Fans          []Fan
+	PowerSupplies []PowerSupply
+}
+
+// Temperature readings are strings because sensors that aren't there
+// read "--".
+type Temperature struct {
+	Tempmod     string
+	Sensor      string
+	Majthres    string
+	Minthres    string
+	Curtemp     string
+	Alarmstatus string
+}
+
+type Fan struct {
+	Fanname   string
+	Fanmodel  string
+	Fanstatus string
+}
+
+// PowerSupply readings come with their units (91 W).
+type PowerSupply struct {
+	Psnum        string
+	Psmodel      string
+	Actual_Out   string
+	Actual_Input string
+	Tot_Capa     string
+	Ps_Status    string
+}
+
+func NewEnvironment(m map[string]interface{}) (Environment, error) {
+	e := Environment{}
+	err := DecodeTable(m, "tempinfo", &e.Temperatures)
+	if fanErr := DecodeTable(m["fandetails"], "faninfo", &e.Fans); err == nil {
+		err = fanErr
+	}
+	if psErr := DecodeTable(m["powersup"], "psinfo", &e.PowerSupplies); err == nil {
+		err = psErr
+	}
+	return e, err
+}
@@ -0,0 +1,14 @@
+package nxapi
+
+// SNMPIfIndex is one row of "show interface snmp-ifindex", which ties the
+// interface names NX-API uses to the ifIndexes SNMP uses.
+type SNMPIfIndex struct {
+	Interface    string
+	Snmp_Ifindex string `nxapi:"snmp-ifindex"`
+}
+
+func NewSNMPIfIndexes(m map[string]interface{}) ([]SNMPIfIndex, error) {
+	var s []SNMPIfIndex
+	err := DecodeTable(m, "interface", &s)
+	return s, err
+}
@@ -0,0 +1,17 @@
+package nxapi
+
+// InventoryItem is one row of "show inventory".  Vendorid is the version ID
+// printed on the part, not the manufacturer.
+type InventoryItem struct {
+	Name      string
+	Desc      string
+	Productid string
+	Vendorid  string
+	Serialnum string
+}
+
+func NewInventory(m map[string]interface{}) ([]InventoryItem, error) {
+	var i []InventoryItem
+	err := DecodeTable(m, "inv", &i)
+	return i, err
+}
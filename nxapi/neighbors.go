@@ -0,0 +1,49 @@
+package nxapi
+
+import "strings"
+
+// LLDPNeighbor is one row of "show lldp neighbors detail".
+type LLDPNeighbor struct {
+	Chassis_Type       string
+	Chassis_Id         string
+	Port_Type          string
+	Port_Id            string
+	L_Port_Id          string
+	Port_Desc          string
+	Sys_Name           string
+	Sys_Desc           string
+	Enabled_Capability string
+	Mgmt_Addr          string
+	Mgmt_Addr_Ipv6     string
+}
+
+func NewLLDPNeighbors(m map[string]interface{}) ([]LLDPNeighbor, error) {
+	var n []LLDPNeighbor
+	err := DecodeTable(m, "nbor_detail", &n)
+	return n, err
+}
+
+// LocalPort is the name of our port the way show interface has it.  LLDP
+// abbreviates it (Eth1/1).
+func (n LLDPNeighbor) LocalPort() string {
+	return CLIName(strings.ToLower(n.L_Port_Id))
+}
+
+// CDPNeighbor is one row of "show cdp neighbors detail".
+type CDPNeighbor struct {
+	Device_Id   string
+	Sysname     string
+	Platform_Id string
+	Capability  []string
+	Intf_Id     string
+	Port_Id     string
+	Version     string
+	V4addr      string
+	V4mgmtaddr  string
+}
+
+func NewCDPNeighbors(m map[string]interface{}) ([]CDPNeighbor, error) {
+	var n []CDPNeighbor
+	err := DecodeTable(m, "cdp_neighbor_detail_info", &n)
+	return n, err
+}
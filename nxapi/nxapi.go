@@ -1,5 +1,10 @@
 package nxapi
 
+import (
+	"sort"
+	"time"
+)
+
 /* These structures show the type of response we get back from
 The NXAPI.  This could be quite big.  The Output is the same up until the
 body.  That is where the outputs differ depending on which command is given.
@@ -22,10 +27,14 @@ type Output struct {
 	Body  map[string]interface{}
 }
 
+// Version is the output of "show version".  Older releases (n5k, n7k) report
+// the running image in sys_ver_str, the n9k uses nxos_ver_str.
 type Version struct {
 	Header_Str        string
 	Bios_Ver_Str      string
 	Kickstart_Ver_Str string
+	Sys_Ver_Str       string
+	Nxos_Ver_Str      string
 	Bios_Cmpl_Time    string
 	Kick_File_Name    string
 	Kick_Cmpl_Time    string
@@ -39,39 +48,66 @@ type Version struct {
 	Bootflash_Size    int
 	Kern_Uptm_Days    int
 	Kern_Uptm_Hrs     int
-	Kern_Uptm_Min     int
+	Kern_Uptm_Min     int `nxapi:"kern_uptm_mins"`
 	Kern_Uptm_Secs    int
+	Rr_Usecs          int
+	Rr_Ctime          string
 	Rr_Reason         string
 	Rr_Sys_Ver        string
 	Rr_Service        string
 	Manufacturer      string
 }
 
-func NewVersion(m map[string]string) Version {
+func NewVersion(m map[string]interface{}) (Version, error) {
+	v := Version{}
+	err := DecodeRow(m, &v)
+	return v, err
+}
 
-	v := Version{
-		Host_Name: m["host_name"],
+// OSVersion is the version of NX-OS the switch is running.
+func (v Version) OSVersion() string {
+	if v.Nxos_Ver_Str != "" {
+		return v.Nxos_Ver_Str
 	}
-	return v
+	if v.Sys_Ver_Str != "" {
+		return v.Sys_Ver_Str
+	}
+	return v.Kickstart_Ver_Str
 }
 
-// Can this get any uglier?  Why is there no better way to map
-// an interface to a complex structure?  Is this because my structure
-// is too complicated?  Maybe.
+// Uptime is how long the kernel has been up.
+func (v Version) Uptime() time.Duration {
+	return time.Duration(v.Kern_Uptm_Days)*24*time.Hour +
+		time.Duration(v.Kern_Uptm_Hrs)*time.Hour +
+		time.Duration(v.Kern_Uptm_Min)*time.Minute +
+		time.Duration(v.Kern_Uptm_Secs)*time.Second
+}
 
+// InterfaceCounters is the output of "show interface counters".  The RX
+// and TX tables are keyed by interface name.
 type InterfaceCounters struct {
 	RX_Table TABLE_rx_counters
 	TX_Table TABLE_tx_counters
 }
 
-func NewInterfaceCounters(m map[string]interface{}) InterfaceCounters {
-	//fmt.Println("RX TABLE: ", m["TABLE_rx_counters"], "\n\n")
-	//fmt.Println("TX Counters: ", m["TABLE_tx_counters"])
+func NewInterfaceCounters(m map[string]interface{}) (InterfaceCounters, error) {
+	var rx []ROW_rx_counters
+	var tx []ROW_tx_counters
+	err := DecodeTable(m, "rx_counters", &rx)
+	if txErr := DecodeTable(m, "tx_counters", &tx); err == nil {
+		err = txErr
+	}
 	i := InterfaceCounters{
-		RX_Table: NewTableRXCounters(m["TABLE_rx_counters"]),
-		TX_Table: NewTableTXCounters(m["TABLE_tx_counters"]),
+		RX_Table: TABLE_rx_counters{Row: map[string]ROW_rx_counters{}},
+		TX_Table: TABLE_tx_counters{Row: map[string]ROW_tx_counters{}},
+	}
+	for _, r := range rx {
+		i.RX_Table.Row[r.Interface_rx] = r
 	}
-	return i
+	for _, t := range tx {
+		i.TX_Table.Row[t.Interface_tx] = t
+	}
+	return i, err
 }
 
 type TABLE_rx_counters struct {
@@ -82,146 +118,119 @@ type TABLE_tx_counters struct {
 	Row map[string]ROW_tx_counters
 }
 
-func NewTableRXCounters(i interface{}) TABLE_rx_counters {
-	r := map[string]ROW_rx_counters{}
-	tempHash := map[string]map[string]interface{}{}
-	ifaceMap, ok := i.(map[string]interface{})
-	if !ok {
-		return TABLE_rx_counters{}
-	}
-	ifaceArray := ifaceMap["ROW_rx_counters"].([]interface{})
-	//fmt.Println(ifaceArray)
-	for _, arrValue := range ifaceArray {
-		a := arrValue.(map[string]interface{})
-		//fmt.Println(a)
-		iface := a["interface_rx"].(string)
-		// Every value has the interface but for whatever reason the
-		// n9 returns two hashes of the same interface.
-		// therefore we have to go through the whole thing and put it
-		// in a hash and then once its all filled out, push it to a structure.
-		// Why?  cause Go doesn't let us modify structures unless we right
-		// a bunch of Set routines...
-		if tempHash[iface] != nil {
-			tempHash[iface]["Interface_rx"] = iface
-		} else {
-			tempHash[iface] = map[string]interface{}{}
-			tempHash[iface]["Interface_rx"] = iface
-		}
-
-		metrics := map[string]string{
-			"eth_inbytes": "Eth_inbytes",
-			"eth_inucast": "Eth_inucast",
-			"eth_inmcast": "Eth_inmcast",
-			"eth_inbcast": "Eth_inbcast",
-			"eth_inpkts":  "Eth_inpkts",
-		}
-		for metric, hashKey := range metrics {
-			if val, ok := a[metric]; ok {
-				tempHash[iface][hashKey] = val.(float64)
-			} else {
-				if tempHash[iface][hashKey] == nil {
-					tempHash[iface][hashKey] = float64(0)
-				}
-			}
-		}
-	}
-
-	// once we're done with all the interfaces:
-	for k, v := range tempHash {
+// The n9k returns two rows for the same interface, one with the byte counters
+// and one with the packet counters, so these are merged on the interface name.
+// Counters are uint64 because as floats the big ones lose their low digits.
+type ROW_rx_counters struct {
+	Interface_rx string `nxapi:",key"`
+	Eth_inbytes  uint64
+	Eth_inpkts   uint64
+	Eth_inucast  uint64
+	Eth_inmcast  uint64
+	Eth_inbcast  uint64
+}
 
-		r[k] = ROW_rx_counters{
-			Interface_rx: v["Interface_rx"].(string),
-			Eth_inbytes:  v["Eth_inbytes"].(float64),
-			Eth_inpkts:   v["Eth_inpkts"].(float64),
-			Eth_inucast:  v["Eth_inucast"].(float64),
-			Eth_inmcast:  v["Eth_inmcast"].(float64),
-			Eth_inbcast:  v["Eth_inbcast"].(float64),
-		}
-	}
-	//fmt.Println(ifaceArray)
-	return TABLE_rx_counters{
-		Row: r,
-	}
+type ROW_tx_counters struct {
+	Interface_tx string `nxapi:",key"`
+	Eth_outpkts  uint64
+	Eth_outbytes uint64
+	Eth_outucast uint64
+	Eth_outmcast uint64
+	Eth_outbcast uint64
 }
 
-type ROW_rx_counters struct {
-	Interface_rx string
-	Eth_inbytes  float64
-	Eth_inpkts   float64
-	Eth_inucast  float64
-	Eth_inmcast  float64
-	Eth_inbcast  float64
-}
-
-// This is lame because this entire function is a copy of the
-// other NewTableRXCounters.  This is definitely not DRY.
-// I hang my head in shame.
-func NewTableTXCounters(i interface{}) TABLE_tx_counters {
-	r := map[string]ROW_tx_counters{}
-	tempHash := map[string]map[string]interface{}{}
-	ifaceMap, ok := i.(map[string]interface{})
-	if !ok {
-		return TABLE_tx_counters{}
-	}
-	ifaceArray := ifaceMap["ROW_tx_counters"].([]interface{})
-	//fmt.Println(ifaceArray)
-	for _, arrValue := range ifaceArray {
-		a := arrValue.(map[string]interface{})
-		//fmt.Println(a)
-		iface := a["interface_tx"].(string)
-		// Every value has the interface but for whatever reason the
-		// n9 returns two hashes of the same interface.
-		// therefore we have to go through the whole thing and put it
-		// in a hash and then once its all filled out, push it to a structure.
-		// Why?  cause Go doesn't let us modify structures unless we right
-		// a bunch of Set routines...
-		if tempHash[iface] != nil {
-			tempHash[iface]["Interface_tx"] = iface
-		} else {
-			tempHash[iface] = map[string]interface{}{}
-			tempHash[iface]["Interface_tx"] = iface
-		}
+// InterfaceCounter is one interface's RX and TX counters side by side.
+type InterfaceCounter struct {
+	Interface    string
+	Eth_inbytes  uint64
+	Eth_inpkts   uint64
+	Eth_inucast  uint64
+	Eth_inmcast  uint64
+	Eth_inbcast  uint64
+	Eth_outbytes uint64
+	Eth_outpkts  uint64
+	Eth_outucast uint64
+	Eth_outmcast uint64
+	Eth_outbcast uint64
+}
 
-		metrics := map[string]string{
-			"eth_outbytes": "Eth_outbytes",
-			"eth_outpkts":  "Eth_outpkts",
-			"eth_outucast": "Eth_outucast",
-			"eth_outmcast": "Eth_outmcast",
-			"eth_outbcast": "Eth_outbcast",
-		}
-		for metric, hashKey := range metrics {
-			if val, ok := a[metric]; ok {
-				tempHash[iface][hashKey] = val.(float64)
-			} else {
-				if tempHash[iface][hashKey] == nil {
-					tempHash[iface][hashKey] = float64(0)
-				}
-			}
-		}
+// Merged joins the RX and TX tables on the interface name.  An interface that
+// only shows up in one of the tables still gets a row with the other
+// direction left at zero.  Rows are sorted by interface name.
+func (i InterfaceCounters) Merged() []InterfaceCounter {
+	names := []string{}
+	for name := range i.RX_Table.Row {
+		names = append(names, name)
 	}
-
-	// once we're done with all the interfaces:
-	for k, v := range tempHash {
-
-		r[k] = ROW_tx_counters{
-			Interface_tx: v["Interface_tx"].(string),
-			Eth_outbytes: v["Eth_outbytes"].(float64),
-			Eth_outucast: v["Eth_outucast"].(float64),
-			Eth_outmcast: v["Eth_outmcast"].(float64),
-			Eth_outbcast: v["Eth_outbcast"].(float64),
+	for name := range i.TX_Table.Row {
+		if _, ok := i.RX_Table.Row[name]; !ok {
+			names = append(names, name)
 		}
 	}
-	//fmt.Println(ifaceArray)
-	return TABLE_tx_counters{
-		Row: r,
+	sort.Strings(names)
+
+	merged := make([]InterfaceCounter, 0, len(names))
+	for _, name := range names {
+		rx := i.RX_Table.Row[name]
+		tx := i.TX_Table.Row[name]
+		merged = append(merged, InterfaceCounter{
+			Interface:    name,
+			Eth_inbytes:  rx.Eth_inbytes,
+			Eth_inpkts:   rx.Eth_inpkts,
+			Eth_inucast:  rx.Eth_inucast,
+			Eth_inmcast:  rx.Eth_inmcast,
+			Eth_inbcast:  rx.Eth_inbcast,
+			Eth_outbytes: tx.Eth_outbytes,
+			Eth_outpkts:  tx.Eth_outpkts,
+			Eth_outucast: tx.Eth_outucast,
+			Eth_outmcast: tx.Eth_outmcast,
+			Eth_outbcast: tx.Eth_outbcast,
+		})
 	}
+	return merged
 }
 
-type ROW_tx_counters struct {
-	Interface_tx string
-	Eth_outpkts  float64
-	Eth_outbytes float64
-	Eth_outucast float64
-	Eth_outmcast float64
-	Eth_outbcast float64
+// Interface is one row of "show interface".  mgmt0 and port-channels come
+// back in the same table with a few fields missing, which just leaves them
+// zero.
+type Interface struct {
+	Interface         string `nxapi:",key"`
+	State             string
+	State_Rsn_Desc    string
+	Admin_State       string
+	Desc              string
+	Eth_Hw_Desc       string
+	Eth_Hw_Addr       string
+	Eth_Mtu           int
+	Eth_Bw            uint64
+	Eth_Duplex        string
+	Eth_Speed         string
+	Eth_Link_Flapped  string
+	Eth_Inrate1_Bits  uint64
+	Eth_Inrate1_Pkts  uint64
+	Eth_Outrate1_Bits uint64
+	Eth_Outrate1_Pkts uint64
+	Eth_Inucast       uint64
+	Eth_Inmcast       uint64
+	Eth_Inbcast       uint64
+	Eth_Inpkts        uint64
+	Eth_Inbytes       uint64
+	Eth_Runts         uint64
+	Eth_Giants        uint64
+	Eth_Crc           uint64
+	Eth_Inerr         uint64
+	Eth_Indiscard     uint64
+	Eth_Outucast      uint64
+	Eth_Outmcast      uint64
+	Eth_Outbcast      uint64
+	Eth_Outpkts       uint64
+	Eth_Outbytes      uint64
+	Eth_Outerr        uint64
+	Eth_Outdiscard    uint64
+}
+
+func NewInterfaces(m map[string]interface{}) ([]Interface, error) {
+	var i []Interface
+	err := DecodeTable(m, "interface", &i)
+	return i, err
 }
@@ -0,0 +1,145 @@
+package nxapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// numberBody parses a body the way doJSON does, numbers as json.Number.
+func numberBody(t *testing.T, s string) map[string]interface{} {
+	d := json.NewDecoder(bytes.NewReader([]byte(s)))
+	d.UseNumber()
+	var m map[string]interface{}
+	if err := d.Decode(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+// show interface counters from an N9K running 7.0(3)I7, which splits each
+// interface across a byte row and a packet row.  Trimmed to two ports.
+const n9kCounters = `{
+  "TABLE_rx_counters": {
+    "ROW_rx_counters": [
+      {"interface_rx": "mgmt0", "eth_inbytes": 2061366451},
+      {"interface_rx": "mgmt0", "eth_inucast": 3316254, "eth_inmcast": 1873931, "eth_inbcast": 71270},
+      {"interface_rx": "Ethernet1/1", "eth_inbytes": 18446744073709551000},
+      {"interface_rx": "Ethernet1/1", "eth_inucast": 9007199254740993, "eth_inmcast": 120, "eth_inbcast": 4}
+    ]
+  },
+  "TABLE_tx_counters": {
+    "ROW_tx_counters": [
+      {"interface_tx": "mgmt0", "eth_outbytes": 306291436},
+      {"interface_tx": "mgmt0", "eth_outucast": 1411383, "eth_outmcast": 8210, "eth_outbcast": 14},
+      {"interface_tx": "Ethernet1/1", "eth_outbytes": "9007199254740993"},
+      {"interface_tx": "Ethernet1/1", "eth_outucast": 77, "eth_outmcast": 3, "eth_outbcast": 0}
+    ]
+  }
+}`
+
+// An N5K with one interface, so the rows are objects rather than arrays
+// and everything comes in one row.
+const n5kCounters = `{
+  "TABLE_rx_counters": {
+    "ROW_rx_counters": {"interface_rx": "Ethernet1/1", "eth_inpkts": 5012, "eth_inbytes": 634210, "eth_inucast": 5000, "eth_inmcast": 10, "eth_inbcast": 2}
+  },
+  "TABLE_tx_counters": {
+    "ROW_tx_counters": {"interface_tx": "Ethernet1/1", "eth_outpkts": 4123, "eth_outbytes": 512348, "eth_outucast": 4100, "eth_outmcast": 20, "eth_outbcast": 3}
+  }
+}`
+
+// A loopback-like interface only in RX and a port-channel only in TX.
+const oneSidedCounters = `{
+  "TABLE_rx_counters": {
+    "ROW_rx_counters": [
+      {"interface_rx": "Ethernet1/2", "eth_inbytes": 100, "eth_inucast": 1}
+    ]
+  },
+  "TABLE_tx_counters": {
+    "ROW_tx_counters": [
+      {"interface_tx": "port-channel10", "eth_outbytes": 200, "eth_outucast": 2}
+    ]
+  }
+}`
+
+func TestInterfaceCountersN9K(t *testing.T) {
+	c, err := NewInterfaceCounters(numberBody(t, n9kCounters))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []InterfaceCounter{
+		{
+			Interface:    "Ethernet1/1",
+			Eth_inbytes:  18446744073709551000,
+			Eth_inucast:  9007199254740993,
+			Eth_inmcast:  120,
+			Eth_inbcast:  4,
+			Eth_outbytes: 9007199254740993,
+			Eth_outucast: 77,
+			Eth_outmcast: 3,
+		},
+		{
+			Interface:    "mgmt0",
+			Eth_inbytes:  2061366451,
+			Eth_inucast:  3316254,
+			Eth_inmcast:  1873931,
+			Eth_inbcast:  71270,
+			Eth_outbytes: 306291436,
+			Eth_outucast: 1411383,
+			Eth_outmcast: 8210,
+			Eth_outbcast: 14,
+		},
+	}
+	if got := c.Merged(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestInterfaceCountersSingleRow(t *testing.T) {
+	c, err := NewInterfaceCounters(numberBody(t, n5kCounters))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []InterfaceCounter{{
+		Interface:    "Ethernet1/1",
+		Eth_inbytes:  634210,
+		Eth_inpkts:   5012,
+		Eth_inucast:  5000,
+		Eth_inmcast:  10,
+		Eth_inbcast:  2,
+		Eth_outbytes: 512348,
+		Eth_outpkts:  4123,
+		Eth_outucast: 4100,
+		Eth_outmcast: 20,
+		Eth_outbcast: 3,
+	}}
+	if got := c.Merged(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestInterfaceCountersOneSided(t *testing.T) {
+	c, err := NewInterfaceCounters(numberBody(t, oneSidedCounters))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []InterfaceCounter{
+		{Interface: "Ethernet1/2", Eth_inbytes: 100, Eth_inucast: 1},
+		{Interface: "port-channel10", Eth_outbytes: 200, Eth_outucast: 2},
+	}
+	if got := c.Merged(); !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+}
+
+func TestInterfaceCountersEmpty(t *testing.T) {
+	c, err := NewInterfaceCounters(numberBody(t, `{}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := c.Merged(); len(got) != 0 {
+		t.Errorf("got %+v", got)
+	}
+}
@@ -0,0 +1,51 @@
+package nxapi
+
+// PortChannel is one row of "show port-channel summary".
+type PortChannel struct {
+	Group        string
+	Port_Channel string `nxapi:"port-channel"`
+	Status       string
+	Prtcl        string
+	Member       []PortChannelMember
+}
+
+// PortChannelMember status is P when it is bundled, D down, I individual,
+// s suspended and so on.
+type PortChannelMember struct {
+	Port        string
+	Port_Status string `nxapi:"port-status"`
+}
+
+func NewPortChannels(m map[string]interface{}) ([]PortChannel, error) {
+	var p []PortChannel
+	err := DecodeTable(m, "channel", &p)
+	return p, err
+}
+
+// VPCBrief is the output of "show vpc brief".  Interfaces are abbreviated
+// (Po20).
+type VPCBrief struct {
+	Vpc_Domain_Id   string `nxapi:"vpc-domain-id"`
+	Vpc_Peer_Status string `nxapi:"vpc-peer-status"`
+	Vpc_Role        string `nxapi:"vpc-role"`
+	Peerlink        []VPCPeerLink
+	Vpc             []VPC
+}
+
+type VPCPeerLink struct {
+	Peer_Link_Id     string `nxapi:"peer-link-id"`
+	Peerlink_Ifindex string `nxapi:"peerlink-ifindex"`
+}
+
+type VPC struct {
+	Vpc_Id          string `nxapi:"vpc-id"`
+	Vpc_Ifindex     string `nxapi:"vpc-ifindex"`
+	Vpc_Port_State  string `nxapi:"vpc-port-state"`
+	Vpc_Consistency string `nxapi:"vpc-consistency"`
+}
+
+func NewVPCBrief(m map[string]interface{}) (VPCBrief, error) {
+	v := VPCBrief{}
+	err := DecodeRow(m, &v)
+	return v, err
+}
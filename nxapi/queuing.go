@@ -0,0 +1,49 @@
+package nxapi
+
+import "strings"
+
+// QueuingInterface is one interface of "show queuing interface" on the
+// N9K.  Each egress QoS group has a list of statistics.
+type QueuingInterface struct {
+	If_Name_Str         string
+	Qosgrp_Egress_Stats []QoSGroupStats `nxapi:"qosgrp_egress_stats"`
+}
+
+type QoSGroupStats struct {
+	Eq_Qosgrp string              `nxapi:"eq-qosgrp"`
+	Entry     []QoSGroupStatistic `nxapi:"qosgrp_egress_stats_entry"`
+}
+
+// QoSGroupStatistic is one line like "Tx Pkts" or "WRED/AFD & Tail Drop
+// Pkts", with unicast and multicast values.
+type QoSGroupStatistic struct {
+	Eq_Stat_Type     string `nxapi:"eq-stat-type"`
+	Eq_Uc_Stat_Value uint64 `nxapi:"eq-uc-stat-value"`
+	Eq_Mc_Stat_Value uint64 `nxapi:"eq-mc-stat-value"`
+}
+
+func NewQueuingInterfaces(m map[string]interface{}) ([]QueuingInterface, error) {
+	var q []QueuingInterface
+	err := DecodeTable(m, "queuing_interface", &q)
+	return q, err
+}
+
+// Counters adds up the statistics of a QoS group into what was sent and
+// what was dropped, unicast and multicast together.
+func (g QoSGroupStats) Counters() (txPkts, txBytes, dropPkts, dropBytes uint64) {
+	for _, e := range g.Entry {
+		t := strings.ToLower(e.Eq_Stat_Type)
+		v := e.Eq_Uc_Stat_Value + e.Eq_Mc_Stat_Value
+		switch {
+		case strings.Contains(t, "drop") && strings.Contains(t, "pkts"):
+			dropPkts += v
+		case strings.Contains(t, "drop") && strings.Contains(t, "byts"):
+			dropBytes += v
+		case t == "tx pkts":
+			txPkts = v
+		case t == "tx byts":
+			txBytes = v
+		}
+	}
+	return
+}
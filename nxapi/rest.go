@@ -0,0 +1,202 @@
+package nxapi
+
+import (
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* The NX-API REST interface talks to the DME (data management engine) object
+model directly instead of running show commands.  Every query comes back as:
+
+	{ "totalCount": "2", "imdata": [ { "<class>": { "attributes": { ... } } } ] }
+
+The attributes are all strings, even the counters, which DecodeRow copes with.
+The keys are camel case so the structs below all need tags.
+*/
+
+type DMEResponse struct {
+	TotalCount string
+	Imdata     []map[string]DMEObject
+}
+
+type DMEObject struct {
+	Attributes map[string]interface{}
+	Children   []map[string]DMEObject
+}
+
+// Objects returns the attributes of each object of class in the response.
+func (r DMEResponse) Objects(class string) []map[string]interface{} {
+	objs := []map[string]interface{}{}
+	for _, i := range r.Imdata {
+		if o, ok := i[class]; ok {
+			objs = append(objs, o.Attributes)
+		}
+	}
+	return objs
+}
+
+// AAALoginBody is what we post to /api/aaaLogin.json to get a session token.
+func AAALoginBody(user string, pass string) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"aaaUser": map[string]interface{}{
+			"attributes": map[string]string{
+				"name": user,
+				"pwd":  pass,
+			},
+		},
+	})
+}
+
+// AAALogoutBody is what we post to /api/aaaLogout.json to end the session.
+// It only names the user; the session is the cookie.
+func AAALogoutBody(user string) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"aaaUser": map[string]interface{}{
+			"attributes": map[string]string{
+				"name": user,
+			},
+		},
+	})
+}
+
+// LoginToken pulls the session token out of the aaaLogin response.  The token
+// is sent back as the APIC-cookie cookie on every query.
+func (r DMEResponse) LoginToken() (string, error) {
+	for _, l := range r.Objects("aaaLogin") {
+		if t, ok := l["token"].(string); ok && t != "" {
+			return t, nil
+		}
+	}
+	// failed logins come back as an error object with a text attribute.
+	for _, e := range r.Objects("error") {
+		if t, ok := e["text"].(string); ok {
+			return "", errors.New(t)
+		}
+	}
+	return "", errors.New("no token in aaaLogin response")
+}
+
+// InterfaceName pulls the interface out of a dn like
+// sys/intf/phys-[eth1/1]/dbgIfIn and spells it the way the CLI does
+// (Ethernet1/1) so both NX-API collectors report the same names.
+func InterfaceName(dn string) string {
+	start := strings.Index(dn, "[")
+	end := strings.Index(dn, "]")
+	if start < 0 || end < start {
+		return ""
+	}
+	return CLIName(dn[start+1 : end])
+}
+
+// CLIName turns a DME interface id (eth1/1, po10) into the CLI name.
+func CLIName(name string) string {
+	switch {
+	case strings.HasPrefix(name, "eth"):
+		return "Ethernet" + strings.TrimPrefix(name, "eth")
+	case strings.HasPrefix(name, "po"):
+		return "port-channel" + strings.TrimPrefix(name, "po")
+	}
+	return name
+}
+
+// rmonIfIn
+type RmonIfIn struct {
+	Dn            string
+	Octets        uint64
+	UcastPkts     uint64 `nxapi:"ucastPkts"`
+	MulticastPkts uint64 `nxapi:"multicastPkts"`
+	BroadcastPkts uint64 `nxapi:"broadcastPkts"`
+	Discards      uint64
+	Errors        uint64
+}
+
+// rmonIfOut
+type RmonIfOut struct {
+	Dn            string
+	Octets        uint64
+	UcastPkts     uint64 `nxapi:"ucastPkts"`
+	MulticastPkts uint64 `nxapi:"multicastPkts"`
+	BroadcastPkts uint64 `nxapi:"broadcastPkts"`
+	Discards      uint64
+	Errors        uint64
+}
+
+// rmonEtherStats is where the CRC, runt and giant counters live.
+type RmonEtherStats struct {
+	Dn             string
+	CRCAlignErrors uint64 `nxapi:"cRCAlignErrors"`
+	UndersizePkts  uint64 `nxapi:"undersizePkts"`
+	OversizePkts   uint64 `nxapi:"oversizePkts"`
+}
+
+// l1PhysIf is the configuration of a physical interface.
+type L1PhysIf struct {
+	Id      string
+	AdminSt string `nxapi:"adminSt"`
+	Descr   string
+	Mtu     int
+}
+
+// ethpmPhysIf is the operational state of a physical interface.
+type EthpmPhysIf struct {
+	Dn         string
+	OperSt     string `nxapi:"operSt"`
+	OperSpeed  string `nxapi:"operSpeed"`
+	OperDuplex string `nxapi:"operDuplex"`
+}
+
+// Speed turns operSpeed (10G, 100M, auto...) into Mbps.
+func (e EthpmPhysIf) Speed() uint64 {
+	s := strings.ToUpper(e.OperSpeed)
+	mult := uint64(1)
+	if strings.HasSuffix(s, "G") {
+		mult = 1000
+	}
+	n, err := strconv.ParseUint(strings.TrimRight(s, "GM"), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return n * mult
+}
+
+// topSystem
+type TopSystem struct {
+	Name         string
+	Serial       string
+	Address      string
+	SystemUpTime string `nxapi:"systemUpTime"`
+}
+
+// Uptime parses systemUpTime, which looks like 12:03:14:41.000
+// (days:hours:minutes:seconds).
+func (t TopSystem) Uptime() time.Duration {
+	parts := strings.Split(t.SystemUpTime, ":")
+	if len(parts) != 4 {
+		return 0
+	}
+	units := []time.Duration{24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var d time.Duration
+	for i, p := range parts {
+		f, err := strconv.ParseFloat(p, 64)
+		if err != nil {
+			return 0
+		}
+		d += time.Duration(f * float64(units[i]))
+	}
+	return d
+}
+
+// firmwareRunning
+type FirmwareRunning struct {
+	Version string
+}
+
+// eqptCh is the chassis.
+type EqptCh struct {
+	Model  string
+	Vendor string
+	Ser    string
+}
@@ -0,0 +1,92 @@
+package nxapi
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// BGPVrf is one VRF of "show ip bgp summary".  Neighbors are listed under
+// each address family they are configured for.
+type BGPVrf struct {
+	Vrf_Name_Out  string `nxapi:"vrf-name-out"`
+	Vrf_Router_Id string `nxapi:"vrf-router-id"`
+	Vrf_Local_As  string `nxapi:"vrf-local-as"`
+	Af            []BGPAddressFamily
+}
+
+type BGPAddressFamily struct {
+	Af_Id int `nxapi:"af-id"`
+	Saf   []BGPSubAddressFamily
+}
+
+type BGPSubAddressFamily struct {
+	Safi     int
+	Af_Name  string `nxapi:"af-name"`
+	Neighbor []BGPNeighbor
+}
+
+// BGPNeighbor is a peer.  Time is how long it has been in its state, State
+// is Established or whatever it is stuck in.
+type BGPNeighbor struct {
+	Neighborid     string
+	Neighboras     string
+	Time           string
+	State          string
+	Prefixreceived int
+}
+
+func NewBGPSummary(m map[string]interface{}) ([]BGPVrf, error) {
+	var v []BGPVrf
+	err := DecodeTable(m, "vrf", &v)
+	return v, err
+}
+
+// OSPFInstance is one process/VRF of "show ip ospf neighbors".
+type OSPFInstance struct {
+	Ptag  string
+	Cname string
+	Nbr   []OSPFNeighbor
+}
+
+type OSPFNeighbor struct {
+	Rid     string
+	State   string
+	Drstate string
+	Uptime  string
+	Addr    string
+	Intf    string
+}
+
+func NewOSPFNeighbors(m map[string]interface{}) ([]OSPFInstance, error) {
+	var o []OSPFInstance
+	err := DecodeTable(m, "ctx", &o)
+	return o, err
+}
+
+var (
+	isoDuration = regexp.MustCompile(`^P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+	unitsUptime = regexp.MustCompile(`^(?:(\d+)y)?(?:(\d+)w)?(?:(\d+)d)?(?:(\d+)h)?$`)
+)
+
+// ParseUptime reads the ways NX-OS prints how long a session has been up:
+// 01:02:03 when it is under a day, 1d02h, 2w3d or 1y5w, and P1DT2H3M4S in
+// newer releases.  never and anything else is 0.
+func ParseUptime(s string) time.Duration {
+	s = strings.TrimSpace(s)
+	n := func(x string) time.Duration {
+		i, _ := strconv.Atoi(x)
+		return time.Duration(i)
+	}
+	if m := isoDuration.FindStringSubmatch(s); m != nil && s != "P" {
+		return n(m[1])*7*24*time.Hour + n(m[2])*24*time.Hour + n(m[3])*time.Hour + n(m[4])*time.Minute + n(m[5])*time.Second
+	}
+	if bits := strings.Split(s, ":"); len(bits) == 3 {
+		return n(bits[0])*time.Hour + n(bits[1])*time.Minute + n(bits[2])*time.Second
+	}
+	if m := unitsUptime.FindStringSubmatch(s); m != nil {
+		return n(m[1])*365*24*time.Hour + n(m[2])*7*24*time.Hour + n(m[3])*24*time.Hour + n(m[4])*time.Hour
+	}
+	return 0
+}
@@ -0,0 +1,51 @@
+package nxapi
+
+// Transceiver is one interface of "show interface transceiver details".
+// Interfaces without an optic only have Sfp ("not present").
+type Transceiver struct {
+	Interface string
+	Sfp       string
+	Type      string
+	Name      string
+	Partnum   string
+	Serialnum string
+	Lane      []TransceiverLane
+}
+
+// TransceiverLane is the DOM readings of one lane, QSFPs have four.  The
+// readings are strings because optics without DOM say N/A.  Current is in
+// mA and power in dBm.
+type TransceiverLane struct {
+	Lane_Number     int
+	Temperature     string
+	Temp_Alrm_Hi    string
+	Temp_Alrm_Lo    string
+	Temp_Warn_Hi    string
+	Temp_Warn_Lo    string
+	Voltage         string
+	Volt_Alrm_Hi    string
+	Volt_Alrm_Lo    string
+	Volt_Warn_Hi    string
+	Volt_Warn_Lo    string
+	Current         string
+	Current_Alrm_Hi string
+	Current_Alrm_Lo string
+	Current_Warn_Hi string
+	Current_Warn_Lo string
+	Tx_Pwr          string
+	Tx_Pwr_Alrm_Hi  string
+	Tx_Pwr_Alrm_Lo  string
+	Tx_Pwr_Warn_Hi  string
+	Tx_Pwr_Warn_Lo  string
+	Rx_Pwr          string
+	Rx_Pwr_Alrm_Hi  string
+	Rx_Pwr_Alrm_Lo  string
+	Rx_Pwr_Warn_Hi  string
+	Rx_Pwr_Warn_Lo  string
+}
+
+func NewTransceivers(m map[string]interface{}) ([]Transceiver, error) {
+	var t []Transceiver
+	err := DecodeTable(m, "interface", &t)
+	return t, err
+}
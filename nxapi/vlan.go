@@ -0,0 +1,88 @@
+package nxapi
+
+import (
+	"strconv"
+	"strings"
+)
+
+// VLAN is one row of "show vlan brief".  Ports is a compressed list like
+// "Ethernet1/1-4,Ethernet1/7,port-channel10", long ones come in several
+// pieces.
+type VLAN struct {
+	Vlanid string   `nxapi:"vlanshowbr-vlanid-utf"`
+	Name   string   `nxapi:"vlanshowbr-vlanname"`
+	State  string   `nxapi:"vlanshowbr-vlanstate"`
+	Ports  []string `nxapi:"vlanshowplist-ifidx"`
+}
+
+func NewVLANs(m map[string]interface{}) ([]VLAN, error) {
+	var v []VLAN
+	err := DecodeTable(m, "vlanbriefxbrief", &v)
+	return v, err
+}
+
+// Members expands Ports into interface names.
+func (v VLAN) Members() []string {
+	members := []string{}
+	for _, piece := range v.Ports {
+		for _, p := range strings.Split(piece, ",") {
+			p = strings.TrimSpace(p)
+			if p == "" {
+				continue
+			}
+			members = append(members, expandRange(p)...)
+		}
+	}
+	return members
+}
+
+// expandRange turns Ethernet1/1-4 into Ethernet1/1 to Ethernet1/4.
+func expandRange(p string) []string {
+	dash := strings.LastIndex(p, "-")
+	if dash < 0 {
+		return []string{p}
+	}
+	// the number before the dash starts after the last / or letter.
+	start := dash
+	for start > 0 && p[start-1] >= '0' && p[start-1] <= '9' {
+		start--
+	}
+	first, err1 := strconv.Atoi(p[start:dash])
+	last, err2 := strconv.Atoi(p[dash+1:])
+	if err1 != nil || err2 != nil || last < first || start == 0 {
+		return []string{p}
+	}
+	names := []string{}
+	for i := first; i <= last; i++ {
+		names = append(names, p[:start]+strconv.Itoa(i))
+	}
+	return names
+}
+
+// MACAddress is one row of "show mac address-table".
+type MACAddress struct {
+	Disp_Mac_Addr  string
+	Disp_Vlan      string
+	Disp_Type      string
+	Disp_Is_Static string
+	Disp_Port      string
+}
+
+func NewMACAddresses(m map[string]interface{}) ([]MACAddress, error) {
+	var a []MACAddress
+	err := DecodeTable(m, "mac_address", &a)
+	return a, err
+}
+
+// MACCount is the output of "show mac address-table count".
+type MACCount struct {
+	Dyn_Cnt    int
+	Static_Cnt int
+	Total_Cnt  int
+}
+
+func NewMACCount(m map[string]interface{}) (MACCount, error) {
+	c := MACCount{}
+	err := DecodeRow(m, &c)
+	return c, err
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/vallard/stickypipe-agent/nxapi"
+)
+
+// The DME classes we query on NXAPI-REST switches.  Together they give us
+// the same device info and interface samples as the NXAPI CLI collector.
+var nxapiRESTWork = []string{
+	"topSystem",
+	"firmwareRunning",
+	"eqptCh",
+	"l1PhysIf",
+	"ethpmPhysIf",
+	"rmonIfIn",
+	"rmonIfOut",
+	"rmonEtherStats",
+}
+
+/* Get NXAPI REST (DME) information
+Arguments:
+ server - Nexus Switch (10.93.234.2, sw001, or something reachable)
+ creds - user/password pair that looks like admin:cisco
+
+We log in with aaaLogin to get a token, run a class query for each of
+nxapiRESTWork and then log out again so we don't leave sessions lying around.
+*/
+func collectNXAPIREST(server string, creds string) {
+	user, pass, err := splitCredentials(creds)
+	if err != nil {
+		log.Println(server, err)
+		return
+	}
+	loginBody, err := nxapi.AAALoginBody(user, pass)
+	if err != nil {
+		log.Println(server, err)
+		return
+	}
+	req, err := newJSONRequest("POST", "https://"+server+"/api/aaaLogin.json", loginBody, "")
+	if err != nil {
+		log.Println(server, err)
+		return
+	}
+	var login nxapi.DMEResponse
+	if err := doJSON(req, &login); err != nil {
+		log.Println(server, "aaaLogin: ", err)
+		return
+	}
+	token, err := login.LoginToken()
+	if err != nil {
+		log.Println(server, "aaaLogin: ", err)
+		return
+	}
+	cookie := &http.Cookie{Name: "APIC-cookie", Value: token}
+	defer func() {
+		logoutBody, err := nxapi.AAALogoutBody(user)
+		if err != nil {
+			return
+		}
+		req, err := newJSONRequest("POST", "https://"+server+"/api/aaaLogout.json", logoutBody, "")
+		if err != nil {
+			return
+		}
+		req.AddCookie(cookie)
+		var logout nxapi.DMEResponse
+		if err := doJSON(req, &logout); err != nil {
+			log.Println(server, "aaaLogout: ", err)
+		}
+	}()
+
+	results := map[string]nxapi.DMEResponse{}
+	for _, class := range nxapiRESTWork {
+		req, err := newJSONRequest("GET", "https://"+server+"/api/class/"+class+".json", nil, "")
+		if err != nil {
+			log.Println(server, err)
+			continue
+		}
+		req.AddCookie(cookie)
+		var r nxapi.DMEResponse
+		if err := doJSON(req, &r); err != nil {
+			log.Println(server, class, err)
+			continue
+		}
+		results[class] = r
+	}
+	processCollectedNXAPIRESTData(server, results)
+}
+
+// process NXAPI REST data into the same device report and interface samples
+// that processCollectedNXAPIData sends.
+func processCollectedNXAPIRESTData(sw string, results map[string]nxapi.DMEResponse) {
+	now := time.Now().Unix()
+	swi := sw
+
+	// decode logs anything that didn't convert but carries on with the rest.
+	decode := func(m map[string]interface{}, v interface{}) {
+		if err := nxapi.DecodeRow(m, v); err != nil {
+			log.Println(sw, err)
+		}
+	}
+
+	info := DeviceInfo{OS: "NX-OS"}
+	for _, o := range results["topSystem"].Objects("topSystem") {
+		var t nxapi.TopSystem
+		decode(o, &t)
+		info.Hostname = t.Name
+		info.Serial = t.Serial
+		info.Uptime = int64(t.Uptime().Seconds())
+	}
+	for _, o := range results["firmwareRunning"].Objects("firmwareRunning") {
+		var f nxapi.FirmwareRunning
+		decode(o, &f)
+		info.OSVersion = f.Version
+	}
+	for _, o := range results["eqptCh"].Objects("eqptCh") {
+		var c nxapi.EqptCh
+		decode(o, &c)
+		info.Model = c.Model
+		info.Vendor = c.Vendor
+	}
+	if info.Hostname != "" {
+		swi = info.Hostname
+		sendUpstream(DeviceReport{Switch: swi, TimeStamp: now, Device: info})
+	}
+
+	samples := newSampleSet(swi, now)
+	for _, o := range results["l1PhysIf"].Objects("l1PhysIf") {
+		var l nxapi.L1PhysIf
+		decode(o, &l)
+		s := samples.get(nxapi.CLIName(l.Id))
+		s.AdminStatus = l.AdminSt
+		s.Description = l.Descr
+		s.MTU = l.Mtu
+	}
+	for _, o := range results["ethpmPhysIf"].Objects("ethpmPhysIf") {
+		var e nxapi.EthpmPhysIf
+		decode(o, &e)
+		s := samples.get(nxapi.InterfaceName(e.Dn))
+		s.OperStatus = e.OperSt
+		s.IfHighSpeed = e.Speed()
+		s.Duplex = e.OperDuplex
+	}
+	for _, o := range results["rmonIfIn"].Objects("rmonIfIn") {
+		var in nxapi.RmonIfIn
+		decode(o, &in)
+		s := samples.get(nxapi.InterfaceName(in.Dn))
+		s.IfHCInOctets = in.Octets
+		s.InUcastPkts = in.UcastPkts
+		s.InMulticastPkts = in.MulticastPkts
+		s.InBroadcastPkts = in.BroadcastPkts
+		s.InPkts = in.UcastPkts + in.MulticastPkts + in.BroadcastPkts
+		s.InDiscards = in.Discards
+		s.InErrors = in.Errors
+	}
+	for _, o := range results["rmonIfOut"].Objects("rmonIfOut") {
+		var out nxapi.RmonIfOut
+		decode(o, &out)
+		s := samples.get(nxapi.InterfaceName(out.Dn))
+		s.IfHCOutOctets = out.Octets
+		s.OutUcastPkts = out.UcastPkts
+		s.OutMulticastPkts = out.MulticastPkts
+		s.OutBroadcastPkts = out.BroadcastPkts
+		s.OutPkts = out.UcastPkts + out.MulticastPkts + out.BroadcastPkts
+		s.OutDiscards = out.Discards
+		s.OutErrors = out.Errors
+	}
+	for _, o := range results["rmonEtherStats"].Objects("rmonEtherStats") {
+		var e nxapi.RmonEtherStats
+		decode(o, &e)
+		s := samples.get(nxapi.InterfaceName(e.Dn))
+		s.InCRC = e.CRCAlignErrors
+		s.InRunts = e.UndersizePkts
+		s.InGiants = e.OversizePkts
+	}
+	sendUpstream(map[string][]InterfaceSample{swi: samples.list()})
+}
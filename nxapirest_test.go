@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// dmeObjects are the class queries the DME stand-in answers, as a Nexus
+// 9000 running NX-OS 9.3 does.
+var dmeObjects = map[string]string{
+	"topSystem":       `{"topSystem": {"attributes": {"name": "leaf1", "serial": "FDO12345678", "systemUpTime": "01:02:03:04.000"}}}`,
+	"firmwareRunning": `{"firmwareRunning": {"attributes": {"version": "9.3(8)"}}}`,
+	"eqptCh":          `{"eqptCh": {"attributes": {"model": "N9K-C93180YC-EX", "vendor": "Cisco Systems, Inc."}}}`,
+	"l1PhysIf": `{"l1PhysIf": {"attributes": {"id": "eth1/1", "adminSt": "up", "descr": "uplink", "mtu": "9216"}}},
+		{"l1PhysIf": {"attributes": {"id": "eth1/2", "adminSt": "down", "descr": "", "mtu": "1500"}}}`,
+	"ethpmPhysIf":    `{"ethpmPhysIf": {"attributes": {"dn": "sys/phys-[eth1/1]/phys", "operSt": "up", "operSpeed": "100G", "operDuplex": "full"}}}`,
+	"rmonIfIn":       `{"rmonIfIn": {"attributes": {"dn": "sys/phys-[eth1/1]/dbgIfIn", "octets": "18446744073709551615", "ucastPkts": "100", "multicastPkts": "20", "broadcastPkts": "3", "discards": "1", "errors": "2"}}}`,
+	"rmonIfOut":      `{"rmonIfOut": {"attributes": {"dn": "sys/phys-[eth1/1]/dbgIfOut", "octets": "5000", "ucastPkts": "50", "multicastPkts": "5", "broadcastPkts": "0", "discards": "0", "errors": "0"}}}`,
+	"rmonEtherStats": `{"rmonEtherStats": {"attributes": {"dn": "sys/phys-[eth1/1]/dbgEtherStats", "cRCAlignErrors": "7", "undersizePkts": "8", "oversizePkts": "9"}}}`,
+}
+
+// dmeServer is a DME stand-in that wants admin:cisco to log in and the
+// token back as APIC-cookie on everything after.  It keeps the logout body
+// and counts the queries that came with the token.
+type dmeServer struct {
+	mutex   sync.Mutex
+	logins  int
+	queries int
+	logout  map[string]interface{}
+}
+
+func newDMEServer(t *testing.T) (*dmeServer, string) {
+	d := &dmeServer{}
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		d.mutex.Lock()
+		defer d.mutex.Unlock()
+		body, _ := ioutil.ReadAll(r.Body)
+		if r.URL.Path == "/api/aaaLogin.json" {
+			var login struct {
+				AAAUser struct {
+					Attributes struct {
+						Name string
+						Pwd  string
+					}
+				}
+			}
+			json.Unmarshal(body, &login)
+			if login.AAAUser.Attributes.Name != "admin" || login.AAAUser.Attributes.Pwd != "cisco" {
+				fmt.Fprint(w, `{"imdata": [{"error": {"attributes": {"code": "401", "text": "Authentication failed"}}}]}`)
+				return
+			}
+			d.logins++
+			fmt.Fprint(w, `{"imdata": [{"aaaLogin": {"attributes": {"token": "s3ss10n"}}}]}`)
+			return
+		}
+		if c, err := r.Cookie("APIC-cookie"); err != nil || c.Value != "s3ss10n" {
+			w.WriteHeader(403)
+			return
+		}
+		if r.URL.Path == "/api/aaaLogout.json" {
+			json.Unmarshal(body, &d.logout)
+			fmt.Fprint(w, `{"imdata": []}`)
+			return
+		}
+		class := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/class/"), ".json")
+		objects, ok := dmeObjects[class]
+		if r.Method != "GET" || !ok {
+			w.WriteHeader(404)
+			return
+		}
+		d.queries++
+		fmt.Fprintf(w, `{"totalCount": "1", "imdata": [%s]}`, objects)
+	}))
+	t.Cleanup(srv.Close)
+	old := httpClient
+	httpClient = srv.Client()
+	t.Cleanup(func() { httpClient = old })
+	return d, srv.Listener.Addr().String()
+}
+
+func TestCollectNXAPIREST(t *testing.T) {
+	d, addr := newDMEServer(t)
+	lines := captureUpstream(t, func() { collectNXAPIREST(addr, "admin:cisco") })
+
+	// one login, its token on every query, and a logout without the password.
+	if d.logins != 1 || d.queries != len(nxapiRESTWork) {
+		t.Errorf("%d logins, %d queries with the token", d.logins, d.queries)
+	}
+	want := map[string]interface{}{"aaaUser": map[string]interface{}{"attributes": map[string]interface{}{"name": "admin"}}}
+	if fmt.Sprint(d.logout) != fmt.Sprint(want) {
+		t.Errorf("logout %v", d.logout)
+	}
+
+	if len(lines) != 2 {
+		t.Fatalf("sent %d lines, want a device and its interfaces: %q", len(lines), lines)
+	}
+	var device DeviceReport
+	if err := json.Unmarshal([]byte(lines[0]), &device); err != nil {
+		t.Fatal(err)
+	}
+	info := DeviceInfo{Hostname: "leaf1", Vendor: "Cisco Systems, Inc.", Model: "N9K-C93180YC-EX", OS: "NX-OS", OSVersion: "9.3(8)", Serial: "FDO12345678", Uptime: 93784}
+	if device.Switch != "leaf1" || device.Device != info {
+		t.Errorf("device %+v", device)
+	}
+	var samples map[string][]InterfaceSample
+	if err := json.Unmarshal([]byte(lines[1]), &samples); err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]InterfaceSample{}
+	for _, s := range samples["leaf1"] {
+		got[s.IfName] = s
+	}
+	if len(got) != 2 {
+		t.Fatalf("samples %+v", samples)
+	}
+	s := got["Ethernet1/1"]
+	if s.AdminStatus != "up" || s.OperStatus != "up" || s.Description != "uplink" || s.MTU != 9216 || s.IfHighSpeed != 100000 || s.Duplex != "full" {
+		t.Errorf("state %+v", s)
+	}
+	if s.IfHCInOctets != 18446744073709551615 || s.InPkts != 123 || s.InMulticastPkts != 20 || s.InDiscards != 1 || s.InErrors != 2 {
+		t.Errorf("in %+v", s)
+	}
+	if s.IfHCOutOctets != 5000 || s.OutPkts != 55 || s.OutUcastPkts != 50 {
+		t.Errorf("out %+v", s)
+	}
+	if s.InCRC != 7 || s.InRunts != 8 || s.InGiants != 9 {
+		t.Errorf("errors %+v", s)
+	}
+	if s := got["Ethernet1/2"]; s.AdminStatus != "down" || s.MTU != 1500 || s.OperStatus != "" {
+		t.Errorf("Ethernet1/2 %+v", s)
+	}
+}
+
+func TestCollectNXAPIRESTBadPassword(t *testing.T) {
+	d, addr := newDMEServer(t)
+	lines := captureUpstream(t, func() { collectNXAPIREST(addr, "admin:wrong") })
+	if len(lines) != 0 || d.queries != 0 || d.logout != nil {
+		t.Errorf("sent %q, %d queries, logout %v", lines, d.queries, d.logout)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vallard/stickypipe-agent/nxapi"
+)
+
+// QueueStats is what one traffic class sent and dropped on an interface.
+// Queue is the class-map name, or qos-group-N on NX-OS.  The counters are
+// totals since the switch started counting, like the interface counters.
+type QueueStats struct {
+	Queue       string `json:"queue"`
+	Direction   string `json:"direction"`
+	TxPackets   uint64 `json:"txPackets"`
+	TxBytes     uint64 `json:"txBytes"`
+	DropPackets uint64 `json:"dropPackets"`
+	DropBytes   uint64 `json:"dropBytes"`
+}
+
+// QueueSample is the queues of one interface.
+type QueueSample struct {
+	IfName string       `json:"ifName"`
+	IfId   string       `json:"ifId,omitempty"`
+	Queues []QueueStats `json:"queues"`
+}
+
+// QueueReport is the QoS queues of one switch, so congestion drops can be
+// put down to a traffic class.
+type QueueReport struct {
+	Switch     string        `json:"switch"`
+	TimeStamp  int64         `json:"timeStamp"`
+	Interfaces []QueueSample `json:"interfaces"`
+}
+
+// turn show queuing interface into samples.  NX-OS only counts egress.
+func nxapiQueues(qs []nxapi.QueuingInterface) []QueueSample {
+	samples := []QueueSample{}
+	for _, q := range qs {
+		s := QueueSample{IfName: q.If_Name_Str, Queues: []QueueStats{}}
+		for _, g := range q.Qosgrp_Egress_Stats {
+			txPkts, txBytes, dropPkts, dropBytes := g.Counters()
+			s.Queues = append(s.Queues, QueueStats{
+				Queue:       "qos-group-" + g.Eq_Qosgrp,
+				Direction:   "out",
+				TxPackets:   txPkts,
+				TxBytes:     txBytes,
+				DropPackets: dropPkts,
+				DropBytes:   dropBytes,
+			})
+		}
+		if len(s.Queues) > 0 {
+			samples = append(samples, s)
+		}
+	}
+	return samples
+}
+
+// CISCO-CLASS-BASED-QOS-MIB.  Policies are attached to interfaces in
+// cbQosServicePolicyTable, the objects of each policy (class maps among
+// them) are in cbQosObjectsTable and point at their configuration by
+// cbQosConfigIndex, which is where the class map names are.
+var cbQosServicePolicyWork = map[string]string{
+	".1.3.6.1.4.1.9.9.166.1.1.1.1.3": "direction",
+	".1.3.6.1.4.1.9.9.166.1.1.1.1.4": "ifIndex",
+}
+
+var cbQosObjectsWork = map[string]string{
+	".1.3.6.1.4.1.9.9.166.1.5.1.1.2": "configIndex",
+	".1.3.6.1.4.1.9.9.166.1.5.1.1.3": "type",
+}
+
+// cbQosCMName
+const cbQosCMName = ".1.3.6.1.4.1.9.9.166.1.7.1.1.1"
+
+// cbQosCMStatsTable, indexed the same as cbQosObjectsTable.
+var cbQosCMStatsWork = map[string]string{
+	".1.3.6.1.4.1.9.9.166.1.15.1.1.3":  "prePolicyPkt64",
+	".1.3.6.1.4.1.9.9.166.1.15.1.1.10": "postPolicyByte64",
+	".1.3.6.1.4.1.9.9.166.1.15.1.1.14": "dropPkt64",
+	".1.3.6.1.4.1.9.9.166.1.15.1.1.17": "dropByte64",
+}
+
+// cbQosObjectsType classmap
+const cbQosClassMap = "2"
+
+/*
+	Walk CISCO-CLASS-BASED-QOS-MIB on a switch and send up the counters of
+	each class of each service policy.
+
+Arguments:
+
+	server - the switch
+	creds - the SNMP community string
+	sw - the switch name from sysName
+*/
+func collectSNMPQueues(server string, creds string, sw string) {
+	policies := map[string]map[string]string{}
+	walkColumns(server, creds, cbQosServicePolicyWork, policies)
+	if len(policies) == 0 {
+		return
+	}
+	objects := map[string]map[string]string{}
+	names := map[string]map[string]string{}
+	stats := map[string]map[string]string{}
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		walkColumns(server, creds, cbQosObjectsWork, objects)
+	}()
+	go func() {
+		defer wg.Done()
+		walkTable(server, creds, cbQosCMName, "name", names)
+	}()
+	go func() {
+		defer wg.Done()
+		walkColumns(server, creds, cbQosCMStatsWork, stats)
+	}()
+	wg.Wait()
+
+	interfaces := map[string]*QueueSample{}
+	for row, o := range objects {
+		if o["type"] != cbQosClassMap {
+			continue
+		}
+		policy := strings.Split(row, ".")[0]
+		p, ok := policies[policy]
+		if !ok || p["ifIndex"] == "" {
+			continue
+		}
+		st, ok := stats[row]
+		if !ok {
+			continue
+		}
+		direction := "in"
+		if p["direction"] == "2" {
+			direction = "out"
+		}
+		s := interfaces[p["ifIndex"]]
+		if s == nil {
+			_, name := lookupInterface(server, p["ifIndex"])
+			s = &QueueSample{IfName: name, IfId: p["ifIndex"], Queues: []QueueStats{}}
+			interfaces[p["ifIndex"]] = s
+		}
+		pkts := parseCounter(st["prePolicyPkt64"])
+		drops := parseCounter(st["dropPkt64"])
+		if drops > pkts {
+			drops = pkts
+		}
+		s.Queues = append(s.Queues, QueueStats{
+			Queue:       names[o["configIndex"]]["name"],
+			Direction:   direction,
+			TxPackets:   pkts - drops,
+			TxBytes:     parseCounter(st["postPolicyByte64"]),
+			DropPackets: drops,
+			DropBytes:   parseCounter(st["dropByte64"]),
+		})
+	}
+	if len(interfaces) == 0 {
+		return
+	}
+	r := QueueReport{Switch: sw, TimeStamp: time.Now().Unix()}
+	for _, s := range interfaces {
+		sort.Slice(s.Queues, func(a, b int) bool {
+			if s.Queues[a].Direction != s.Queues[b].Direction {
+				return s.Queues[a].Direction < s.Queues[b].Direction
+			}
+			return s.Queues[a].Queue < s.Queues[b].Queue
+		})
+		r.Interfaces = append(r.Interfaces, *s)
+	}
+	sendUpstream(r)
+}
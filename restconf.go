@@ -0,0 +1,153 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+
+	"github.com/vallard/stickypipe-agent/yang"
+)
+
+// How many list entries we ask for at a time.  0 gets them all in one go.
+var restconfPageSize = 100
+
+// We give up on a list after this many pages rather than loop forever on a
+// device that gets offset wrong.
+const restconfMaxPages = 1000
+
+// restconfGet GETs a RESTCONF data resource.  RESTCONF wraps everything in
+// its module qualified name ({"ietf-system:hostname": "csr1"}) so we
+// unmarshal whatever is under that one key into v.
+func restconfGet(server string, creds string, path string, v interface{}) error {
+	req, err := newJSONRequest("GET", "https://"+server+"/restconf/data/"+path, nil, creds)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("accept", "application/yang-data+json")
+	var wrapped map[string]json.RawMessage
+	if err := doJSON(req, &wrapped); err != nil {
+		return err
+	}
+	for _, inner := range wrapped {
+		return json.Unmarshal(inner, v)
+	}
+	return nil
+}
+
+// notSupported is true if the device told us it doesn't have that resource.
+func notSupported(err error) bool {
+	e, ok := err.(*httpError)
+	return ok && (e.StatusCode == 400 || e.StatusCode == 404)
+}
+
+// restconfList gets every entry of a list a page at a time, using the limit
+// and offset query parameters from the RESTCONF list pagination draft.  Most
+// devices don't do pagination yet.  They either answer 400, in which case we
+// ask for the whole list, or ignore the parameters and send the whole list
+// every time, which we notice because we get more than we asked for or a
+// page starting with an entry we already have.  Entries are told apart by
+// their name key, the counters in them change between requests.
+func restconfList(server string, creds string, path string) ([]json.RawMessage, error) {
+	if restconfPageSize == 0 {
+		var all []json.RawMessage
+		err := restconfGet(server, creds, path, &all)
+		return all, err
+	}
+	var all []json.RawMessage
+	seen := map[string]bool{}
+	for offset, pages := 0, 0; ; pages++ {
+		if pages == restconfMaxPages {
+			return all, fmt.Errorf("%s: more than %d pages, giving up", path, restconfMaxPages)
+		}
+		var page []json.RawMessage
+		paged := path + "?limit=" + strconv.Itoa(restconfPageSize) + "&offset=" + strconv.Itoa(offset)
+		err := restconfGet(server, creds, paged, &page)
+		if err != nil {
+			if e, ok := err.(*httpError); ok && e.StatusCode == 400 && offset == 0 {
+				err = restconfGet(server, creds, path, &all)
+			}
+			return all, err
+		}
+		if len(page) > restconfPageSize {
+			return page, nil
+		}
+		if len(page) > 0 && seen[restconfListKey(page[0])] {
+			return all, nil
+		}
+		for _, e := range page {
+			seen[restconfListKey(e)] = true
+		}
+		all = append(all, page...)
+		if len(page) < restconfPageSize {
+			return all, nil
+		}
+		offset += len(page)
+	}
+}
+
+// restconfListKey returns the name key of a list entry, or the entry itself
+// if it hasn't got one.
+func restconfListKey(e json.RawMessage) string {
+	var k struct {
+		Name string `json:"name"`
+	}
+	if err := json.Unmarshal(e, &k); err != nil || k.Name == "" {
+		return string(e)
+	}
+	return k.Name
+}
+
+/* Get interface statistics over RESTCONF
+Arguments:
+ server - switch or router (10.93.234.6, csr1000v, or something reachable)
+ creds - user/password pair that looks like admin:cisco, sent with basic auth
+ just like NXAPI.
+
+Uses the same ietf-interfaces / openconfig-interfaces models as NETCONF, just
+JSON encoded.
+*/
+func collectRESTCONF(server string, creds string) {
+	var system yang.IETFSystem
+	if err := restconfGet(server, creds, "ietf-system:system/hostname", &system.Hostname); err != nil && !notSupported(err) {
+		log.Println(server, err)
+	}
+	var state yang.IETFSystemState
+	if err := restconfGet(server, creds, "ietf-system:system-state/platform", &state.Platform); err != nil && !notSupported(err) {
+		log.Println(server, err)
+	}
+
+	// RFC 7223 devices have interfaces-state, RFC 8343 (NMDA) devices put
+	// the same thing under interfaces.
+	var ietf yang.IETFInterfaces
+	entries, err := restconfList(server, creds, "ietf-interfaces:interfaces-state/interface")
+	if notSupported(err) {
+		entries, err = restconfList(server, creds, "ietf-interfaces:interfaces/interface")
+	}
+	if err != nil {
+		log.Println(server, err)
+	}
+	for _, e := range entries {
+		var i yang.IETFInterface
+		if err := json.Unmarshal(e, &i); err != nil {
+			log.Println(server, err)
+			continue
+		}
+		ietf.Interfaces = append(ietf.Interfaces, i)
+	}
+
+	var oc yang.OpenConfigInterfaces
+	entries, err = restconfList(server, creds, "openconfig-interfaces:interfaces/interface")
+	if err != nil && !notSupported(err) {
+		log.Println(server, err)
+	}
+	for _, e := range entries {
+		var i yang.OpenConfigInterface
+		if err := json.Unmarshal(e, &i); err != nil {
+			log.Println(server, err)
+			continue
+		}
+		oc.Interfaces = append(oc.Interfaces, i)
+	}
+	processCollectedYANGData(server, system, state, ietf, oc)
+}
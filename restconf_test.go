@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// restconfServer serves ietf-interfaces:interfaces/interface, the entries
+// (or the status) of each page coming from page, and points the shared
+// client at it.
+func restconfServer(t *testing.T, page func(limit int, offset int, paged bool) (int, []string)) string {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, _ := r.BasicAuth(); user != "admin" || pass != "cisco" {
+			w.WriteHeader(401)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, "/restconf/data/ietf-interfaces:interfaces/interface") {
+			w.WriteHeader(404)
+			return
+		}
+		q := r.URL.Query()
+		limit, _ := strconv.Atoi(q.Get("limit"))
+		offset, _ := strconv.Atoi(q.Get("offset"))
+		status, names := page(limit, offset, q.Get("limit") != "")
+		if status != 200 {
+			w.WriteHeader(status)
+			return
+		}
+		fmt.Fprintf(w, `{"ietf-interfaces:interface": [%s]}`, strings.Join(names, ","))
+	}))
+	t.Cleanup(srv.Close)
+	old := httpClient
+	httpClient = srv.Client()
+	t.Cleanup(func() { httpClient = old })
+	return srv.Listener.Addr().String()
+}
+
+// restconfEntry is an interface whose counter changes every time it's asked
+// for, like a real one.
+func restconfEntry(i int, polls *int) string {
+	*polls++
+	return fmt.Sprintf(`{"name": "GigabitEthernet%d", "statistics": {"in-octets": "%d"}}`, i, *polls)
+}
+
+func restconfNames(entries []json.RawMessage) []string {
+	names := []string{}
+	for _, e := range entries {
+		names = append(names, restconfListKey(e))
+	}
+	return names
+}
+
+func TestRestconfList(t *testing.T) {
+	oldSize := restconfPageSize
+	defer func() { restconfPageSize = oldSize }()
+	restconfPageSize = 2
+
+	tests := []struct {
+		name string
+		// interfaces on the device
+		count int
+		page  func(count int, polls *int) func(limit int, offset int, paged bool) (int, []string)
+		want  int
+		err   bool
+	}{
+		{
+			name:  "paginates",
+			count: 5,
+			page: func(count int, polls *int) func(int, int, bool) (int, []string) {
+				return func(limit int, offset int, paged bool) (int, []string) {
+					names := []string{}
+					for i := offset; i < count && i < offset+limit; i++ {
+						names = append(names, restconfEntry(i, polls))
+					}
+					return 200, names
+				}
+			},
+			want: 5,
+		},
+		{
+			name:  "ignores offset, list is a page long",
+			count: 2,
+			page: func(count int, polls *int) func(int, int, bool) (int, []string) {
+				return func(limit int, offset int, paged bool) (int, []string) {
+					names := []string{}
+					for i := 0; i < count && i < limit; i++ {
+						names = append(names, restconfEntry(i, polls))
+					}
+					return 200, names
+				}
+			},
+			want: 2,
+		},
+		{
+			name:  "ignores limit and offset",
+			count: 3,
+			page: func(count int, polls *int) func(int, int, bool) (int, []string) {
+				return func(limit int, offset int, paged bool) (int, []string) {
+					names := []string{}
+					for i := 0; i < count; i++ {
+						names = append(names, restconfEntry(i, polls))
+					}
+					return 200, names
+				}
+			},
+			want: 3,
+		},
+		{
+			name:  "rejects paging",
+			count: 3,
+			page: func(count int, polls *int) func(int, int, bool) (int, []string) {
+				return func(limit int, offset int, paged bool) (int, []string) {
+					if paged {
+						return 400, nil
+					}
+					names := []string{}
+					for i := 0; i < count; i++ {
+						names = append(names, restconfEntry(i, polls))
+					}
+					return 200, names
+				}
+			},
+			want: 3,
+		},
+		{
+			name: "never ends",
+			page: func(count int, polls *int) func(int, int, bool) (int, []string) {
+				return func(limit int, offset int, paged bool) (int, []string) {
+					return 200, []string{restconfEntry(offset, polls), restconfEntry(offset+1, polls)}
+				}
+			},
+			want: 2 * restconfMaxPages,
+			err:  true,
+		},
+	}
+	for _, tt := range tests {
+		polls := 0
+		server := restconfServer(t, tt.page(tt.count, &polls))
+		got, err := restconfList(server, "admin:cisco", "ietf-interfaces:interfaces/interface")
+		if (err != nil) != tt.err {
+			t.Errorf("%s: error %v", tt.name, err)
+		}
+		names := restconfNames(got)
+		if len(names) != tt.want {
+			t.Errorf("%s: got %d entries, want %d: %v", tt.name, len(names), tt.want, names)
+			continue
+		}
+		for i, n := range names {
+			if n != fmt.Sprintf("GigabitEthernet%d", i) {
+				t.Errorf("%s: entry %d is %s", tt.name, i, n)
+			}
+		}
+	}
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vallard/stickypipe-agent/nxapi"
+)
+
+// RoutingPeer is a BGP or OSPF session.  Peer is the neighbor address (the
+// router ID for OSPF).  PreviousState is only set when the state changed
+// since our last poll, which is what flap alerts go off.  Flapped is set
+// when the state is the same but the session went down and came back in
+// between, which we can tell from Uptime going backwards or Transitions
+// going up.
+type RoutingPeer struct {
+	Protocol         string `json:"protocol"`
+	Instance         string `json:"instance,omitempty"`
+	AddressFamily    string `json:"addressFamily,omitempty"`
+	Peer             string `json:"peer"`
+	Address          string `json:"address,omitempty"`
+	Interface        string `json:"interface,omitempty"`
+	RemoteAs         string `json:"remoteAs,omitempty"`
+	State            string `json:"state"`
+	PreviousState    string `json:"previousState,omitempty"`
+	Uptime           int64  `json:"uptime,omitempty"`
+	PrefixesReceived int    `json:"prefixesReceived,omitempty"`
+	Transitions      uint64 `json:"transitions,omitempty"`
+	Flapped          bool   `json:"flapped,omitempty"`
+}
+
+// RoutingReport is the routing sessions of one switch.
+type RoutingReport struct {
+	Switch    string        `json:"switch"`
+	TimeStamp int64         `json:"timeStamp"`
+	Peers     []RoutingPeer `json:"peers"`
+}
+
+// Every session of each endpoint at the last poll, to spot flaps.
+var peerStates = struct {
+	sync.Mutex
+	m map[string]map[string]RoutingPeer
+}{m: map[string]map[string]RoutingPeer{}}
+
+func (p RoutingPeer) key() string {
+	return strings.Join([]string{p.Protocol, p.Instance, p.AddressFamily, p.Peer}, "|")
+}
+
+/*
+	Fill in PreviousState and Flapped and send the report.
+
+Arguments:
+
+	endpoint - the switch the report is from
+	r - its peers this poll
+
+A peer we had last time that's gone now, say the neighbor was removed or
+the OSPF adjacency timed out, is sent once as down and then forgotten.
+Nothing is sent if the switch has never had any peers.
+*/
+func sendRouting(endpoint string, r RoutingReport) {
+	peerStates.Lock()
+	last := peerStates.m[endpoint]
+	now := map[string]RoutingPeer{}
+	for i, p := range r.Peers {
+		k := p.key()
+		if l, ok := last[k]; ok {
+			if l.State != p.State {
+				r.Peers[i].PreviousState = l.State
+			} else if (l.Uptime > 0 && p.Uptime < l.Uptime) || p.Transitions > l.Transitions {
+				r.Peers[i].Flapped = true
+			}
+		}
+		now[k] = p
+	}
+	for k, l := range last {
+		if _, ok := now[k]; ok {
+			continue
+		}
+		gone := RoutingPeer{
+			Protocol:      l.Protocol,
+			Instance:      l.Instance,
+			AddressFamily: l.AddressFamily,
+			Peer:          l.Peer,
+			Address:       l.Address,
+			Interface:     l.Interface,
+			RemoteAs:      l.RemoteAs,
+			State:         "down",
+			Transitions:   l.Transitions,
+		}
+		if l.State != "down" {
+			gone.PreviousState = l.State
+		}
+		r.Peers = append(r.Peers, gone)
+	}
+	if len(now) > 0 {
+		peerStates.m[endpoint] = now
+	} else {
+		delete(peerStates.m, endpoint)
+	}
+	peerStates.Unlock()
+	if len(r.Peers) > 0 {
+		sendUpstream(r)
+	}
+}
+
+// turn show ip bgp summary and show ip ospf neighbors into peers.
+func nxapiRoutingPeers(bgp []nxapi.BGPVrf, ospf []nxapi.OSPFInstance) []RoutingPeer {
+	peers := []RoutingPeer{}
+	for _, v := range bgp {
+		for _, af := range v.Af {
+			for _, saf := range af.Saf {
+				for _, n := range saf.Neighbor {
+					p := RoutingPeer{
+						Protocol:         "bgp",
+						Instance:         v.Vrf_Name_Out,
+						AddressFamily:    saf.Af_Name,
+						Peer:             n.Neighborid,
+						Address:          n.Neighborid,
+						RemoteAs:         n.Neighboras,
+						State:            strings.ToLower(n.State),
+						PrefixesReceived: n.Prefixreceived,
+					}
+					// Time is how long it has been in the state it is in.
+					if p.State == "established" {
+						p.Uptime = int64(nxapi.ParseUptime(n.Time).Seconds())
+					}
+					peers = append(peers, p)
+				}
+			}
+		}
+	}
+	for _, o := range ospf {
+		instance := o.Ptag
+		if o.Cname != "" && o.Cname != "default" {
+			instance += "/" + o.Cname
+		}
+		for _, n := range o.Nbr {
+			peers = append(peers, RoutingPeer{
+				Protocol:  "ospf",
+				Instance:  instance,
+				Peer:      n.Rid,
+				Address:   n.Addr,
+				Interface: nxapi.CLIName(strings.ToLower(n.Intf)),
+				State:     strings.ToLower(n.State),
+				Uptime:    int64(nxapi.ParseUptime(n.Uptime).Seconds()),
+			})
+		}
+	}
+	return peers
+}
+
+// BGP4-MIB bgpPeerTable, indexed by the peer address.
+var bgpPeerWork = map[string]string{
+	".1.3.6.1.2.1.15.3.1.2":  "state",
+	".1.3.6.1.2.1.15.3.1.9":  "remoteAs",
+	".1.3.6.1.2.1.15.3.1.15": "establishedTransitions",
+	".1.3.6.1.2.1.15.3.1.16": "establishedTime",
+}
+
+// CISCO-BGP4-MIB cbgpPeerAcceptedPrefixes, indexed by address, AFI and
+// SAFI.
+const cbgpPeerAcceptedPrefixes = ".1.3.6.1.4.1.9.9.187.1.2.4.1.1"
+
+// OSPF-MIB ospfNbrTable, indexed by address and ifIndex (0 on numbered
+// links).
+var ospfNbrWork = map[string]string{
+	".1.3.6.1.2.1.14.10.1.3": "routerId",
+	".1.3.6.1.2.1.14.10.1.6": "state",
+}
+
+var bgpStates = map[string]string{
+	"1": "idle",
+	"2": "connect",
+	"3": "active",
+	"4": "opensent",
+	"5": "openconfirm",
+	"6": "established",
+}
+
+var ospfStates = map[string]string{
+	"1": "down",
+	"2": "attempt",
+	"3": "init",
+	"4": "two-way",
+	"5": "exstart",
+	"6": "exchange",
+	"7": "loading",
+	"8": "full",
+}
+
+/*
+	Walk the BGP and OSPF MIBs on a switch and send up its routing peers.
+
+Arguments:
+
+	server - the switch
+	creds - the SNMP community string
+	sw - the switch name from sysName
+
+BGP4-MIB only knows about IPv4 peers in the default VRF.
+*/
+func collectSNMPRouting(server string, creds string, sw string) {
+	bgp := map[string]map[string]string{}
+	prefixes := map[string]map[string]string{}
+	ospf := map[string]map[string]string{}
+	var wg sync.WaitGroup
+	wg.Add(3)
+	go func() {
+		defer wg.Done()
+		walkColumns(server, creds, bgpPeerWork, bgp)
+	}()
+	go func() {
+		defer wg.Done()
+		walkTable(server, creds, cbgpPeerAcceptedPrefixes, "accepted", prefixes)
+	}()
+	go func() {
+		defer wg.Done()
+		walkColumns(server, creds, ospfNbrWork, ospf)
+	}()
+	wg.Wait()
+
+	// add up the prefixes of each peer over its address families.
+	accepted := map[string]int{}
+	for row, v := range prefixes {
+		bits := strings.Split(row, ".")
+		if len(bits) != 6 {
+			continue
+		}
+		accepted[strings.Join(bits[:4], ".")] += int(parseCounter(v["accepted"]))
+	}
+
+	r := RoutingReport{Switch: sw, TimeStamp: time.Now().Unix()}
+	for peer, v := range bgp {
+		p := RoutingPeer{
+			Protocol:         "bgp",
+			Peer:             peer,
+			Address:          peer,
+			RemoteAs:         v["remoteAs"],
+			State:            bgpStates[v["state"]],
+			Transitions:      parseCounter(v["establishedTransitions"]),
+			PrefixesReceived: accepted[peer],
+		}
+		if p.State == "" {
+			p.State = fmt.Sprintf("unknown(%s)", v["state"])
+		}
+		// bgpPeerFsmEstablishedTime is how long it has been up, or how
+		// long since it went down.
+		if p.State == "established" {
+			p.Uptime = int64(parseCounter(v["establishedTime"]))
+		}
+		r.Peers = append(r.Peers, p)
+	}
+	for row, v := range ospf {
+		bits := strings.Split(row, ".")
+		if len(bits) != 5 {
+			continue
+		}
+		p := RoutingPeer{
+			Protocol: "ospf",
+			Peer:     v["routerId"],
+			Address:  strings.Join(bits[:4], "."),
+			State:    ospfStates[v["state"]],
+		}
+		if bits[4] != "0" {
+			_, p.Interface = lookupInterface(server, bits[4])
+		}
+		r.Peers = append(r.Peers, p)
+	}
+	sendRouting(server, r)
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// pollRouting sends peers as a poll of endpoint and returns what went up,
+// nil if nothing did.
+func pollRouting(t *testing.T, endpoint string, peers ...RoutingPeer) []RoutingPeer {
+	lines := captureUpstream(t, func() {
+		sendRouting(endpoint, RoutingReport{Switch: "leaf1", TimeStamp: 1, Peers: peers})
+	})
+	if len(lines) == 0 {
+		return nil
+	}
+	var r RoutingReport
+	if err := json.Unmarshal([]byte(lines[0]), &r); err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(r.Peers, func(i, j int) bool { return r.Peers[i].key() < r.Peers[j].key() })
+	return r.Peers
+}
+
+func TestSendRouting(t *testing.T) {
+	const endpoint = "10.0.0.1"
+	defer delete(peerStates.m, endpoint)
+
+	bgp := RoutingPeer{Protocol: "bgp", Instance: "default", Peer: "10.1.1.1", State: "established", Uptime: 100, Transitions: 1}
+	ospf := RoutingPeer{Protocol: "ospf", Instance: "1", Peer: "1.1.1.1", Interface: "Ethernet1/1", State: "full", Uptime: 50}
+
+	tests := []struct {
+		name  string
+		peers []RoutingPeer
+		want  []RoutingPeer
+	}{
+		{
+			name:  "first poll",
+			peers: []RoutingPeer{bgp, ospf},
+			want:  []RoutingPeer{bgp, ospf},
+		},
+		{
+			name:  "nothing changed",
+			peers: []RoutingPeer{with(bgp, func(p *RoutingPeer) { p.Uptime = 160 }), with(ospf, func(p *RoutingPeer) { p.Uptime = 110 })},
+			want:  []RoutingPeer{with(bgp, func(p *RoutingPeer) { p.Uptime = 160 }), with(ospf, func(p *RoutingPeer) { p.Uptime = 110 })},
+		},
+		{
+			name:  "bgp bounced between polls, ospf uptime went backwards",
+			peers: []RoutingPeer{with(bgp, func(p *RoutingPeer) { p.Uptime = 20; p.Transitions = 3 }), with(ospf, func(p *RoutingPeer) { p.Uptime = 10 })},
+			want: []RoutingPeer{
+				with(bgp, func(p *RoutingPeer) { p.Uptime = 20; p.Transitions = 3; p.Flapped = true }),
+				with(ospf, func(p *RoutingPeer) { p.Uptime = 10; p.Flapped = true }),
+			},
+		},
+		{
+			name:  "bgp went idle",
+			peers: []RoutingPeer{with(bgp, func(p *RoutingPeer) { p.State = "idle"; p.Uptime = 0; p.Transitions = 4 }), with(ospf, func(p *RoutingPeer) { p.Uptime = 70 })},
+			want: []RoutingPeer{
+				with(bgp, func(p *RoutingPeer) {
+					p.State = "idle"
+					p.Uptime = 0
+					p.Transitions = 4
+					p.PreviousState = "established"
+				}),
+				with(ospf, func(p *RoutingPeer) { p.Uptime = 70 }),
+			},
+		},
+		{
+			name:  "ospf neighbor gone",
+			peers: []RoutingPeer{with(bgp, func(p *RoutingPeer) { p.State = "idle"; p.Uptime = 0; p.Transitions = 4 })},
+			want: []RoutingPeer{
+				with(bgp, func(p *RoutingPeer) { p.State = "idle"; p.Uptime = 0; p.Transitions = 4 }),
+				with(ospf, func(p *RoutingPeer) { p.State = "down"; p.Uptime = 0; p.PreviousState = "full" }),
+			},
+		},
+		{
+			name: "last peer gone",
+			want: []RoutingPeer{with(bgp, func(p *RoutingPeer) { p.State = "down"; p.Uptime = 0; p.Transitions = 4; p.PreviousState = "idle" })},
+		},
+		{
+			name: "still none",
+		},
+	}
+	for _, tt := range tests {
+		got := pollRouting(t, endpoint, append([]RoutingPeer{}, tt.peers...)...)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:\ngot  %+v\nwant %+v", tt.name, got, tt.want)
+		}
+	}
+	if _, ok := peerStates.m[endpoint]; ok {
+		t.Error("peers not forgotten")
+	}
+}
+
+func with(p RoutingPeer, f func(*RoutingPeer)) RoutingPeer {
+	f(&p)
+	return p
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/vallard/stickypipe-agent/nxapi"
+	"github.com/vallard/stickypipe-agent/yang"
+)
+
+// InterfaceSample is the state and counters of one interface at a point in
+// time.  Every collector, whatever it talks to the switch with, boils its
+// data down to these so stickypipe only has to understand one format.
+// Collectors fill in what they can and leave the rest empty.  IfKey is the
+// same for an interface whatever we poll it with, see InterfaceIdentity.
+type InterfaceSample struct {
+	Switch      string `json:"switch"`
+	IfName      string `json:"ifName"`
+	IfId        string `json:"ifId,omitempty"`
+	IfKey       string `json:"ifKey,omitempty"`
+	TimeStamp   int64  `json:"timeStamp"`
+	Description string `json:"description,omitempty"`
+	AdminStatus string `json:"adminStatus,omitempty"`
+	OperStatus  string `json:"operStatus,omitempty"`
+	// in Mbps just like ifHighSpeed
+	IfHighSpeed uint64 `json:"ifHighSpeed,omitempty"`
+	Duplex      string `json:"duplex,omitempty"`
+	MTU         int    `json:"mtu,omitempty"`
+
+	IfInOctets       uint64 `json:"ifInOctets,omitempty"`
+	IfHCInOctets     uint64 `json:"ifHCInOctets"`
+	IfOutOctets      uint64 `json:"ifOutOctets,omitempty"`
+	IfHCOutOctets    uint64 `json:"ifHCOutOctets"`
+	InPkts           uint64 `json:"inPkts,omitempty"`
+	InUcastPkts      uint64 `json:"inUcastPkts,omitempty"`
+	InMulticastPkts  uint64 `json:"inMulticastPkts,omitempty"`
+	InBroadcastPkts  uint64 `json:"inBroadcastPkts,omitempty"`
+	OutPkts          uint64 `json:"outPkts,omitempty"`
+	OutUcastPkts     uint64 `json:"outUcastPkts,omitempty"`
+	OutMulticastPkts uint64 `json:"outMulticastPkts,omitempty"`
+	OutBroadcastPkts uint64 `json:"outBroadcastPkts,omitempty"`
+
+	// bits per second as averaged by the switch.
+	InRate  uint64 `json:"inRate,omitempty"`
+	OutRate uint64 `json:"outRate,omitempty"`
+
+	InErrors    uint64 `json:"inErrors,omitempty"`
+	OutErrors   uint64 `json:"outErrors,omitempty"`
+	InDiscards  uint64 `json:"inDiscards,omitempty"`
+	OutDiscards uint64 `json:"outDiscards,omitempty"`
+	InCRC       uint64 `json:"inCRC,omitempty"`
+	InRunts     uint64 `json:"inRunts,omitempty"`
+	InGiants    uint64 `json:"inGiants,omitempty"`
+
+	// Port-channels and their members both have counters, so consumers
+	// adding up traffic should skip one or the other.  Bundle is the
+	// port-channel a member is in.  VPC is the vPC number (or peer-link) of
+	// a port-channel and its members, VPCRole the switch's role in the pair.
+	Aggregate bool   `json:"aggregate,omitempty"`
+	Bundle    string `json:"bundle,omitempty"`
+	VPC       string `json:"vpc,omitempty"`
+	VPCRole   string `json:"vpcRole,omitempty"`
+}
+
+// newSNMPSample turns the values we walked for one ifIndex into a sample.
+func newSNMPSample(sw string, ifIndex string, v map[string]string, now int64) InterfaceSample {
+	return InterfaceSample{
+		Switch:      sw,
+		IfName:      v["name"],
+		IfId:        ifIndex,
+		TimeStamp:   now,
+		Description: v["ifAlias"],
+		AdminStatus: ifStatus(v["ifAdminStatus"]),
+		OperStatus:  ifStatus(v["ifOperStatus"]),
+		IfHighSpeed: parseCounter(v["ifHighSpeed"]),
+		MTU:         int(parseCounter(v["ifMtu"])),
+
+		IfInOctets:    parseCounter(v["ifInOctets"]),
+		IfHCInOctets:  parseCounter(v["ifHCInOctets"]),
+		IfOutOctets:   parseCounter(v["ifOutOctets"]),
+		IfHCOutOctets: parseCounter(v["ifHCOutOctets"]),
+
+		InErrors:    parseCounter(v["ifInErrors"]),
+		OutErrors:   parseCounter(v["ifOutErrors"]),
+		InDiscards:  parseCounter(v["ifInDiscards"]),
+		OutDiscards: parseCounter(v["ifOutDiscards"]),
+	}
+}
+
+// fill in a sample from the output of show interface.
+func (s *InterfaceSample) addNXAPIInterface(i nxapi.Interface) {
+	s.Description = i.Desc
+	s.AdminStatus = strings.ToLower(i.Admin_State)
+	s.OperStatus = strings.ToLower(i.State)
+	// eth_bw is in Kbps
+	s.IfHighSpeed = i.Eth_Bw / 1000
+	s.Duplex = i.Eth_Duplex
+	s.MTU = i.Eth_Mtu
+
+	// show interface counters got these already.  Some interfaces (mgmt0)
+	// have no eth_ counters in show interface, so zeros here would wipe
+	// them out.
+	setCounter(&s.IfHCInOctets, i.Eth_Inbytes)
+	setCounter(&s.IfHCOutOctets, i.Eth_Outbytes)
+	setCounter(&s.InPkts, i.Eth_Inpkts)
+	setCounter(&s.InUcastPkts, i.Eth_Inucast)
+	setCounter(&s.InMulticastPkts, i.Eth_Inmcast)
+	setCounter(&s.InBroadcastPkts, i.Eth_Inbcast)
+	setCounter(&s.OutPkts, i.Eth_Outpkts)
+	setCounter(&s.OutUcastPkts, i.Eth_Outucast)
+	setCounter(&s.OutMulticastPkts, i.Eth_Outmcast)
+	setCounter(&s.OutBroadcastPkts, i.Eth_Outbcast)
+
+	s.InRate = i.Eth_Inrate1_Bits
+	s.OutRate = i.Eth_Outrate1_Bits
+
+	s.InErrors = i.Eth_Inerr
+	s.OutErrors = i.Eth_Outerr
+	s.InDiscards = i.Eth_Indiscard
+	s.OutDiscards = i.Eth_Outdiscard
+	s.InCRC = i.Eth_Crc
+	s.InRunts = i.Eth_Runts
+	s.InGiants = i.Eth_Giants
+}
+
+// setCounter sets a counter we may already have from elsewhere, unless v
+// is zero.
+func setCounter(c *uint64, v uint64) {
+	if v != 0 {
+		*c = v
+	}
+}
+
+// fill in a sample from an ietf-interfaces interface.
+func (s *InterfaceSample) addIETFInterface(i yang.IETFInterface) {
+	if i.IfIndex != 0 {
+		s.IfId = strconv.Itoa(i.IfIndex)
+	}
+	if i.Description != "" {
+		s.Description = i.Description
+	}
+	s.AdminStatus = yang.Status(i.AdminStatus)
+	s.OperStatus = yang.Status(i.OperStatus)
+	// speed is in bits/sec
+	s.IfHighSpeed = uint64(i.Speed) / 1000000
+
+	st := i.Statistics
+	s.IfHCInOctets = uint64(st.InOctets)
+	s.InUcastPkts = uint64(st.InUnicastPkts)
+	s.InMulticastPkts = uint64(st.InMulticastPkts)
+	s.InBroadcastPkts = uint64(st.InBroadcastPkts)
+	s.InPkts = s.InUcastPkts + s.InMulticastPkts + s.InBroadcastPkts
+	s.InDiscards = uint64(st.InDiscards)
+	s.InErrors = uint64(st.InErrors)
+	s.IfHCOutOctets = uint64(st.OutOctets)
+	s.OutUcastPkts = uint64(st.OutUnicastPkts)
+	s.OutMulticastPkts = uint64(st.OutMulticastPkts)
+	s.OutBroadcastPkts = uint64(st.OutBroadcastPkts)
+	s.OutPkts = s.OutUcastPkts + s.OutMulticastPkts + s.OutBroadcastPkts
+	s.OutDiscards = uint64(st.OutDiscards)
+	s.OutErrors = uint64(st.OutErrors)
+}
+
+// fill in a sample from an openconfig-interfaces interface.
+func (s *InterfaceSample) addOpenConfigInterface(i yang.OpenConfigInterface) {
+	st := i.State
+	if st.IfIndex != 0 {
+		s.IfId = strconv.Itoa(st.IfIndex)
+	}
+	if st.Description != "" {
+		s.Description = st.Description
+	}
+	if st.Mtu != 0 {
+		s.MTU = st.Mtu
+	}
+	s.AdminStatus = yang.Status(st.AdminStatus)
+	s.OperStatus = yang.Status(st.OperStatus)
+
+	c := st.Counters
+	s.IfHCInOctets = uint64(c.InOctets)
+	s.InUcastPkts = uint64(c.InUnicastPkts)
+	s.InMulticastPkts = uint64(c.InMulticastPkts)
+	s.InBroadcastPkts = uint64(c.InBroadcastPkts)
+	s.InPkts = s.InUcastPkts + s.InMulticastPkts + s.InBroadcastPkts
+	s.InDiscards = uint64(c.InDiscards)
+	s.InErrors = uint64(c.InErrors)
+	s.InCRC = uint64(c.InFcsErrors)
+	s.IfHCOutOctets = uint64(c.OutOctets)
+	s.OutUcastPkts = uint64(c.OutUnicastPkts)
+	s.OutMulticastPkts = uint64(c.OutMulticastPkts)
+	s.OutBroadcastPkts = uint64(c.OutBroadcastPkts)
+	s.OutPkts = s.OutUcastPkts + s.OutMulticastPkts + s.OutBroadcastPkts
+	s.OutDiscards = uint64(c.OutDiscards)
+	s.OutErrors = uint64(c.OutErrors)
+}
+
+// parseCounter reads a counter we stored as a string.  Empty or garbage is 0.
+func parseCounter(s string) uint64 {
+	u, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return u
+}
+
+// ifStatus translates IF-MIB ifAdminStatus/ifOperStatus to the words NX-OS
+// uses so both collectors report the same thing.
+func ifStatus(s string) string {
+	switch s {
+	case "1":
+		return "up"
+	case "2":
+		return "down"
+	case "3":
+		return "testing"
+	case "4":
+		return "unknown"
+	case "5":
+		return "dormant"
+	case "6":
+		return "notPresent"
+	case "7":
+		return "lowerLayerDown"
+	}
+	return ""
+}
+
+// sampleSet gathers the samples for one switch by interface name so
+// collectors can fill them in from several commands or queries.  The order
+// interfaces were first seen in is kept for the output.
+type sampleSet struct {
+	sw      string
+	now     int64
+	samples map[string]*InterfaceSample
+	order   []string
+}
+
+func newSampleSet(sw string, now int64) *sampleSet {
+	return &sampleSet{sw: sw, now: now, samples: map[string]*InterfaceSample{}}
+}
+
+// get returns the sample for the interface, creating it if needed.
+func (ss *sampleSet) get(name string) *InterfaceSample {
+	if ss.samples[name] == nil {
+		ss.samples[name] = &InterfaceSample{Switch: ss.sw, IfName: name, IfKey: interfaceKey(name), TimeStamp: ss.now}
+		ss.order = append(ss.order, name)
+	}
+	return ss.samples[name]
+}
+
+// remove drops the sample for the interface.
+func (ss *sampleSet) remove(name string) {
+	if ss.samples[name] == nil {
+		return
+	}
+	delete(ss.samples, name)
+	for i, n := range ss.order {
+		if n == name {
+			ss.order = append(ss.order[:i], ss.order[i+1:]...)
+			break
+		}
+	}
+}
+
+// list returns the samples, with the ifIndex we know for interfaces the
+// switch didn't give one for.
+func (ss *sampleSet) list() []InterfaceSample {
+	l := []InterfaceSample{}
+	for _, name := range ss.order {
+		s := *ss.samples[name]
+		if s.IfId == "" {
+			if i, ok := interfaceIdentity(ss.sw, name); ok {
+				s.IfId = i.IfIndex
+			}
+		}
+		l = append(l, s)
+	}
+	return l
+}
+
+// What the last SNMP poll of each endpoint called the switch and its
+// interfaces.  Flow exporters only tell us an ifIndex so we look the names
+// up here.
+var knownInterfaces = struct {
+	sync.Mutex
+	m map[string]interfaceNames
+}{m: map[string]interfaceNames{}}
+
+type interfaceNames struct {
+	sw    string
+	names map[string]string
+}
+
+// rememberInterfaces keeps the ifIndex to name map from an SNMP poll of
+// endpoint.
+func rememberInterfaces(endpoint string, sw string, names map[string]string) {
+	knownInterfaces.Lock()
+	defer knownInterfaces.Unlock()
+	knownInterfaces.m[endpoint] = interfaceNames{sw, names}
+}
+
+// identityName is what a sample would call the interface.
+func identityName(i InterfaceIdentity) string {
+	for _, name := range []string{i.IfDescr, i.NXOSName, i.IfName} {
+		if name != "" {
+			return name
+		}
+	}
+	return i.Key
+}
+
+// lookupInterface returns the switch name and interface name for an ifIndex
+// on endpoint.  If we haven't polled it we go with the endpoint and the
+// ifIndex.
+func lookupInterface(endpoint string, ifIndex string) (string, string) {
+	knownInterfaces.Lock()
+	defer knownInterfaces.Unlock()
+	known, ok := knownInterfaces.m[endpoint]
+	if !ok {
+		// we may know it from before we started.
+		if sw, i, ok := identityByIndex(endpoint, ifIndex); ok {
+			return sw, identityName(i)
+		}
+		return endpoint, ifIndex
+	}
+	sw := known.sw
+	if sw == "" {
+		sw = endpoint
+	}
+	if name, ok := known.names[ifIndex]; ok {
+		return sw, name
+	}
+	return sw, ifIndex
+}
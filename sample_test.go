@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/vallard/stickypipe-agent/nxapi"
+)
+
+func TestAddNXAPIInterfaceKeepsCounters(t *testing.T) {
+	// mgmt0 has its counters in show interface counters but only vdc_lvl_
+	// ones in show interface.
+	s := InterfaceSample{IfHCInOctets: 1000, IfHCOutOctets: 2000, InPkts: 10, OutPkts: 20}
+	s.addNXAPIInterface(nxapi.Interface{Interface: "mgmt0", State: "up"})
+	if s.IfHCInOctets != 1000 || s.IfHCOutOctets != 2000 || s.InPkts != 10 || s.OutPkts != 20 {
+		t.Errorf("counters wiped: %+v", s)
+	}
+	if s.OperStatus != "up" {
+		t.Errorf("oper status %q", s.OperStatus)
+	}
+
+	s.addNXAPIInterface(nxapi.Interface{Interface: "mgmt0", Eth_Inbytes: 1500, Eth_Outbytes: 2500})
+	if s.IfHCInOctets != 1500 || s.IfHCOutOctets != 2500 {
+		t.Errorf("counters not updated: %+v", s)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/vallard/stickypipe-agent/sflow"
+)
+
+/*
+	Receive sFlow from switches
+
+Arguments:
+
+	listen - address to listen on, like :6343
+	devices - what endpointAddresses returned, to find the switch name
+	flows - where the flow samples get added up
+
+Counter samples are sent up right away as interface samples.  Flow samples
+are added to flows which sends the top talkers every interval.  Runs until
+ctx is cancelled.
+*/
+func receiveSFlow(ctx context.Context, listen string, devices map[string]string, flows *flowTable) {
+	conn, err := net.ListenPacket("udp", listen)
+	if err != nil {
+		log.Println("sflow receiver: ", err)
+		return
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Println("sflow receiver: ", err)
+			continue
+		}
+		d, err := sflow.Decode(buf[:n])
+		if err != nil {
+			// we still use the samples before the bad one.
+			log.Println("sflow from", addr, err)
+			if d == nil {
+				continue
+			}
+		}
+		source, _, _ := net.SplitHostPort(addr.String())
+		processSFlowDatagram(flowEndpoint(devices, d.AgentAddress, source), d, flows, time.Now().Unix())
+	}
+}
+
+// flowEndpoint works out which configured switch sent us flows.  The agent
+// address in the datagram is the better bet since it may be sent from
+// another interface, then where the packet came from.
+func flowEndpoint(devices map[string]string, agent net.IP, source string) string {
+	if agent != nil {
+		if name, ok := devices[agent.String()]; ok {
+			return name
+		}
+	}
+	if name, ok := devices[source]; ok {
+		return name
+	}
+	if agent != nil && !agent.IsUnspecified() {
+		return agent.String()
+	}
+	return source
+}
+
+func processSFlowDatagram(endpoint string, d *sflow.Datagram, flows *flowTable, now int64) {
+	for _, s := range d.FlowSamples {
+		if s.Packet == nil {
+			continue
+		}
+		rate := uint64(s.SamplingRate)
+		if rate == 0 {
+			rate = 1
+		}
+		c := Conversation{
+			SrcAddr:  s.Packet.SrcIP.String(),
+			DstAddr:  s.Packet.DstIP.String(),
+			Protocol: s.Packet.Protocol,
+			SrcPort:  s.Packet.SrcPort,
+			DstPort:  s.Packet.DstPort,
+			Bytes:    uint64(s.Packet.Length) * rate,
+			Packets:  rate,
+		}
+		flows.add(endpoint, s.Input, "in", "sflow", c)
+		flows.add(endpoint, s.Output, "out", "sflow", c)
+	}
+
+	if len(d.CounterSamples) == 0 {
+		return
+	}
+	var swi string
+	samples := []InterfaceSample{}
+	for _, cs := range d.CounterSamples {
+		g := cs.Generic
+		if g == nil {
+			continue
+		}
+		ifId := strconv.FormatUint(uint64(g.IfIndex), 10)
+		sw, name := lookupInterface(endpoint, ifId)
+		swi = sw
+		s := InterfaceSample{
+			Switch:      sw,
+			IfName:      name,
+			IfId:        ifId,
+			IfKey:       interfaceKey(name),
+			TimeStamp:   now,
+			AdminStatus: "down",
+			OperStatus:  "down",
+			// ifSpeed is in bits per second
+			IfHighSpeed: g.IfSpeed / 1000000,
+
+			IfHCInOctets:     g.IfInOctets,
+			InUcastPkts:      uint64(g.IfInUcastPkts),
+			InMulticastPkts:  uint64(g.IfInMulticastPkts),
+			InBroadcastPkts:  uint64(g.IfInBroadcastPkts),
+			IfHCOutOctets:    g.IfOutOctets,
+			OutUcastPkts:     uint64(g.IfOutUcastPkts),
+			OutMulticastPkts: uint64(g.IfOutMulticastPkts),
+			OutBroadcastPkts: uint64(g.IfOutBroadcastPkts),
+
+			InErrors:    uint64(g.IfInErrors),
+			OutErrors:   uint64(g.IfOutErrors),
+			InDiscards:  uint64(g.IfInDiscards),
+			OutDiscards: uint64(g.IfOutDiscards),
+		}
+		s.InPkts = s.InUcastPkts + s.InMulticastPkts + s.InBroadcastPkts
+		s.OutPkts = s.OutUcastPkts + s.OutMulticastPkts + s.OutBroadcastPkts
+		if g.AdminUp() {
+			s.AdminStatus = "up"
+		}
+		if g.OperUp() {
+			s.OperStatus = "up"
+		}
+		// ifDirection 1 is full, 2 half.
+		switch g.IfDirection {
+		case 1:
+			s.Duplex = "full"
+		case 2:
+			s.Duplex = "half"
+		}
+		if e := cs.Ethernet; e != nil {
+			s.InCRC = uint64(e.FCSErrors)
+			s.InGiants = uint64(e.FrameTooLongs)
+		}
+		samples = append(samples, s)
+	}
+	if len(samples) > 0 {
+		sendUpstream(map[string][]InterfaceSample{swi: samples})
+	}
+}
@@ -0,0 +1,397 @@
+/*
+Package sflow decodes sFlow version 5 datagrams (https://sflow.org/sflow_version_5.txt).
+
+Only what the agent uses is decoded: generic interface and ethernet counter
+samples, and flow samples down to the addresses, ports and protocol of the
+sampled packet.  Everything else is skipped over.
+*/
+package sflow
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+)
+
+// Datagram is one sFlow datagram from a switch.
+type Datagram struct {
+	AgentAddress   net.IP
+	SubAgentID     uint32
+	SequenceNumber uint32
+	Uptime         uint32
+	FlowSamples    []FlowSample
+	CounterSamples []CounterSample
+}
+
+// FlowSample is one sampled packet.  Input and Output are ifIndexes, 0 if
+// the switch doesn't know (or it is a special value like a discard).
+type FlowSample struct {
+	SourceIDType  uint32
+	SourceIDIndex uint32
+	SamplingRate  uint32
+	SamplePool    uint32
+	Drops         uint32
+	Input         uint32
+	Output        uint32
+	// nil if there was no header or IP record we understand.
+	Packet *Packet
+}
+
+// Packet is what we pull out of the sampled packet.
+type Packet struct {
+	// length of the packet on the wire.
+	Length   uint32
+	SrcIP    net.IP
+	DstIP    net.IP
+	Protocol uint8
+	SrcPort  uint16
+	DstPort  uint16
+	TOS      uint8
+}
+
+// CounterSample is the counters of one interface.
+type CounterSample struct {
+	SourceIDType  uint32
+	SourceIDIndex uint32
+	Generic       *GenericInterfaceCounters
+	Ethernet      *EthernetCounters
+}
+
+// GenericInterfaceCounters is the if_counters record, IF-MIB by another
+// name.
+type GenericInterfaceCounters struct {
+	IfIndex            uint32
+	IfType             uint32
+	IfSpeed            uint64
+	IfDirection        uint32
+	IfStatus           uint32
+	IfInOctets         uint64
+	IfInUcastPkts      uint32
+	IfInMulticastPkts  uint32
+	IfInBroadcastPkts  uint32
+	IfInDiscards       uint32
+	IfInErrors         uint32
+	IfInUnknownProtos  uint32
+	IfOutOctets        uint64
+	IfOutUcastPkts     uint32
+	IfOutMulticastPkts uint32
+	IfOutBroadcastPkts uint32
+	IfOutDiscards      uint32
+	IfOutErrors        uint32
+	IfPromiscuousMode  uint32
+}
+
+// AdminUp and OperUp read ifStatus.
+func (c GenericInterfaceCounters) AdminUp() bool { return c.IfStatus&1 != 0 }
+func (c GenericInterfaceCounters) OperUp() bool  { return c.IfStatus&2 != 0 }
+
+// EthernetCounters is the ethernet_counters record, EtherLike-MIB.
+type EthernetCounters struct {
+	AlignmentErrors           uint32
+	FCSErrors                 uint32
+	SingleCollisionFrames     uint32
+	MultipleCollisionFrames   uint32
+	SQETestErrors             uint32
+	DeferredTransmissions     uint32
+	LateCollisions            uint32
+	ExcessiveCollisions       uint32
+	InternalMacTransmitErrors uint32
+	CarrierSenseErrors        uint32
+	FrameTooLongs             uint32
+	InternalMacReceiveErrors  uint32
+	SymbolErrors              uint32
+}
+
+// sample and record formats, enterprise 0.
+const (
+	formatFlowSample            = 1
+	formatCounterSample         = 2
+	formatExpandedFlowSample    = 3
+	formatExpandedCounterSample = 4
+
+	recordRawHeader   = 1
+	recordSampledIPv4 = 3
+	recordSampledIPv6 = 4
+
+	recordGenericInterface = 1
+	recordEthernet         = 2
+
+	headerProtocolEthernet = 1
+)
+
+var errShort = errors.New("sflow: datagram too short")
+
+// reader reads XDR, everything is big endian and padded to 4 bytes.
+type reader struct {
+	b   []byte
+	err error
+}
+
+func (r *reader) bytes(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	padded := (n + 3) &^ 3
+	if n < 0 || len(r.b) < padded {
+		r.err = errShort
+		r.b = nil
+		return nil
+	}
+	b := r.b[:n]
+	r.b = r.b[padded:]
+	return b
+}
+
+func (r *reader) uint32() uint32 {
+	b := r.bytes(4)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+func (r *reader) uint64() uint64 {
+	b := r.bytes(8)
+	if b == nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(b)
+}
+
+func (r *reader) address() net.IP {
+	switch r.uint32() {
+	case 1:
+		return net.IP(r.bytes(4))
+	case 2:
+		return net.IP(r.bytes(16))
+	}
+	return nil
+}
+
+// Decode decodes a datagram.  Samples we can't read are skipped.  The
+// addresses point into b so copy them if b is going to be reused.
+func Decode(b []byte) (*Datagram, error) {
+	r := &reader{b: b}
+	if v := r.uint32(); v != 5 {
+		if r.err != nil {
+			return nil, r.err
+		}
+		return nil, fmt.Errorf("sflow: unsupported version %d", v)
+	}
+	d := &Datagram{}
+	d.AgentAddress = r.address()
+	d.SubAgentID = r.uint32()
+	d.SequenceNumber = r.uint32()
+	d.Uptime = r.uint32()
+	n := r.uint32()
+	for i := uint32(0); i < n && r.err == nil; i++ {
+		format := r.uint32()
+		data := &reader{b: r.bytes(int(r.uint32()))}
+		if r.err != nil {
+			break
+		}
+		switch format {
+		case formatFlowSample:
+			s := FlowSample{}
+			data.uint32()
+			s.SourceIDType, s.SourceIDIndex = splitSourceID(data.uint32())
+			s.SamplingRate = data.uint32()
+			s.SamplePool = data.uint32()
+			s.Drops = data.uint32()
+			in, out := data.uint32(), data.uint32()
+			s.Input = ifIndex(in>>30, in&0x3fffffff)
+			s.Output = ifIndex(out>>30, out&0x3fffffff)
+			s.Packet = flowRecords(data)
+			d.FlowSamples = append(d.FlowSamples, s)
+		case formatExpandedFlowSample:
+			s := FlowSample{}
+			data.uint32()
+			s.SourceIDType = data.uint32()
+			s.SourceIDIndex = data.uint32()
+			s.SamplingRate = data.uint32()
+			s.SamplePool = data.uint32()
+			s.Drops = data.uint32()
+			s.Input = ifIndex(data.uint32(), data.uint32())
+			s.Output = ifIndex(data.uint32(), data.uint32())
+			s.Packet = flowRecords(data)
+			d.FlowSamples = append(d.FlowSamples, s)
+		case formatCounterSample:
+			s := CounterSample{}
+			data.uint32()
+			s.SourceIDType, s.SourceIDIndex = splitSourceID(data.uint32())
+			counterRecords(data, &s)
+			d.CounterSamples = append(d.CounterSamples, s)
+		case formatExpandedCounterSample:
+			s := CounterSample{}
+			data.uint32()
+			s.SourceIDType = data.uint32()
+			s.SourceIDIndex = data.uint32()
+			counterRecords(data, &s)
+			d.CounterSamples = append(d.CounterSamples, s)
+		}
+	}
+	return d, r.err
+}
+
+// ifIndex is the ifIndex in a flow sample's input or output, 0 unless
+// format says it is a single interface.  Format 1 is a discarded packet,
+// with the reason in value, and format 2 went out more than one interface.
+// 0x3fffffff is the switch itself.
+func ifIndex(format uint32, value uint32) uint32 {
+	if format != 0 || value == 0x3fffffff {
+		return 0
+	}
+	return value
+}
+
+func splitSourceID(id uint32) (uint32, uint32) {
+	return id >> 24, id & 0xffffff
+}
+
+// flowRecords reads the records of a flow sample and returns the packet
+// from the first one we understand.
+func flowRecords(r *reader) *Packet {
+	var p *Packet
+	n := r.uint32()
+	for i := uint32(0); i < n && r.err == nil; i++ {
+		format := r.uint32()
+		data := &reader{b: r.bytes(int(r.uint32()))}
+		if p != nil {
+			continue
+		}
+		switch format {
+		case recordRawHeader:
+			protocol := data.uint32()
+			length := data.uint32()
+			data.uint32()
+			header := data.bytes(int(data.uint32()))
+			if data.err == nil && protocol == headerProtocolEthernet {
+				p = parseEthernet(header)
+				if p != nil {
+					p.Length = length
+				}
+			}
+		case recordSampledIPv4, recordSampledIPv6:
+			size := 4
+			if format == recordSampledIPv6 {
+				size = 16
+			}
+			q := &Packet{}
+			q.Length = data.uint32()
+			q.Protocol = uint8(data.uint32())
+			q.SrcIP = net.IP(data.bytes(size))
+			q.DstIP = net.IP(data.bytes(size))
+			q.SrcPort = uint16(data.uint32())
+			q.DstPort = uint16(data.uint32())
+			data.uint32()
+			q.TOS = uint8(data.uint32())
+			if data.err == nil {
+				p = q
+			}
+		}
+	}
+	return p
+}
+
+func counterRecords(r *reader, s *CounterSample) {
+	n := r.uint32()
+	for i := uint32(0); i < n && r.err == nil; i++ {
+		format := r.uint32()
+		data := &reader{b: r.bytes(int(r.uint32()))}
+		switch format {
+		case recordGenericInterface:
+			c := &GenericInterfaceCounters{
+				IfIndex:            data.uint32(),
+				IfType:             data.uint32(),
+				IfSpeed:            data.uint64(),
+				IfDirection:        data.uint32(),
+				IfStatus:           data.uint32(),
+				IfInOctets:         data.uint64(),
+				IfInUcastPkts:      data.uint32(),
+				IfInMulticastPkts:  data.uint32(),
+				IfInBroadcastPkts:  data.uint32(),
+				IfInDiscards:       data.uint32(),
+				IfInErrors:         data.uint32(),
+				IfInUnknownProtos:  data.uint32(),
+				IfOutOctets:        data.uint64(),
+				IfOutUcastPkts:     data.uint32(),
+				IfOutMulticastPkts: data.uint32(),
+				IfOutBroadcastPkts: data.uint32(),
+				IfOutDiscards:      data.uint32(),
+				IfOutErrors:        data.uint32(),
+				IfPromiscuousMode:  data.uint32(),
+			}
+			if data.err == nil {
+				s.Generic = c
+			}
+		case recordEthernet:
+			c := &EthernetCounters{
+				AlignmentErrors:           data.uint32(),
+				FCSErrors:                 data.uint32(),
+				SingleCollisionFrames:     data.uint32(),
+				MultipleCollisionFrames:   data.uint32(),
+				SQETestErrors:             data.uint32(),
+				DeferredTransmissions:     data.uint32(),
+				LateCollisions:            data.uint32(),
+				ExcessiveCollisions:       data.uint32(),
+				InternalMacTransmitErrors: data.uint32(),
+				CarrierSenseErrors:        data.uint32(),
+				FrameTooLongs:             data.uint32(),
+				InternalMacReceiveErrors:  data.uint32(),
+				SymbolErrors:              data.uint32(),
+			}
+			if data.err == nil {
+				s.Ethernet = c
+			}
+		}
+	}
+}
+
+// parseEthernet digs the IP header out of a sampled ethernet frame.
+func parseEthernet(b []byte) *Packet {
+	if len(b) < 14 {
+		return nil
+	}
+	etherType := binary.BigEndian.Uint16(b[12:])
+	b = b[14:]
+	// 802.1Q and QinQ tags.
+	for (etherType == 0x8100 || etherType == 0x88a8) && len(b) >= 4 {
+		etherType = binary.BigEndian.Uint16(b[2:])
+		b = b[4:]
+	}
+	p := &Packet{}
+	var l4 []byte
+	switch etherType {
+	case 0x0800:
+		if len(b) < 20 {
+			return nil
+		}
+		ihl := int(b[0]&0x0f) * 4
+		p.TOS = b[1]
+		p.Protocol = b[9]
+		p.SrcIP = net.IP(b[12:16])
+		p.DstIP = net.IP(b[16:20])
+		// only the first fragment has the ports.
+		if binary.BigEndian.Uint16(b[6:])&0x1fff == 0 && len(b) >= ihl {
+			l4 = b[ihl:]
+		}
+	case 0x86dd:
+		if len(b) < 40 {
+			return nil
+		}
+		p.TOS = uint8(binary.BigEndian.Uint16(b[0:]) >> 4)
+		p.Protocol = b[6]
+		p.SrcIP = net.IP(b[8:24])
+		p.DstIP = net.IP(b[24:40])
+		l4 = b[40:]
+	default:
+		return nil
+	}
+	// TCP, UDP and SCTP all start with the ports.
+	if (p.Protocol == 6 || p.Protocol == 17 || p.Protocol == 132) && len(l4) >= 4 {
+		p.SrcPort = binary.BigEndian.Uint16(l4[0:])
+		p.DstPort = binary.BigEndian.Uint16(l4[2:])
+	}
+	return p
+}
@@ -0,0 +1,246 @@
+package sflow
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"reflect"
+	"testing"
+)
+
+// nexus is laid out the way a Nexus 9000 sends it: a flow sample with a
+// raw header record of an 802.1Q tagged TCP packet and an extended switch
+// record, and a counter sample with generic and ethernet counters.
+const nexus = "00000005000000010a00000100000000000004d20036ee800000000200000001" +
+	"0000008c0000004d00000005000003e8004c4b40000000000000000500000007" +
+	"00000002000000010000004c00000001000005ee000000040000003a00225566" +
+	"aabb0050568a01028100000a0800452805dc1234000040064bbb0a0101010a02" +
+	"0202c00001bb00000001000000005010ffff000000000000000003e900000010" +
+	"0000000a00000000000000140000000000000002000000a80000000900000005" +
+	"000000020000000100000058000000050000000600000002540be40000000001" +
+	"000000030000001cbe991a14000003e8000000c80000012c0000000100000002" +
+	"0000000000000016fee0e52d000007d000000190000001f40000000300000004" +
+	"0000000000000002000000340000000100000002000000030000000400000005" +
+	"000000060000000700000008000000090000000a0000000b0000000c0000000d"
+
+// expanded comes from an IPv6 agent: an expanded flow sample with a
+// sampled IPv6 record, an enterprise sample, a flow sample of a non-first
+// IPv4 fragment behind an enterprise record, and an expanded counter
+// sample with a record we don't read before the generic counters.
+const expanded = "0000000500000002fe8000000000000000000000000000010000000100000063" +
+	"0000ea6000000004000000030000006c0000004e000000000100004900000200" +
+	"0000040000000003000000000100004900000000010000500000000100000004" +
+	"00000038000005000000001120010db800000000000000000000000120010db8" +
+	"00000000000000000000000200000035000080e800000000000000000113d005" +
+	"00000008000000000000000000000001000000700000004f0000000600000100" +
+	"00000800000000000000000600000008000000020113d0010000000800000001" +
+	"00000002000000010000003800000001000003e8000000000000002600225566" +
+	"aabb0050568a01020800450003e8123400b94011490b0a0303030a0404041234" +
+	"5678000000000004000000840000000a000000000100004900000002000003ed" +
+	"0000000c00000001000000020000000300000001000000580000000500000006" +
+	"00000002540be40000000001000000030000001cbe991a14000003e8000000c8" +
+	"0000012c00000001000000020000000000000016fee0e52d000007d000000190" +
+	"000001f4000000030000000400000000"
+
+func datagram(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func ip(s string) net.IP {
+	if v4 := net.ParseIP(s).To4(); v4 != nil {
+		return v4
+	}
+	return net.ParseIP(s)
+}
+
+var generic = &GenericInterfaceCounters{
+	IfIndex:            5,
+	IfType:             6,
+	IfSpeed:            10000000000,
+	IfDirection:        1,
+	IfStatus:           3,
+	IfInOctets:         123456789012,
+	IfInUcastPkts:      1000,
+	IfInMulticastPkts:  200,
+	IfInBroadcastPkts:  300,
+	IfInDiscards:       1,
+	IfInErrors:         2,
+	IfOutOctets:        98765432109,
+	IfOutUcastPkts:     2000,
+	IfOutMulticastPkts: 400,
+	IfOutBroadcastPkts: 500,
+	IfOutDiscards:      3,
+	IfOutErrors:        4,
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name string
+		b    string
+		want *Datagram
+	}{
+		{
+			name: "nexus",
+			b:    nexus,
+			want: &Datagram{
+				AgentAddress:   ip("10.0.0.1"),
+				SequenceNumber: 1234,
+				Uptime:         3600000,
+				FlowSamples: []FlowSample{{
+					SourceIDIndex: 5,
+					SamplingRate:  1000,
+					SamplePool:    5000000,
+					Input:         5,
+					Output:        7,
+					Packet: &Packet{
+						Length:   1518,
+						SrcIP:    ip("10.1.1.1"),
+						DstIP:    ip("10.2.2.2"),
+						Protocol: 6,
+						SrcPort:  49152,
+						DstPort:  443,
+						TOS:      0x28,
+					},
+				}},
+				CounterSamples: []CounterSample{{
+					SourceIDIndex: 5,
+					Generic:       generic,
+					Ethernet:      &EthernetCounters{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13},
+				}},
+			},
+		},
+		{
+			name: "expanded",
+			b:    expanded,
+			want: &Datagram{
+				AgentAddress:   ip("fe80::1"),
+				SubAgentID:     1,
+				SequenceNumber: 99,
+				Uptime:         60000,
+				FlowSamples: []FlowSample{
+					{
+						SourceIDIndex: 0x1000049,
+						SamplingRate:  512,
+						SamplePool:    1024,
+						Drops:         3,
+						Input:         0x1000049,
+						Output:        0x1000050,
+						Packet: &Packet{
+							Length:   1280,
+							SrcIP:    ip("2001:db8::1"),
+							DstIP:    ip("2001:db8::2"),
+							Protocol: 17,
+							SrcPort:  53,
+							DstPort:  33000,
+						},
+					},
+					{
+						SourceIDIndex: 6,
+						SamplingRate:  256,
+						SamplePool:    2048,
+						Input:         6,
+						Output:        8,
+						Packet: &Packet{
+							Length:   1000,
+							SrcIP:    ip("10.3.3.3"),
+							DstIP:    ip("10.4.4.4"),
+							Protocol: 17,
+						},
+					},
+				},
+				CounterSamples: []CounterSample{{
+					SourceIDIndex: 0x1000049,
+					Generic:       generic,
+				}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		got, err := Decode(datagram(t, tt.b))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s:\ngot  %+v\nwant %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeInterfaceFormats(t *testing.T) {
+	tests := []struct {
+		name   string
+		b      string
+		at     int
+		words  []uint32
+		input  uint32
+		output uint32
+	}{
+		// compact: the format is the top 2 bits.
+		{"discarded", nexus, 0x38, []uint32{5, 0x40000000 | 258}, 5, 0},
+		{"multiple outputs", nexus, 0x38, []uint32{5, 0x80000003}, 5, 0},
+		{"from the switch", nexus, 0x38, []uint32{0x3fffffff, 7}, 0, 7},
+		{"high ifIndex", nexus, 0x38, []uint32{0x2000001, 0x3ffffffe}, 0x2000001, 0x3ffffffe},
+		// expanded: the format is a word of its own.
+		{"expanded discarded", expanded, 0x48, []uint32{0, 6, 1, 258}, 6, 0},
+		{"expanded multiple outputs", expanded, 0x48, []uint32{0, 6, 2, 3}, 6, 0},
+		{"expanded from the switch", expanded, 0x48, []uint32{0, 0x3fffffff, 0, 8}, 0, 8},
+	}
+	for _, tt := range tests {
+		b := datagram(t, tt.b)
+		for i, w := range tt.words {
+			binary.BigEndian.PutUint32(b[tt.at+4*i:], w)
+		}
+		d, err := Decode(b)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if s := d.FlowSamples[0]; s.Input != tt.input || s.Output != tt.output || s.Packet == nil {
+			t.Errorf("%s: got %+v", tt.name, s)
+		}
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	for _, s := range []string{nexus, expanded} {
+		b := datagram(t, s)
+		for i := 0; i < len(b); i++ {
+			if _, err := Decode(b[:i]); err == nil {
+				t.Errorf("%d of %d bytes decoded", i, len(b))
+			}
+		}
+	}
+}
+
+func TestDecodeBadLengths(t *testing.T) {
+	// the raw header record of nexus says its header is bigger than the
+	// record, then the record that it's bigger than the sample.
+	for _, at := range []int{0x58, 0x48} {
+		b := datagram(t, nexus)
+		binary.BigEndian.PutUint32(b[at:], 0xfffffff0)
+		d, err := Decode(b)
+		if err != nil {
+			t.Errorf("%#x: %v", at, err)
+			continue
+		}
+		if len(d.FlowSamples) != 1 || d.FlowSamples[0].Packet != nil || len(d.CounterSamples) != 1 {
+			t.Errorf("%#x: got %+v", at, d)
+		}
+	}
+
+	// more samples than there are.
+	b := datagram(t, nexus)
+	binary.BigEndian.PutUint32(b[0x18:], 0xffffffff)
+	if d, err := Decode(b); err == nil || len(d.FlowSamples) != 1 || len(d.CounterSamples) != 1 {
+		t.Errorf("got %+v %v", d, err)
+	}
+
+	if _, err := Decode(datagram(t, "00000004")); err == nil {
+		t.Error("version 4 decoded")
+	}
+}
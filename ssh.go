@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/vallard/stickypipe-agent/cli"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSH settings, set from the environment in main.  NETCONF runs over SSH so
+// it shares them.
+var sshSettings struct {
+	Port        int
+	NetconfPort int
+	KeyFile     string
+	KnownHosts  string
+	// take whatever host key the switch gives us, SP_SSH_INSECURE.
+	Insecure bool
+}
+
+// The command to list interfaces for each OS.
+var sshInterfaceCommand = map[string]string{
+	cli.IOS:  "show interfaces",
+	cli.NXOS: "show interface",
+	cli.EOS:  "show interfaces",
+}
+
+// sshClientConfig logs in with the password if there is one and with
+// SP_SSH_KEY if that is set.  Credentials look like admin:cisco, or just
+// admin: when using a key.
+func sshClientConfig(creds string) (*ssh.ClientConfig, error) {
+	user, pass, err := splitCredentials(creds)
+	if err != nil {
+		return nil, err
+	}
+	auth := []ssh.AuthMethod{}
+	if pass != "" {
+		auth = append(auth, ssh.Password(pass))
+		// some IOS versions only do keyboard-interactive.
+		auth = append(auth, ssh.KeyboardInteractive(func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+			answers := make([]string, len(questions))
+			for i := range answers {
+				answers[i] = pass
+			}
+			return answers, nil
+		}))
+	}
+	if sshSettings.KeyFile != "" {
+		pem, err := ioutil.ReadFile(sshSettings.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		signer, err := ssh.ParsePrivateKey(pem)
+		if err != nil {
+			return nil, err
+		}
+		auth = append(auth, ssh.PublicKeys(signer))
+	}
+	// host keys are checked unless the user has told us not to.
+	var hostKey ssh.HostKeyCallback
+	switch {
+	case sshSettings.KnownHosts != "":
+		hostKey, err = knownhosts.New(sshSettings.KnownHosts)
+		if err != nil {
+			return nil, err
+		}
+	case sshSettings.Insecure:
+		hostKey = ssh.InsecureIgnoreHostKey()
+	default:
+		return nil, fmt.Errorf("no SP_SSH_KNOWN_HOSTS to check the host key against, set it or SP_SSH_INSECURE=true")
+	}
+	return &ssh.ClientConfig{
+		User:            user,
+		Auth:            auth,
+		HostKeyCallback: hostKey,
+		Timeout:         30 * time.Second,
+	}, nil
+}
+
+// sshRun runs one command in its own session and returns what it printed.
+func sshRun(client *ssh.Client, cmd string) (string, error) {
+	session, err := client.NewSession()
+	if err != nil {
+		return "", err
+	}
+	defer session.Close()
+	out, err := session.Output(cmd)
+	if err != nil {
+		return string(out), fmt.Errorf("%s: %v", cmd, err)
+	}
+	return string(out), nil
+}
+
+/*
+	Get interface counters by scraping the CLI over SSH
+
+Arguments:
+
+	server - switch (10.93.234.3, c2960g, or something reachable)
+	creds - user/password pair that looks like admin:cisco
+
+We run show version first to figure out which OS we're talking to and then
+run the right show interfaces for it.
+*/
+func collectSSH(server string, creds string) {
+	config, err := sshClientConfig(creds)
+	if err != nil {
+		log.Println(server, err)
+		return
+	}
+	addr := net.JoinHostPort(server, strconv.Itoa(sshSettings.Port))
+	client, err := ssh.Dial("tcp", addr, config)
+	if err != nil {
+		log.Println(server, err)
+		return
+	}
+	defer client.Close()
+
+	showVersion, err := sshRun(client, "show version")
+	if err != nil {
+		log.Println(server, err)
+		return
+	}
+	os := cli.DetectOS(showVersion)
+	if os == "" {
+		log.Println(server, "can't tell what OS this is from show version")
+		return
+	}
+	// EOS keeps the hostname out of show version.
+	if os == cli.EOS {
+		if h, err := sshRun(client, "show hostname"); err == nil {
+			showVersion += h
+		}
+	}
+	showInterfaces, err := sshRun(client, sshInterfaceCommand[os])
+	if err != nil {
+		log.Println(server, err)
+		return
+	}
+	processCollectedSSHData(server, cli.ParseVersion(showVersion), cli.ParseInterfaces(os, showInterfaces))
+}
+
+// process the scraped CLI output into a device report and interface samples.
+func processCollectedSSHData(sw string, ver cli.Version, ifaces []cli.Interface) {
+	now := time.Now().Unix()
+	swi := sw
+	if ver.Hostname != "" {
+		swi = ver.Hostname
+		sendUpstream(DeviceReport{
+			Switch:    swi,
+			TimeStamp: now,
+			Device: DeviceInfo{
+				Hostname:  ver.Hostname,
+				Model:     ver.Model,
+				OS:        ver.OS,
+				OSVersion: ver.Version,
+				Serial:    ver.Serial,
+			},
+		})
+	}
+
+	samples := newSampleSet(swi, now)
+	for _, i := range ifaces {
+		s := samples.get(i.Name)
+		s.Description = i.Description
+		s.AdminStatus = i.AdminStatus
+		s.OperStatus = i.OperStatus
+		s.IfHighSpeed = i.Bandwidth / 1000
+		s.Duplex = i.Duplex
+		s.MTU = i.MTU
+		s.IfHCInOctets = i.InOctets
+		s.IfHCOutOctets = i.OutOctets
+		s.InPkts = i.InPkts
+		s.InUcastPkts = i.InUcast
+		s.InMulticastPkts = i.InMulticast
+		s.InBroadcastPkts = i.InBroadcast
+		s.OutPkts = i.OutPkts
+		s.OutUcastPkts = i.OutUcast
+		s.OutMulticastPkts = i.OutMulticast
+		s.OutBroadcastPkts = i.OutBroadcast
+		s.InRate = i.InRate
+		s.OutRate = i.OutRate
+		s.InErrors = i.InErrors
+		s.OutErrors = i.OutErrors
+		s.InDiscards = i.InDiscards
+		s.OutDiscards = i.OutDiscards
+		s.InCRC = i.CRC
+		s.InRunts = i.Runts
+		s.InGiants = i.Giants
+	}
+	sendUpstream(map[string][]InterfaceSample{swi: samples.list()})
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+const testShowVersion = `Cisco IOS Software, C2960 Software (C2960-LANBASEK9-M), Version 12.2(55)SE, RELEASE SOFTWARE (fc2)
+c2960g uptime is 1 year, 12 weeks, 3 days, 4 hours, 5 minutes
+cisco WS-C2960G-24TC-L (PowerPC405) processor (revision G0) with 65536K bytes of memory.
+Processor board ID FOC1234X5YZ
+`
+
+const testShowInterfaces = `GigabitEthernet0/1 is up, line protocol is up (connected)
+  Description: uplink
+  MTU 1500 bytes, BW 1000000 Kbit/sec, DLY 10 usec,
+  Full-duplex, 1000Mb/s, media type is 10/100/1000BaseTX
+  Input queue: 0/75/0/0 (size/max/drops/flushes); Total output drops: 0
+  5 minute input rate 2000 bits/sec, 3 packets/sec
+  5 minute output rate 9000 bits/sec, 8 packets/sec
+     3866362551 packets input, 345343003 bytes, 0 no buffer
+     Received 1234 broadcasts (567 multicasts)
+     0 runts, 0 giants, 0 throttles
+     0 input errors, 0 CRC, 0 frame, 0 overrun, 0 ignored
+     123 packets output, 456 bytes, 0 underruns
+     0 output errors, 0 collisions, 1 interface resets
+`
+
+// sshServer is a switch that answers show version and show interfaces
+// with admin:cisco.  It returns the address and host key.
+func sshServer(t *testing.T) (string, ssh.PublicKey) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &ssh.ServerConfig{
+		PasswordCallback: func(c ssh.ConnMetadata, pass []byte) (*ssh.Permissions, error) {
+			if c.User() == "admin" && string(pass) == "cisco" {
+				return nil, nil
+			}
+			return nil, io.EOF
+		},
+	}
+	config.AddHostKey(signer)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveSSH(c, config)
+		}
+	}()
+	sshPub, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l.Addr().String(), sshPub
+}
+
+func serveSSH(c net.Conn, config *ssh.ServerConfig) {
+	_, chans, reqs, err := ssh.NewServerConn(c, config)
+	if err != nil {
+		c.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	for nc := range chans {
+		if nc.ChannelType() != "session" {
+			nc.Reject(ssh.UnknownChannelType, "session only")
+			continue
+		}
+		ch, chReqs, err := nc.Accept()
+		if err != nil {
+			continue
+		}
+		go func() {
+			defer ch.Close()
+			for req := range chReqs {
+				if req.Type != "exec" {
+					req.Reply(false, nil)
+					continue
+				}
+				var cmd struct{ Command string }
+				ssh.Unmarshal(req.Payload, &cmd)
+				req.Reply(true, nil)
+				status := uint32(0)
+				switch cmd.Command {
+				case "show version":
+					io.WriteString(ch, testShowVersion)
+				case "show interfaces":
+					io.WriteString(ch, testShowInterfaces)
+				default:
+					io.WriteString(ch.Stderr(), "% Invalid input detected\n")
+					status = 1
+				}
+				ch.SendRequest("exit-status", false, ssh.Marshal(struct{ Status uint32 }{status}))
+				return
+			}
+		}()
+	}
+}
+
+// useSSHServer points sshSettings at addr, trusting key if it isn't nil.
+func useSSHServer(t *testing.T, addr string, key ssh.PublicKey) string {
+	host, port, _ := net.SplitHostPort(addr)
+	old := sshSettings
+	t.Cleanup(func() { sshSettings = old })
+	sshSettings.Port, _ = strconv.Atoi(port)
+	sshSettings.KeyFile = ""
+	sshSettings.KnownHosts = ""
+	sshSettings.Insecure = false
+	if key != nil {
+		file := filepath.Join(t.TempDir(), "known_hosts")
+		line := knownhosts.Line([]string{knownhosts.Normalize(addr)}, key)
+		if err := ioutil.WriteFile(file, []byte(line+"\n"), 0600); err != nil {
+			t.Fatal(err)
+		}
+		sshSettings.KnownHosts = file
+	}
+	return host
+}
+
+func TestCollectSSH(t *testing.T) {
+	addr, key := sshServer(t)
+	host := useSSHServer(t, addr, key)
+	lines := captureUpstream(t, func() { collectSSH(host, "admin:cisco") })
+	if len(lines) != 2 {
+		t.Fatalf("sent %d lines, want a device and its interfaces: %q", len(lines), lines)
+	}
+	var device DeviceReport
+	if err := json.Unmarshal([]byte(lines[0]), &device); err != nil {
+		t.Fatal(err)
+	}
+	if device.Switch != "c2960g" || device.Device.Model != "WS-C2960G-24TC-L" || device.Device.Serial != "FOC1234X5YZ" {
+		t.Errorf("device %+v", device)
+	}
+	var samples map[string][]InterfaceSample
+	if err := json.Unmarshal([]byte(lines[1]), &samples); err != nil {
+		t.Fatal(err)
+	}
+	s := samples["c2960g"]
+	if len(s) != 1 {
+		t.Fatalf("samples %+v", samples)
+	}
+	if s[0].IfName != "GigabitEthernet0/1" || s[0].IfHCInOctets != 345343003 || s[0].OutPkts != 123 || s[0].InBroadcastPkts != 1234 || s[0].IfHighSpeed != 1000 {
+		t.Errorf("sample %+v", s[0])
+	}
+}
+
+func TestCollectSSHHostKeys(t *testing.T) {
+	addr, _ := sshServer(t)
+	tests := []struct {
+		name     string
+		key      ssh.PublicKey
+		insecure bool
+		want     int
+	}{
+		{name: "no known_hosts", want: 0},
+		{name: "no known_hosts, insecure", insecure: true, want: 2},
+		{name: "wrong host key", key: otherKey(t), want: 0},
+	}
+	for _, tt := range tests {
+		host := useSSHServer(t, addr, tt.key)
+		sshSettings.Insecure = tt.insecure
+		lines := captureUpstream(t, func() { collectSSH(host, "admin:cisco") })
+		if len(lines) != tt.want {
+			t.Errorf("%s: sent %d lines, want %d", tt.name, len(lines), tt.want)
+		}
+	}
+}
+
+func TestCollectSSHBadPassword(t *testing.T) {
+	addr, key := sshServer(t)
+	host := useSSHServer(t, addr, key)
+	lines := captureUpstream(t, func() { collectSSH(host, "admin:wrong") })
+	if len(lines) != 0 {
+		t.Errorf("sent %q", lines)
+	}
+}
+
+func otherKey(t *testing.T) ssh.PublicKey {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	k, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return k
+}
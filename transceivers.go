@@ -0,0 +1,262 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vallard/stickypipe-agent/nxapi"
+)
+
+// DOMReading is one optical monitoring value with the vendor thresholds
+// programmed into the optic, when it has them.
+type DOMReading struct {
+	Value      float64        `json:"value"`
+	Thresholds *DOMThresholds `json:"thresholds,omitempty"`
+}
+
+type DOMThresholds struct {
+	HighAlarm   float64 `json:"highAlarm"`
+	HighWarning float64 `json:"highWarning"`
+	LowWarning  float64 `json:"lowWarning"`
+	LowAlarm    float64 `json:"lowAlarm"`
+}
+
+// TransceiverSample is the DOM of one optic, or one lane of it.
+// Temperature is in C, voltage in V, bias current in mA and power in dBm.
+type TransceiverSample struct {
+	IfName      string      `json:"ifName"`
+	IfId        string      `json:"ifId,omitempty"`
+	Lane        int         `json:"lane,omitempty"`
+	Type        string      `json:"type,omitempty"`
+	Vendor      string      `json:"vendor,omitempty"`
+	PartNumber  string      `json:"partNumber,omitempty"`
+	Serial      string      `json:"serial,omitempty"`
+	Temperature *DOMReading `json:"temperature,omitempty"`
+	Voltage     *DOMReading `json:"voltage,omitempty"`
+	BiasCurrent *DOMReading `json:"biasCurrent,omitempty"`
+	TxPower     *DOMReading `json:"txPower,omitempty"`
+	RxPower     *DOMReading `json:"rxPower,omitempty"`
+}
+
+// TransceiverReport is the optics of one switch.  Falling RX power shows
+// up here long before errors do.
+type TransceiverReport struct {
+	Switch       string              `json:"switch"`
+	TimeStamp    int64               `json:"timeStamp"`
+	Transceivers []TransceiverSample `json:"transceivers"`
+}
+
+// turn show interface transceiver details into samples.  The interface
+// names are the same as show interface has.
+func nxapiTransceivers(ts []nxapi.Transceiver) []TransceiverSample {
+	samples := []TransceiverSample{}
+	for _, t := range ts {
+		if t.Sfp != "present" {
+			continue
+		}
+		for _, l := range t.Lane {
+			s := TransceiverSample{
+				IfName:      t.Interface,
+				Lane:        l.Lane_Number,
+				Type:        t.Type,
+				Vendor:      t.Name,
+				PartNumber:  t.Partnum,
+				Serial:      t.Serialnum,
+				Temperature: domReading(l.Temperature, l.Temp_Alrm_Hi, l.Temp_Warn_Hi, l.Temp_Warn_Lo, l.Temp_Alrm_Lo),
+				Voltage:     domReading(l.Voltage, l.Volt_Alrm_Hi, l.Volt_Warn_Hi, l.Volt_Warn_Lo, l.Volt_Alrm_Lo),
+				BiasCurrent: domReading(l.Current, l.Current_Alrm_Hi, l.Current_Warn_Hi, l.Current_Warn_Lo, l.Current_Alrm_Lo),
+				TxPower:     domReading(l.Tx_Pwr, l.Tx_Pwr_Alrm_Hi, l.Tx_Pwr_Warn_Hi, l.Tx_Pwr_Warn_Lo, l.Tx_Pwr_Alrm_Lo),
+				RxPower:     domReading(l.Rx_Pwr, l.Rx_Pwr_Alrm_Hi, l.Rx_Pwr_Warn_Hi, l.Rx_Pwr_Warn_Lo, l.Rx_Pwr_Alrm_Lo),
+			}
+			if s.Temperature == nil && s.Voltage == nil && s.BiasCurrent == nil && s.TxPower == nil && s.RxPower == nil {
+				continue
+			}
+			samples = append(samples, s)
+		}
+	}
+	return samples
+}
+
+// domReading reads a value and its thresholds.  It is nil if the optic
+// doesn't report the value (N/A).
+func domReading(value string, highAlarm string, highWarning string, lowWarning string, lowAlarm string) *DOMReading {
+	v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil {
+		return nil
+	}
+	r := &DOMReading{Value: v}
+	if highAlarm != "" && highAlarm != "N/A" {
+		r.Thresholds = &DOMThresholds{
+			HighAlarm:   parseFloat(highAlarm),
+			HighWarning: parseFloat(highWarning),
+			LowWarning:  parseFloat(lowWarning),
+			LowAlarm:    parseFloat(lowAlarm),
+		}
+	}
+	return r
+}
+
+// CISCO-ENTITY-SENSOR-MIB entSensorValueTable and entSensorThresholdTable.
+var ciscoSensorWork = map[string]string{
+	".1.3.6.1.4.1.9.9.91.1.1.1.1.1": "type",
+	".1.3.6.1.4.1.9.9.91.1.1.1.1.2": "scale",
+	".1.3.6.1.4.1.9.9.91.1.1.1.1.3": "precision",
+	".1.3.6.1.4.1.9.9.91.1.1.1.1.4": "value",
+}
+
+var ciscoSensorThresholdWork = map[string]string{
+	".1.3.6.1.4.1.9.9.91.1.2.1.1.2": "severity",
+	".1.3.6.1.4.1.9.9.91.1.2.1.1.3": "relation",
+	".1.3.6.1.4.1.9.9.91.1.2.1.1.4": "value",
+}
+
+// what we need from ENTITY-MIB to find the port a sensor is in.
+var entityTreeWork = map[string]string{
+	".1.3.6.1.2.1.47.1.1.1.1.4": "containedIn",
+	".1.3.6.1.2.1.47.1.1.1.1.7": "name",
+}
+
+// entAliasMappingIdentifier points entities at their ifIndex.
+const entAliasMappingIdentifier = ".1.3.6.1.2.1.47.1.3.2.1.2"
+
+var sensorLane = regexp.MustCompile(`(?i)\blane\s*(\d+)`)
+
+/*
+	Walk CISCO-ENTITY-SENSOR-MIB on a switch and send up the DOM of its
+	optics.
+
+Arguments:
+
+	server - the switch
+	creds - the SNMP community string
+	sw - the switch name from sysName
+
+Sensors are tied to their interface by going up entPhysicalContainedIn
+until we find an entity with an ifIndex in entAliasMappingTable.  Sensors
+that aren't in a port, like the chassis temperatures, are skipped.
+*/
+func collectSNMPTransceivers(server string, creds string, sw string) {
+	sensors := map[string]map[string]string{}
+	thresholds := map[string]map[string]string{}
+	entities := map[string]map[string]string{}
+	aliases := map[string]map[string]string{}
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		walkColumns(server, creds, ciscoSensorWork, sensors)
+		if len(sensors) > 0 {
+			walkColumns(server, creds, ciscoSensorThresholdWork, thresholds)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		walkColumns(server, creds, entityTreeWork, entities)
+		walkTable(server, creds, entAliasMappingIdentifier, "ifIndex", aliases)
+	}()
+	wg.Wait()
+	if len(sensors) == 0 {
+		return
+	}
+
+	// ifIndex by entPhysicalIndex, the logical index doesn't matter.
+	ifIndexes := map[string]string{}
+	for row, v := range aliases {
+		bits := strings.Split(v["ifIndex"], ".")
+		ifIndexes[strings.Split(row, ".")[0]] = bits[len(bits)-1]
+	}
+	// thresholds by sensor.
+	sensorThresholds := map[string]*DOMThresholds{}
+	for row, v := range thresholds {
+		index := strings.Split(row, ".")[0]
+		s, ok := sensors[index]
+		if !ok {
+			continue
+		}
+		t := sensorThresholds[index]
+		if t == nil {
+			t = &DOMThresholds{}
+			sensorThresholds[index] = t
+		}
+		value := sensorValue(v["value"], s["scale"], s["precision"])
+		if s["type"] == "5" {
+			value *= 1000
+		}
+		// minor is a warning, major and critical an alarm.  relation 3 and
+		// 4 are greater than, 1 and 2 less than.
+		warning := v["severity"] == "10"
+		high := v["relation"] == "3" || v["relation"] == "4"
+		low := v["relation"] == "1" || v["relation"] == "2"
+		switch {
+		case high && warning:
+			t.HighWarning = value
+		case high:
+			t.HighAlarm = value
+		case low && warning:
+			t.LowWarning = value
+		case low:
+			t.LowAlarm = value
+		}
+	}
+
+	// one sample per interface and lane.
+	type optic struct {
+		ifIndex string
+		lane    int
+	}
+	samples := map[optic]*TransceiverSample{}
+	for index, s := range sensors {
+		ifIndex := ""
+		// don't loop forever if the switch has a loop in its tree.
+		for e, hops := index, 0; e != "" && e != "0" && hops < 10; e, hops = entities[e]["containedIn"], hops+1 {
+			if i, ok := ifIndexes[e]; ok {
+				ifIndex = i
+				break
+			}
+		}
+		if ifIndex == "" {
+			continue
+		}
+		name := entities[index]["name"]
+		lane := 0
+		if m := sensorLane.FindStringSubmatch(name); m != nil {
+			lane, _ = strconv.Atoi(m[1])
+		}
+		k := optic{ifIndex, lane}
+		sample := samples[k]
+		if sample == nil {
+			_, ifName := lookupInterface(server, ifIndex)
+			sample = &TransceiverSample{IfName: ifName, IfId: ifIndex, Lane: lane}
+			samples[k] = sample
+		}
+		r := &DOMReading{Value: sensorValue(s["value"], s["scale"], s["precision"]), Thresholds: sensorThresholds[index]}
+		lower := strings.ToLower(name)
+		switch s["type"] {
+		case "8":
+			sample.Temperature = r
+		case "4":
+			sample.Voltage = r
+		case "5":
+			// amperes, optics are read in mA.
+			r.Value *= 1000
+			sample.BiasCurrent = r
+		case "14":
+			if strings.Contains(lower, "receive") || strings.Contains(lower, " rx ") {
+				sample.RxPower = r
+			} else {
+				sample.TxPower = r
+			}
+		}
+	}
+	if len(samples) == 0 {
+		return
+	}
+	report := TransceiverReport{Switch: sw, TimeStamp: time.Now().Unix()}
+	for _, sample := range samples {
+		report.Transceivers = append(report.Transceivers, *sample)
+	}
+	sendUpstream(report)
+}
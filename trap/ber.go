@@ -0,0 +1,241 @@
+package trap
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/vallard/gosnmp"
+)
+
+// The BER tags that show up in trap and inform messages besides the gosnmp
+// value types.
+const (
+	tagSequence     = 0x30
+	tagV1Trap       = 0xa4
+	tagResponse     = 0xa2
+	tagInform       = 0xa6
+	tagV2Trap       = 0xa7
+	tagReport       = 0xa8
+	tagOctetString  = 0x04
+	tagInteger      = 0x02
+	tagObjectIdent  = 0x06
+	maxLengthOctets = 4
+)
+
+var errTruncated = errors.New("truncated BER")
+
+// tlv is one BER tag-length-value.
+type tlv struct {
+	tag   byte
+	value []byte
+}
+
+// next reads one TLV off the front of b and returns it and what's left.
+func next(b []byte) (tlv, []byte, error) {
+	if len(b) < 2 {
+		return tlv{}, nil, errTruncated
+	}
+	tag := b[0]
+	length := int(b[1])
+	header := 2
+	if length&0x80 != 0 {
+		n := length & 0x7f
+		if n == 0 || n > maxLengthOctets || len(b) < 2+n {
+			return tlv{}, nil, errTruncated
+		}
+		length = 0
+		for _, c := range b[2 : 2+n] {
+			length = length<<8 | int(c)
+		}
+		header += n
+	}
+	if length < 0 || len(b) < header+length {
+		return tlv{}, nil, errTruncated
+	}
+	return tlv{tag, b[header : header+length]}, b[header+length:], nil
+}
+
+// expect reads a TLV that has to have the given tag.
+func expect(b []byte, tag byte) (tlv, []byte, error) {
+	t, rest, err := next(b)
+	if err == nil && t.tag != tag {
+		err = fmt.Errorf("expected tag %#x, got %#x", tag, t.tag)
+	}
+	return t, rest, err
+}
+
+func readInt(b []byte) (int64, []byte, error) {
+	t, rest, err := expect(b, tagInteger)
+	if err != nil {
+		return 0, nil, err
+	}
+	return parseInt(t.value), rest, nil
+}
+
+func readString(b []byte) ([]byte, []byte, error) {
+	t, rest, err := expect(b, tagOctetString)
+	return t.value, rest, err
+}
+
+// offset is where value starts in b, given that rest, what was left after
+// reading value, runs to the end of b.
+func offset(b []byte, value []byte, rest []byte) int {
+	return len(b) - len(rest) - len(value)
+}
+
+// parseInt reads a two's complement integer.
+func parseInt(b []byte) int64 {
+	var n int64
+	for i, c := range b {
+		if i == 0 && c&0x80 != 0 {
+			n = -1
+		}
+		n = n<<8 | int64(c)
+	}
+	return n
+}
+
+func parseUint(b []byte) uint64 {
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n
+}
+
+// parseOID turns the BER encoding into .1.3.6.1... the way gosnmp names
+// things.
+func parseOID(b []byte) string {
+	if len(b) == 0 {
+		return ""
+	}
+	parts := []string{}
+	var n uint64
+	for _, c := range b {
+		n = n<<7 | uint64(c&0x7f)
+		if c&0x80 != 0 {
+			continue
+		}
+		if len(parts) == 0 {
+			// the first number holds the first two arcs.
+			first := n / 40
+			if first > 2 {
+				first = 2
+			}
+			parts = append(parts, strconv.FormatUint(first, 10), strconv.FormatUint(n-first*40, 10))
+		} else {
+			parts = append(parts, strconv.FormatUint(n, 10))
+		}
+		n = 0
+	}
+	return "." + strings.Join(parts, ".")
+}
+
+// parseVarbinds reads a SEQUENCE OF VarBind into the same PDUs gosnmp gives
+// back from a walk so they can be decoded the same way.
+func parseVarbinds(b []byte) ([]gosnmp.SnmpPDU, error) {
+	list, _, err := expect(b, tagSequence)
+	if err != nil {
+		return nil, err
+	}
+	pdus := []gosnmp.SnmpPDU{}
+	for rest := list.value; len(rest) > 0; {
+		var vb tlv
+		vb, rest, err = expect(rest, tagSequence)
+		if err != nil {
+			return pdus, err
+		}
+		name, inner, err := expect(vb.value, tagObjectIdent)
+		if err != nil {
+			return pdus, err
+		}
+		v, _, err := next(inner)
+		if err != nil {
+			return pdus, err
+		}
+		pdus = append(pdus, gosnmp.SnmpPDU{Name: parseOID(name.value), Type: gosnmp.Asn1BER(v.tag), Value: parseValue(v)})
+	}
+	return pdus, nil
+}
+
+// parseValue gives values the same Go types gosnmp uses.
+func parseValue(v tlv) interface{} {
+	switch gosnmp.Asn1BER(v.tag) {
+	case gosnmp.Integer:
+		return int(parseInt(v.value))
+	case gosnmp.Counter32, gosnmp.Gauge32, gosnmp.TimeTicks, gosnmp.Uinteger32:
+		return int(parseUint(v.value))
+	case gosnmp.Counter64:
+		return int64(parseUint(v.value))
+	case gosnmp.OctetString, gosnmp.Opaque:
+		return string(v.value)
+	case gosnmp.ObjectIdentifier:
+		return parseOID(v.value)
+	case gosnmp.IpAddress:
+		if len(v.value) == 4 {
+			return net.IP(v.value).String()
+		}
+		return ""
+	}
+	return nil
+}
+
+// encode wraps contents in a tag and length.
+func encode(tag byte, contents ...[]byte) []byte {
+	n := 0
+	for _, c := range contents {
+		n += len(c)
+	}
+	b := []byte{tag}
+	switch {
+	case n < 0x80:
+		b = append(b, byte(n))
+	case n < 0x100:
+		b = append(b, 0x81, byte(n))
+	case n < 0x10000:
+		b = append(b, 0x82, byte(n>>8), byte(n))
+	default:
+		b = append(b, 0x83, byte(n>>16), byte(n>>8), byte(n))
+	}
+	for _, c := range contents {
+		b = append(b, c...)
+	}
+	return b
+}
+
+func encodeInt(n int64) []byte {
+	b := []byte{byte(n)}
+	for n >= 0x80 || n < -0x80 {
+		n >>= 8
+		b = append([]byte{byte(n)}, b...)
+	}
+	return encode(tagInteger, b)
+}
+
+func encodeString(s []byte) []byte {
+	return encode(tagOctetString, s)
+}
+
+func encodeOID(oid string) []byte {
+	arcs := []uint64{}
+	for _, s := range strings.Split(strings.TrimPrefix(oid, "."), ".") {
+		n, _ := strconv.ParseUint(s, 10, 64)
+		arcs = append(arcs, n)
+	}
+	if len(arcs) < 2 {
+		return encode(tagObjectIdent)
+	}
+	arcs = append([]uint64{arcs[0]*40 + arcs[1]}, arcs[2:]...)
+	b := []byte{}
+	for _, n := range arcs {
+		chunk := []byte{byte(n & 0x7f)}
+		for n >>= 7; n > 0; n >>= 7 {
+			chunk = append([]byte{byte(n&0x7f) | 0x80}, chunk...)
+		}
+		b = append(b, chunk...)
+	}
+	return encode(tagObjectIdent, b)
+}
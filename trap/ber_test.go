@@ -0,0 +1,140 @@
+package trap
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/vallard/gosnmp"
+)
+
+// linkDown is a v2c trap from community public, request ID 0x12345678,
+// with sysUpTime, snmpTrapOID, ifIndex, ifDescr, ifHCInOctets and an
+// enterprise IpAddress.
+const linkDown = "30819d02010104067075626c6963a7818f020412345678020100020100308180" +
+	"300f06082b06010201010300430301e2403017060a2b06010603010104010006" +
+	"092b0601060301010503300f060a2b0601020102020101050201053019060a2b" +
+	"060102010202010205040b45746865726e6574312f353014060b2b060102011f" +
+	"0101010605460501000000003012060a2b06010401090987670140040a010203"
+
+var linkDownVarbinds = []gosnmp.SnmpPDU{
+	{Name: ".1.3.6.1.2.1.1.3.0", Type: gosnmp.TimeTicks, Value: 123456},
+	{Name: ".1.3.6.1.6.3.1.1.4.1.0", Type: gosnmp.ObjectIdentifier, Value: ".1.3.6.1.6.3.1.1.5.3"},
+	{Name: ".1.3.6.1.2.1.2.2.1.1.5", Type: gosnmp.Integer, Value: 5},
+	{Name: ".1.3.6.1.2.1.2.2.1.2.5", Type: gosnmp.OctetString, Value: "Ethernet1/5"},
+	{Name: ".1.3.6.1.2.1.31.1.1.1.6.5", Type: gosnmp.Counter64, Value: int64(1 << 32)},
+	{Name: ".1.3.6.1.4.1.9.9.999.1", Type: gosnmp.IpAddress, Value: "10.1.2.3"},
+}
+
+func TestParseVarbinds(t *testing.T) {
+	b := unhex(t, linkDown)
+	msg, _, err := expect(b, tagSequence)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, rest, _ := readInt(msg.value)
+	_, rest, _ = readString(rest)
+	pdu, _, err := expect(rest, tagV2Trap)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, rest, _ = readInt(pdu.value)
+	_, rest, _ = readInt(rest)
+	_, rest, _ = readInt(rest)
+	got, err := parseVarbinds(rest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, linkDownVarbinds) {
+		t.Errorf("got  %+v\nwant %+v", got, linkDownVarbinds)
+	}
+}
+
+func TestNextTruncated(t *testing.T) {
+	b := unhex(t, linkDown)
+	for i := 0; i < len(b); i++ {
+		if _, _, err := next(b[:i]); err == nil {
+			t.Errorf("%d bytes read", i)
+		}
+	}
+	for _, b := range [][]byte{
+		{0x04, 0x80},
+		{0x04, 0x85, 1, 1, 1, 1, 1},
+		{0x04, 0x82, 0x01},
+		{0x04, 0x84, 0xff, 0xff, 0xff, 0xff},
+	} {
+		if _, _, err := next(b); err == nil {
+			t.Errorf("% x read", b)
+		}
+	}
+}
+
+func TestLongLengths(t *testing.T) {
+	for _, n := range []int{0, 0x7f, 0x80, 0xff, 0x100, 0xffff, 0x10000} {
+		value := bytes.Repeat([]byte{'x'}, n)
+		v, rest, err := next(append(encodeString(value), 0x05, 0x00))
+		if err != nil {
+			t.Errorf("%d: %v", n, err)
+			continue
+		}
+		if v.tag != tagOctetString || len(v.value) != n || !bytes.Equal(rest, []byte{0x05, 0x00}) {
+			t.Errorf("%d: got tag %#x, %d bytes, rest % x", n, v.tag, len(v.value), rest)
+		}
+	}
+}
+
+func TestInts(t *testing.T) {
+	tests := []struct {
+		n   int64
+		ber string
+	}{
+		{0, "020100"},
+		{127, "02017f"},
+		{128, "02020080"},
+		{256, "02020100"},
+		{-1, "0201ff"},
+		{-128, "020180"},
+		{-129, "0202ff7f"},
+		{2147483647, "02047fffffff"},
+	}
+	for _, tt := range tests {
+		b := encodeInt(tt.n)
+		if !bytes.Equal(b, unhex(t, tt.ber)) {
+			t.Errorf("%d encoded as % x", tt.n, b)
+		}
+		if n, _, err := readInt(b); err != nil || n != tt.n {
+			t.Errorf("%s read as %d %v", tt.ber, n, err)
+		}
+	}
+}
+
+func TestOIDs(t *testing.T) {
+	tests := []struct {
+		oid string
+		ber string
+	}{
+		{".1.3.6.1.2.1.1.3.0", "06082b06010201010300"},
+		{".1.3.6.1.4.1.9.9.999.1", "060a2b0601040109098767" + "01"},
+		{".2.999.3", "0603883703"},
+	}
+	for _, tt := range tests {
+		b := encodeOID(tt.oid)
+		if !bytes.Equal(b, unhex(t, tt.ber)) {
+			t.Errorf("%s encoded as % x", tt.oid, b)
+		}
+		if got := parseOID(b[2:]); got != tt.oid {
+			t.Errorf("%s read as %s", tt.ber, got)
+		}
+	}
+}
+
+func TestOffset(t *testing.T) {
+	b := []byte{0x30, 0x06, 0x04, 0x01, 'a', 0x04, 0x01, 'b', 0xff}
+	seq, after, _ := next(b)
+	_, rest, _ := next(seq.value)
+	v, tail, _ := next(rest)
+	at := offset(b, seq.value, after) + offset(seq.value, v.value, tail)
+	if b[at] != 'b' {
+		t.Errorf("offset %d", at)
+	}
+}
@@ -0,0 +1,527 @@
+/*
+Package trap decodes SNMPv2c and SNMPv3 traps and informs and builds the
+responses informs need.  Varbinds come back as gosnmp PDUs so they can be
+decoded the same way as the results of a walk.
+
+A v2c trap is accepted on its community.  An SNMPv3 one on its user, its
+authentication and, if authenticated, being in the RFC 3414 time window.
+*/
+package trap
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/vallard/gosnmp"
+)
+
+// Versions as they appear in the message.
+const (
+	Version2c = 1
+	Version3  = 3
+)
+
+// Packet is a trap or inform that came in.
+type Packet struct {
+	Version   int
+	Community string
+	User      string
+	Inform    bool
+	RequestID int64
+	Varbinds  []gosnmp.SnmpPDU
+
+	varbinds []byte
+}
+
+// v3Message is what we need from an SNMPv3 message to answer it.
+type v3Message struct {
+	msgID           int64
+	flags           byte
+	engineID        []byte
+	boots           int64
+	time            int64
+	user            []byte
+	authParams      []byte
+	privParams      []byte
+	contextEngineID []byte
+	contextName     []byte
+	// where authParams is in the whole message, to zero it to check the
+	// HMAC and to fill it in when signing.
+	authAt int
+}
+
+const (
+	flagAuth       = 0x01
+	flagPriv       = 0x02
+	flagReportable = 0x04
+	securityUSM    = 3
+)
+
+// Reported back to a sender that is trying to find out our engine ID before
+// sending an inform, and to one whose idea of our engine time is out.
+const (
+	usmStatsUnknownEngineIDs = ".1.3.6.1.6.3.15.1.1.4.0"
+	usmStatsNotInTimeWindows = ".1.3.6.1.6.3.15.1.1.2.0"
+)
+
+// RFC 3414 2.2.3, an authenticated message must be within 150 seconds of the
+// authoritative engine's clock, and an engine whose boots has reached the
+// maximum has to be reconfigured.
+const (
+	timeWindow = 150
+	maxBoots   = 2147483647
+)
+
+// We don't keep snmpEngineBoots on disk so ours is the seconds from this to
+// when we started.  It only goes up across restarts, which is all senders
+// need of it, until 2088.
+var bootsEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Receiver checks and decodes messages.  Communities and Users are who we
+// accept traps from.  Without any communities no v2c traps are accepted.
+type Receiver struct {
+	Communities []string
+	Users       map[string]User
+	EngineID    []byte
+
+	start     time.Time
+	boots     int64
+	keys      *keyCache
+	mutex     sync.Mutex
+	engines   map[string]engineTime
+	discovery int
+	notInTime int
+}
+
+// engineTime is what we know of the clock of an engine that sends us
+// traps, RFC 3414 2.3: its boots and time at the moment we learned them.
+type engineTime struct {
+	boots int64
+	time  int64
+	at    time.Time
+}
+
+// NewReceiver makes a receiver.  The engine ID is what we tell SNMPv3
+// senders when they send us informs.
+func NewReceiver(engineID []byte, communities []string, users []User) *Receiver {
+	r := &Receiver{
+		Communities: communities,
+		Users:       map[string]User{},
+		EngineID:    engineID,
+		start:       time.Now(),
+		keys:        newKeyCache(keyCacheSize),
+		engines:     map[string]engineTime{},
+	}
+	r.boots = int64(r.start.Sub(bootsEpoch).Seconds())
+	for _, u := range users {
+		r.Users[u.Name] = u
+	}
+	return r
+}
+
+// Parse decodes a message.  The reply, if there is one, should be sent back
+// to where the message came from: the response to an inform, or a report
+// telling an SNMPv3 sender our engine ID.  Discovery messages come back as
+// a nil Packet.
+func (r *Receiver) Parse(b []byte) (*Packet, []byte, error) {
+	msg, _, err := expect(b, tagSequence)
+	if err != nil {
+		return nil, nil, err
+	}
+	version, rest, err := readInt(msg.value)
+	if err != nil {
+		return nil, nil, err
+	}
+	switch version {
+	case Version2c:
+		return r.parseV2c(rest)
+	case Version3:
+		return r.parseV3(b)
+	}
+	return nil, nil, fmt.Errorf("unsupported SNMP version %d", version)
+}
+
+func (r *Receiver) parseV2c(b []byte) (*Packet, []byte, error) {
+	community, rest, err := readString(b)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !r.communityOK(string(community)) {
+		return nil, nil, fmt.Errorf("unknown community %q", community)
+	}
+	p := &Packet{Version: Version2c, Community: string(community)}
+	if err := p.parsePDU(rest); err != nil {
+		return nil, nil, err
+	}
+	if !p.Inform {
+		return p, nil, nil
+	}
+	return p, encode(tagSequence, encodeInt(Version2c), encodeString(community), p.response()), nil
+}
+
+func (r *Receiver) communityOK(c string) bool {
+	for _, ok := range r.Communities {
+		if c == ok {
+			return true
+		}
+	}
+	return false
+}
+
+// parseV3 does the USM checks and decryption.  We need the whole message to
+// check the HMAC.
+func (r *Receiver) parseV3(whole []byte) (*Packet, []byte, error) {
+	m, scoped, err := parseV3Message(whole)
+	if err != nil {
+		return nil, nil, err
+	}
+	// a sender finding out our engine ID so it can send us informs.
+	if len(m.engineID) == 0 && m.flags&flagReportable != 0 {
+		r.mutex.Lock()
+		r.discovery++
+		count := r.discovery
+		r.mutex.Unlock()
+		return nil, r.report(m, scoped, usmStatsUnknownEngineIDs, count, nil), nil
+	}
+	u, ok := r.Users[string(m.user)]
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown SNMPv3 user %q", m.user)
+	}
+	if (m.flags&flagAuth != 0) != (u.AuthProto != "") || (m.flags&flagPriv != 0) != (u.PrivProto != "") {
+		return nil, nil, fmt.Errorf("SNMPv3 user %s: security level doesn't match", u.Name)
+	}
+	if m.flags&flagAuth != 0 {
+		if len(m.authParams) != authParamsLen {
+			return nil, nil, errors.New("bad authentication parameters")
+		}
+		// the HMAC is over the message with the auth parameters zeroed.
+		zeroed := append([]byte{}, whole...)
+		copy(zeroed[m.authAt:m.authAt+authParamsLen], make([]byte, authParamsLen))
+		key := r.key(u, false, m.engineID)
+		// an empty key would let anyone sign.
+		if len(key) == 0 {
+			return nil, nil, fmt.Errorf("SNMPv3 user %s: no auth password", u.Name)
+		}
+		if !hmac.Equal(sign(u.authHash(), key, zeroed), m.authParams) {
+			return nil, nil, fmt.Errorf("SNMPv3 user %s: authentication failed", u.Name)
+		}
+		if !r.timely(m, time.Now()) {
+			err := fmt.Errorf("SNMPv3 user %s: engine boots %d time %d not in the time window", u.Name, m.boots, m.time)
+			// tell an inform sender our time so it can try again.
+			if r.authoritative(m) && m.flags&flagReportable != 0 {
+				r.mutex.Lock()
+				r.notInTime++
+				count := r.notInTime
+				r.mutex.Unlock()
+				return nil, r.report(m, scoped, usmStatsNotInTimeWindows, count, &u), err
+			}
+			return nil, nil, err
+		}
+	}
+	if m.flags&flagPriv != 0 {
+		encrypted, _, err := readString(scoped)
+		if err != nil {
+			return nil, nil, err
+		}
+		key := r.key(u, true, m.engineID)
+		scoped, err = decrypt(u.PrivProto, key, m.boots, m.time, m.privParams, encrypted)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	p := &Packet{Version: Version3, User: u.Name}
+	pdu, err := m.parseScoped(scoped)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := p.parsePDU(pdu); err != nil {
+		return nil, nil, err
+	}
+	if !p.Inform {
+		return p, nil, nil
+	}
+	reply, err := r.v3Reply(u, m, p.response())
+	return p, reply, err
+}
+
+// parseV3Message reads an SNMPv3 message up to the scoped PDU, which it
+// returns, maybe encrypted.
+func parseV3Message(msg []byte) (*v3Message, []byte, error) {
+	seq, after, err := expect(msg, tagSequence)
+	if err != nil {
+		return nil, nil, err
+	}
+	version, rest, err := readInt(seq.value)
+	if err != nil {
+		return nil, nil, err
+	}
+	if version != Version3 {
+		return nil, nil, fmt.Errorf("not SNMPv3: version %d", version)
+	}
+	m, scoped, err := parseV3Header(rest)
+	if err != nil {
+		return nil, nil, err
+	}
+	m.authAt += offset(msg, seq.value, after) + offset(seq.value, rest, nil)
+	return m, scoped, nil
+}
+
+// parseV3Header reads msgGlobalData and the USM security parameters and
+// returns what is left, the scoped PDU, maybe encrypted.  m.authAt is where
+// the auth parameters are in b.
+func parseV3Header(b []byte) (*v3Message, []byte, error) {
+	m := &v3Message{}
+	global, rest, err := expect(b, tagSequence)
+	if err != nil {
+		return nil, nil, err
+	}
+	g := global.value
+	if m.msgID, g, err = readInt(g); err != nil {
+		return nil, nil, err
+	}
+	if _, g, err = readInt(g); err != nil {
+		return nil, nil, err
+	}
+	flags, g, err := readString(g)
+	if err != nil || len(flags) != 1 {
+		return nil, nil, errors.New("bad msgFlags")
+	}
+	m.flags = flags[0]
+	model, _, err := readInt(g)
+	if err != nil {
+		return nil, nil, err
+	}
+	if model != securityUSM {
+		return nil, nil, fmt.Errorf("unsupported security model %d", model)
+	}
+
+	params, rest, err := readString(rest)
+	if err != nil {
+		return nil, nil, err
+	}
+	usm, after, err := expect(params, tagSequence)
+	if err != nil {
+		return nil, nil, err
+	}
+	usmAt := offset(b, params, rest) + offset(params, usm.value, after)
+	u := usm.value
+	if m.engineID, u, err = readString(u); err != nil {
+		return nil, nil, err
+	}
+	if m.boots, u, err = readInt(u); err != nil {
+		return nil, nil, err
+	}
+	if m.time, u, err = readInt(u); err != nil {
+		return nil, nil, err
+	}
+	if m.user, u, err = readString(u); err != nil {
+		return nil, nil, err
+	}
+	if m.authParams, u, err = readString(u); err != nil {
+		return nil, nil, err
+	}
+	m.authAt = usmAt + offset(usm.value, m.authParams, u)
+	if m.privParams, _, err = readString(u); err != nil {
+		return nil, nil, err
+	}
+	return m, rest, nil
+}
+
+// parseScoped reads the context out of a plain scoped PDU and returns the
+// PDU.
+func (m *v3Message) parseScoped(b []byte) ([]byte, error) {
+	scoped, _, err := expect(b, tagSequence)
+	if err != nil {
+		return nil, err
+	}
+	s := scoped.value
+	if m.contextEngineID, s, err = readString(s); err != nil {
+		return nil, err
+	}
+	if m.contextName, s, err = readString(s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// parsePDU reads an SNMPv2-Trap or InformRequest PDU.
+func (p *Packet) parsePDU(b []byte) error {
+	pdu, _, err := next(b)
+	if err != nil {
+		return err
+	}
+	switch pdu.tag {
+	case tagV2Trap:
+	case tagInform:
+		p.Inform = true
+	case tagV1Trap:
+		return errors.New("SNMPv1 traps aren't supported")
+	default:
+		return fmt.Errorf("not a trap or inform: PDU type %#x", pdu.tag)
+	}
+	v := pdu.value
+	if p.RequestID, v, err = readInt(v); err != nil {
+		return err
+	}
+	// error-status and error-index are always 0.
+	if _, v, err = readInt(v); err != nil {
+		return err
+	}
+	if _, v, err = readInt(v); err != nil {
+		return err
+	}
+	p.varbinds = v
+	p.Varbinds, err = parseVarbinds(v)
+	return err
+}
+
+// response is the Response PDU for an inform, the same varbinds sent back.
+func (p *Packet) response() []byte {
+	return encode(tagResponse, encodeInt(p.RequestID), encodeInt(0), encodeInt(0), p.varbinds)
+}
+
+// report tells a sender our engine ID, boots and time, with a counter of
+// why.  It's authenticated as u if that is given.
+func (r *Receiver) report(m *v3Message, scoped []byte, oid string, count int, u *User) []byte {
+	p := &Packet{}
+	if pdu, err := m.parseScoped(scoped); err == nil {
+		// we only want the request ID, the probe has no varbinds.
+		if t, _, err := next(pdu); err == nil {
+			p.RequestID, _, _ = readInt(t.value)
+		}
+	}
+	vb := encode(tagSequence, encode(tagSequence, encodeOID(oid), encode(byte(gosnmp.Counter32), encodeInt(int64(count))[2:])))
+	pdu := encode(tagReport, encodeInt(p.RequestID), encodeInt(0), encodeInt(0), vb)
+	reply := &v3Message{
+		msgID:           m.msgID,
+		engineID:        r.EngineID,
+		contextEngineID: r.EngineID,
+	}
+	reply.boots, reply.time = r.engineTime(time.Now())
+	var signer func([]byte) []byte
+	if u != nil {
+		reply.flags = flagAuth
+		reply.user = m.user
+		key := r.key(*u, false, r.EngineID)
+		signer = func(msg []byte) []byte { return sign(u.authHash(), key, msg) }
+	}
+	return reply.encode(encode(tagSequence, encodeString(reply.contextEngineID), encodeString(nil), pdu), signer)
+}
+
+// v3Reply wraps a response PDU the way the inform was sent, authenticated
+// and encrypted with the same user.
+func (r *Receiver) v3Reply(u User, m *v3Message, pdu []byte) ([]byte, error) {
+	reply := *m
+	reply.flags = m.flags &^ flagReportable
+	reply.privParams = nil
+	if r.authoritative(m) {
+		reply.boots, reply.time = r.engineTime(time.Now())
+	}
+	scoped := encode(tagSequence, encodeString(m.contextEngineID), encodeString(m.contextName), pdu)
+	if m.flags&flagPriv != 0 {
+		key := r.key(u, true, m.engineID)
+		encrypted, salt, err := encrypt(u.PrivProto, key, reply.boots, reply.time, scoped)
+		if err != nil {
+			return nil, err
+		}
+		scoped = encodeString(encrypted)
+		reply.privParams = salt
+	}
+	var signer func([]byte) []byte
+	if m.flags&flagAuth != 0 {
+		key := r.key(u, false, m.engineID)
+		signer = func(msg []byte) []byte { return sign(u.authHash(), key, msg) }
+	}
+	return reply.encode(scoped, signer), nil
+}
+
+// authoritative says if we are the authoritative engine for m, which we are
+// for informs sent to us.  The sender is for traps.
+func (r *Receiver) authoritative(m *v3Message) bool {
+	return bytes.Equal(m.engineID, r.EngineID)
+}
+
+// engineTime is our snmpEngineBoots and snmpEngineTime.
+func (r *Receiver) engineTime(now time.Time) (int64, int64) {
+	return r.boots, int64(now.Sub(r.start).Seconds())
+}
+
+/*
+	Check an authenticated message is in the time window, RFC 3414 3.2 step 7.
+
+Arguments:
+
+	m - the message
+	now - when it came
+
+When we're authoritative the message has to have our boots and be within
+150 seconds of our time.  Otherwise we keep the latest boots and time each
+sender has sent us and the message mustn't be older than that.
+*/
+func (r *Receiver) timely(m *v3Message, now time.Time) bool {
+	if r.authoritative(m) {
+		boots, t := r.engineTime(now)
+		return boots < maxBoots && m.boots == boots && m.time >= t-timeWindow && m.time <= t+timeWindow
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	id := string(m.engineID)
+	e, ok := r.engines[id]
+	if !ok || m.boots > e.boots || (m.boots == e.boots && m.time > e.time) {
+		e = engineTime{boots: m.boots, time: m.time, at: now}
+		r.engines[id] = e
+	}
+	local := e.time + int64(now.Sub(e.at).Seconds())
+	return e.boots < maxBoots && m.boots == e.boots && m.time >= local-timeWindow
+}
+
+// encode builds the whole message around scoped.  If sign is given the
+// message is authenticated with it.
+func (m *v3Message) encode(scoped []byte, sign func([]byte) []byte) []byte {
+	var authParams []byte
+	if sign != nil {
+		authParams = make([]byte, authParamsLen)
+	}
+	usm := encode(tagSequence,
+		encodeString(m.engineID),
+		encodeInt(m.boots),
+		encodeInt(m.time),
+		encodeString(m.user),
+		encodeString(authParams),
+		encodeString(m.privParams))
+	msg := encode(tagSequence,
+		encodeInt(Version3),
+		encode(tagSequence, encodeInt(m.msgID), encodeInt(65507), encodeString([]byte{m.flags}), encodeInt(securityUSM)),
+		encodeString(usm),
+		scoped)
+	if sign == nil {
+		return msg
+	}
+	// find the zeroed auth parameters again and fill them in.
+	parsed, _, err := parseV3Message(msg)
+	if err != nil {
+		return msg
+	}
+	copy(msg[parsed.authAt:], sign(msg))
+	return msg
+}
+
+// key localizes u's auth or privacy password for an engine.  That takes a
+// million hash rounds so the keys are kept, but not too many of them as
+// anyone can send us any engine ID, and without holding the lock.
+func (r *Receiver) key(u User, priv bool, engineID []byte) []byte {
+	password, id := u.AuthPass, "auth\x00"+u.Name+"\x00"+string(engineID)
+	if priv {
+		password, id = u.PrivPass, "priv\x00"+u.Name+"\x00"+string(engineID)
+	}
+	if k, ok := r.keys.get(id); ok {
+		return k
+	}
+	k := localizeKey(u.authHash(), password, engineID)
+	r.keys.add(id, k)
+	return k
+}
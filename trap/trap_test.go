@@ -0,0 +1,303 @@
+package trap
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var (
+	senderID   = []byte{0x80, 0, 0, 0x09, 0x03, 0, 0, 0, 0, 0, 0, 1}
+	receiverID = []byte{0x80, 0, 0x1f, 0x88, 0x04, 's', 'p'}
+	shaAES     = User{"sha-aes", "SHA", "authpass1", "AES", "privpass1"}
+	md5DES     = User{"md5-des", "MD5", "authpass2", "DES", "privpass2"}
+	authOnly   = User{"sha", "SHA", "authpass3", "", ""}
+)
+
+func newTestReceiver(communities ...string) *Receiver {
+	return NewReceiver(receiverID, communities, []User{shaAES, md5DES, authOnly})
+}
+
+// v2c is the linkDown trap, as an inform if it should be, from community.
+func v2c(t *testing.T, community string, inform bool) []byte {
+	b := unhex(t, linkDown)
+	msg, _, _ := next(b)
+	_, rest, _ := readInt(msg.value)
+	_, rest, _ = readString(rest)
+	pdu, _, _ := next(rest)
+	tag := byte(tagV2Trap)
+	if inform {
+		tag = tagInform
+	}
+	return encode(tagSequence, encodeInt(Version2c), encodeString([]byte(community)), encode(tag, pdu.value))
+}
+
+// v3 is the linkDown trap, or an inform, as u would send it to engineID
+// with that boots and time, the way an agent does.
+func v3(t *testing.T, u User, engineID []byte, boots int64, now int64, inform bool) []byte {
+	pdu := v2c(t, "", inform)
+	msg, _, _ := next(pdu)
+	_, rest, _ := readInt(msg.value)
+	_, rest, _ = readString(rest)
+	m := &v3Message{
+		msgID:    42,
+		flags:    flagReportable,
+		engineID: engineID,
+		boots:    boots,
+		time:     now,
+		user:     []byte(u.Name),
+	}
+	scoped := encode(tagSequence, encodeString(engineID), encodeString(nil), rest)
+	if u.PrivProto != "" {
+		m.flags |= flagPriv
+		encrypted, salt, err := encrypt(u.PrivProto, localizeKey(u.authHash(), u.PrivPass, engineID), boots, now, scoped)
+		if err != nil {
+			t.Fatal(err)
+		}
+		scoped = encodeString(encrypted)
+		m.privParams = salt
+	}
+	var signer func([]byte) []byte
+	if u.AuthProto != "" {
+		m.flags |= flagAuth
+		key := localizeKey(u.authHash(), u.AuthPass, engineID)
+		signer = func(msg []byte) []byte { return sign(u.authHash(), key, msg) }
+	}
+	return m.encode(scoped, signer)
+}
+
+// checkSigned checks a message from the receiver is signed for u.
+func checkSigned(t *testing.T, u User, msg []byte) *v3Message {
+	m, _, err := parseV3Message(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zeroed := append([]byte{}, msg...)
+	copy(zeroed[m.authAt:m.authAt+authParamsLen], make([]byte, authParamsLen))
+	key := localizeKey(u.authHash(), u.AuthPass, m.engineID)
+	if !hmac.Equal(sign(u.authHash(), key, zeroed), m.authParams) {
+		t.Errorf("%s: reply not signed", u.Name)
+	}
+	return m
+}
+
+func TestV2c(t *testing.T) {
+	r := newTestReceiver("private", "public")
+	p, reply, err := r.Parse(v2c(t, "public", false))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &Packet{Version: Version2c, Community: "public", RequestID: 0x12345678, Varbinds: linkDownVarbinds, varbinds: p.varbinds}
+	if !reflect.DeepEqual(p, want) || reply != nil {
+		t.Errorf("got %+v, reply % x", p, reply)
+	}
+
+	if _, _, err := r.Parse(v2c(t, "secret", false)); err == nil {
+		t.Error("unknown community accepted")
+	}
+	if _, _, err := newTestReceiver().Parse(v2c(t, "public", false)); err == nil {
+		t.Error("accepted without any communities")
+	}
+
+	p, reply, err = r.Parse(v2c(t, "public", true))
+	if err != nil || !p.Inform {
+		t.Fatalf("inform: %+v %v", p, err)
+	}
+	msg, _, _ := next(reply)
+	version, rest, _ := readInt(msg.value)
+	community, rest, _ := readString(rest)
+	response, _, _ := next(rest)
+	id, _, _ := readInt(response.value)
+	if version != Version2c || string(community) != "public" || response.tag != tagResponse || id != 0x12345678 {
+		t.Errorf("reply % x", reply)
+	}
+}
+
+func TestV3(t *testing.T) {
+	r := newTestReceiver()
+	for _, u := range []User{shaAES, md5DES, authOnly} {
+		p, reply, err := r.Parse(v3(t, u, senderID, 5, 1000, false))
+		if err != nil {
+			t.Errorf("%s: %v", u.Name, err)
+			continue
+		}
+		if p.User != u.Name || p.Version != Version3 || p.RequestID != 0x12345678 || !reflect.DeepEqual(p.Varbinds, linkDownVarbinds) || reply != nil {
+			t.Errorf("%s: got %+v", u.Name, p)
+		}
+	}
+
+	bad := []struct {
+		name string
+		msg  []byte
+	}{
+		{"unknown user", v3(t, User{Name: "nobody", AuthProto: "SHA", AuthPass: "authpass1"}, senderID, 5, 1000, false)},
+		{"wrong password", v3(t, User{"sha", "SHA", "authpass4", "", ""}, senderID, 5, 1000, false)},
+		{"not authenticated", v3(t, User{Name: "sha"}, senderID, 5, 1000, false)},
+		{"not encrypted", v3(t, User{"sha-aes", "SHA", "authpass1", "", ""}, senderID, 5, 1000, false)},
+	}
+	for _, tt := range bad {
+		if _, _, err := r.Parse(tt.msg); err == nil {
+			t.Errorf("%s: accepted", tt.name)
+		}
+	}
+
+	// a user that didn't come through ParseUser with an empty password
+	// can't be signed as by anyone.
+	empty := User{"empty", "SHA", "", "", ""}
+	if _, _, err := NewReceiver(receiverID, nil, []User{empty}).Parse(v3(t, empty, senderID, 5, 1000, false)); err == nil {
+		t.Error("signed with an empty key and accepted")
+	}
+
+	msg := v3(t, shaAES, senderID, 5, 1000, false)
+	for i := range msg {
+		tampered := append([]byte{}, msg...)
+		tampered[i] ^= 0x01
+		if _, _, err := r.Parse(tampered); err == nil {
+			t.Errorf("byte %d changed and accepted", i)
+		}
+	}
+	for i := 0; i < len(msg); i++ {
+		r.Parse(msg[:i])
+	}
+}
+
+func TestTimeWindow(t *testing.T) {
+	r := newTestReceiver()
+	tests := []struct {
+		boots int64
+		time  int64
+		ok    bool
+	}{
+		{5, 1000, true},
+		{5, 900, true},
+		// replayed from before the window.
+		{5, 800, false},
+		{4, 5000, false},
+		// the sender rebooted.
+		{6, 0, true},
+		{5, 1000, false},
+		{6, 1000, true},
+	}
+	for _, tt := range tests {
+		_, _, err := r.Parse(v3(t, authOnly, senderID, tt.boots, tt.time, false))
+		if (err == nil) != tt.ok {
+			t.Errorf("boots %d time %d: %v", tt.boots, tt.time, err)
+		}
+	}
+
+	// what we learned of the sender's clock runs on with ours, so an older
+	// time that was fine then isn't now.
+	r.mutex.Lock()
+	e := r.engines[string(senderID)]
+	e.at = e.at.Add(-1000 * time.Second)
+	r.engines[string(senderID)] = e
+	r.mutex.Unlock()
+	if _, _, err := r.Parse(v3(t, authOnly, senderID, 6, 900, false)); err == nil {
+		t.Error("time 900 accepted 1000 seconds on")
+	}
+	if _, _, err := r.Parse(v3(t, authOnly, senderID, 6, 1900, false)); err != nil {
+		t.Errorf("time 1900 1000 seconds on: %v", err)
+	}
+	if _, _, err := r.Parse(v3(t, authOnly, []byte("other"), 1, 0, false)); err != nil {
+		t.Errorf("another engine: %v", err)
+	}
+	if _, _, err := r.Parse(v3(t, authOnly, senderID, maxBoots, 0, false)); err == nil {
+		t.Error("boots at the maximum accepted")
+	}
+}
+
+func TestInform(t *testing.T) {
+	r := newTestReceiver()
+	boots, now := r.engineTime(time.Now())
+	for _, u := range []User{shaAES, md5DES} {
+		p, reply, err := r.Parse(v3(t, u, receiverID, boots, now, true))
+		if err != nil {
+			t.Errorf("%s: %v", u.Name, err)
+			continue
+		}
+		if !p.Inform {
+			t.Errorf("%s: not an inform", u.Name)
+		}
+		m := checkSigned(t, u, reply)
+		_, scoped, _ := parseV3Message(reply)
+		encrypted, _, _ := readString(scoped)
+		plain, err := decrypt(u.PrivProto, localizeKey(u.authHash(), u.PrivPass, receiverID), m.boots, m.time, m.privParams, encrypted)
+		if err != nil {
+			t.Errorf("%s: %v", u.Name, err)
+			continue
+		}
+		pdu, err := m.parseScoped(plain)
+		if err != nil {
+			t.Errorf("%s: %v", u.Name, err)
+			continue
+		}
+		response, _, _ := next(pdu)
+		id, _, _ := readInt(response.value)
+		if response.tag != tagResponse || id != 0x12345678 || m.flags != flagAuth|flagPriv || !bytes.Equal(m.user, []byte(u.Name)) {
+			t.Errorf("%s: reply %+v", u.Name, m)
+		}
+	}
+
+	// the sender's idea of our time is out, so it's told ours.
+	p, reply, err := r.Parse(v3(t, shaAES, receiverID, boots, now+2*timeWindow, true))
+	if err == nil || p != nil || !strings.Contains(err.Error(), "time window") {
+		t.Fatalf("got %+v %v", p, err)
+	}
+	m := checkSigned(t, shaAES, reply)
+	if m.boots != boots || m.time < now || m.time > now+1 || m.flags != flagAuth {
+		t.Errorf("report %+v", m)
+	}
+	if _, _, err := r.Parse(v3(t, shaAES, receiverID, boots-1, now, true)); err == nil {
+		t.Error("old boots accepted")
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	r := newTestReceiver()
+	probe := (&v3Message{msgID: 7, flags: flagReportable}).encode(encode(tagSequence, encodeString(nil), encodeString(nil),
+		encode(0xa0, encodeInt(99), encodeInt(0), encodeInt(0), encode(tagSequence))), nil)
+	p, reply, err := r.Parse(probe)
+	if err != nil || p != nil {
+		t.Fatalf("got %+v %v", p, err)
+	}
+	m, scoped, err := parseV3Message(reply)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(m.engineID, receiverID) || m.msgID != 7 || m.flags != 0 {
+		t.Errorf("report %+v", m)
+	}
+	pdu, _ := m.parseScoped(scoped)
+	report, _, _ := next(pdu)
+	id, rest, _ := readInt(report.value)
+	_, rest, _ = readInt(rest)
+	_, rest, _ = readInt(rest)
+	vbs, _ := parseVarbinds(rest)
+	if report.tag != tagReport || id != 99 || len(vbs) != 1 || vbs[0].Name != usmStatsUnknownEngineIDs || vbs[0].Value != 1 {
+		t.Errorf("report %x %d %+v", report.tag, id, vbs)
+	}
+}
+
+func TestKeysKept(t *testing.T) {
+	r := newTestReceiver()
+	r.keys = newKeyCache(4)
+	// someone spraying engine IDs only ever has a few keys kept.
+	for i := 0; i < 10; i++ {
+		r.Parse(v3(t, authOnly, []byte{0x80, 0, 0, 0x09, byte(i)}, 5, 1000, false))
+	}
+	if len(r.keys.entries) != 4 {
+		t.Errorf("%d keys kept", len(r.keys.entries))
+	}
+	for id := range r.keys.entries {
+		if strings.Contains(id, authOnly.AuthPass) {
+			t.Errorf("password in %q", id)
+		}
+	}
+	// and a key is there for the latest.
+	if _, ok := r.keys.get("auth\x00sha\x00" + string([]byte{0x80, 0, 0, 0x09, 9})); !ok {
+		t.Error("latest key not kept")
+	}
+}
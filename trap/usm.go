@@ -0,0 +1,246 @@
+package trap
+
+import (
+	"container/list"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/des"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+	"sync"
+)
+
+// User is an SNMPv3 user we accept traps and informs from.  AuthProto is
+// MD5 or SHA, PrivProto is DES or AES (AES-128).  Leave them empty for
+// noAuthNoPriv or authNoPriv.
+type User struct {
+	Name      string
+	AuthProto string
+	AuthPass  string
+	PrivProto string
+	PrivPass  string
+}
+
+// RFC 3414 11.2, passwords shorter than this are too easy to guess.
+const minPasswordLen = 8
+
+// ParseUser reads a user that looks like name:SHA:authpass:AES:privpass.
+// Everything after the name is optional.
+func ParseUser(s string) (User, error) {
+	f := strings.Split(s, ":")
+	for len(f) < 5 {
+		f = append(f, "")
+	}
+	u := User{f[0], strings.ToUpper(f[1]), f[2], strings.ToUpper(f[3]), f[4]}
+	if u.Name == "" {
+		return u, errors.New("SNMPv3 user needs a name")
+	}
+	if u.AuthProto != "" && u.authHash() == nil {
+		return u, fmt.Errorf("unknown auth protocol %s", u.AuthProto)
+	}
+	if u.PrivProto != "" && u.PrivProto != "DES" && u.PrivProto != "AES" {
+		return u, fmt.Errorf("unknown privacy protocol %s", u.PrivProto)
+	}
+	if u.PrivProto != "" && u.AuthProto == "" {
+		return u, errors.New("SNMPv3 privacy needs authentication too")
+	}
+	if u.AuthProto != "" && len(u.AuthPass) < minPasswordLen {
+		return u, fmt.Errorf("SNMPv3 user %s: auth password must be at least %d characters", u.Name, minPasswordLen)
+	}
+	if u.PrivProto != "" && len(u.PrivPass) < minPasswordLen {
+		return u, fmt.Errorf("SNMPv3 user %s: privacy password must be at least %d characters", u.Name, minPasswordLen)
+	}
+	return u, nil
+}
+
+func (u User) authHash() func() hash.Hash {
+	switch u.AuthProto {
+	case "MD5":
+		return md5.New
+	case "SHA":
+		return sha1.New
+	}
+	return nil
+}
+
+// localizeKey turns a password into a key for one engine as in RFC 3414
+// appendix A.2.
+func localizeKey(h func() hash.Hash, password string, engineID []byte) []byte {
+	ku := h()
+	pw := []byte(password)
+	if len(pw) == 0 {
+		return nil
+	}
+	buf := make([]byte, 64)
+	for i := 0; i < 1048576; i += 64 {
+		for j := range buf {
+			buf[j] = pw[(i+j)%len(pw)]
+		}
+		ku.Write(buf)
+	}
+	key := ku.Sum(nil)
+	kul := h()
+	kul.Write(key)
+	kul.Write(engineID)
+	kul.Write(key)
+	return kul.Sum(nil)
+}
+
+// authParamsLen is how much of the HMAC goes in the message, 96 bits for
+// both HMAC-MD5-96 and HMAC-SHA-96.
+const authParamsLen = 12
+
+// sign computes the auth parameters for msg, which must have its auth
+// parameters zeroed.
+func sign(h func() hash.Hash, key []byte, msg []byte) []byte {
+	mac := hmac.New(h, key)
+	mac.Write(msg)
+	return mac.Sum(nil)[:authParamsLen]
+}
+
+// privKeyLen is how much localized key DES (key and pre-IV) and AES-128
+// take.  Both MD5 and SHA keys are long enough, a missing one isn't.
+const privKeyLen = 16
+
+var errPrivKey = errors.New("no privacy key")
+
+// decrypt decrypts a scoped PDU.  salt is msgPrivacyParameters.
+func decrypt(proto string, key []byte, boots int64, time int64, salt []byte, data []byte) ([]byte, error) {
+	if len(salt) != 8 {
+		return nil, errors.New("bad privacy parameters")
+	}
+	if len(key) < privKeyLen {
+		return nil, errPrivKey
+	}
+	out := make([]byte, len(data))
+	switch proto {
+	case "DES":
+		if len(data)%des.BlockSize != 0 {
+			return nil, errors.New("bad DES encrypted PDU")
+		}
+		block, err := des.NewCipher(key[:8])
+		if err != nil {
+			return nil, err
+		}
+		cipher.NewCBCDecrypter(block, desIV(key, salt)).CryptBlocks(out, data)
+	case "AES":
+		block, err := aes.NewCipher(key[:16])
+		if err != nil {
+			return nil, err
+		}
+		cipher.NewCFBDecrypter(block, aesIV(boots, time, salt)).XORKeyStream(out, data)
+	default:
+		return nil, fmt.Errorf("unknown privacy protocol %s", proto)
+	}
+	return out, nil
+}
+
+// encrypt encrypts a scoped PDU and returns it with the salt to send as
+// msgPrivacyParameters.
+func encrypt(proto string, key []byte, boots int64, time int64, data []byte) ([]byte, []byte, error) {
+	if len(key) < privKeyLen {
+		return nil, nil, errPrivKey
+	}
+	salt := make([]byte, 8)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, nil, err
+	}
+	switch proto {
+	case "DES":
+		block, err := des.NewCipher(key[:8])
+		if err != nil {
+			return nil, nil, err
+		}
+		// pad out to a whole block, the BER length tells the other end
+		// where the PDU stops.
+		if r := len(data) % des.BlockSize; r != 0 {
+			data = append(data, make([]byte, des.BlockSize-r)...)
+		}
+		out := make([]byte, len(data))
+		cipher.NewCBCEncrypter(block, desIV(key, salt)).CryptBlocks(out, data)
+		return out, salt, nil
+	case "AES":
+		block, err := aes.NewCipher(key[:16])
+		if err != nil {
+			return nil, nil, err
+		}
+		out := make([]byte, len(data))
+		cipher.NewCFBEncrypter(block, aesIV(boots, time, salt)).XORKeyStream(out, data)
+		return out, salt, nil
+	}
+	return nil, nil, fmt.Errorf("unknown privacy protocol %s", proto)
+}
+
+// RFC 3414 8.1.1.1, the pre-IV is the second half of the key.
+func desIV(key []byte, salt []byte) []byte {
+	iv := make([]byte, 8)
+	for i := range iv {
+		iv[i] = key[8+i] ^ salt[i]
+	}
+	return iv
+}
+
+// RFC 3826 3.1.2.1
+func aesIV(boots int64, time int64, salt []byte) []byte {
+	iv := make([]byte, 16)
+	binary.BigEndian.PutUint32(iv[0:], uint32(boots))
+	binary.BigEndian.PutUint32(iv[4:], uint32(time))
+	copy(iv[8:], salt)
+	return iv
+}
+
+// keyCacheSize is how many localized keys a receiver keeps, enough for a
+// few users on hundreds of switches.
+const keyCacheSize = 1024
+
+// keyCache keeps the most recently used localized keys.
+type keyCache struct {
+	mutex   sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type keyEntry struct {
+	id  string
+	key []byte
+}
+
+func newKeyCache(size int) *keyCache {
+	return &keyCache{size: size, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (c *keyCache) get(id string) ([]byte, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	e, ok := c.entries[id]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*keyEntry).key, true
+}
+
+// add keeps a key, dropping the least recently used one if there are too
+// many.
+func (c *keyCache) add(id string, key []byte) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if e, ok := c.entries[id]; ok {
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[id] = c.order.PushFront(&keyEntry{id, key})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*keyEntry).id)
+	}
+}
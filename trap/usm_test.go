@@ -0,0 +1,168 @@
+package trap
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/hex"
+	"testing"
+)
+
+func unhex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+// RFC 3414 A.3.1 and A.3.2.
+func TestLocalizeKey(t *testing.T) {
+	engineID := []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 2}
+	if got := hex.EncodeToString(localizeKey(md5.New, "maplesyrup", engineID)); got != "526f5eed9fcce26f8964c2930787d82b" {
+		t.Errorf("MD5 key %s", got)
+	}
+	if got := hex.EncodeToString(localizeKey(sha1.New, "maplesyrup", engineID)); got != "6695febc9288e36282235fc7151f128497b38f3f" {
+		t.Errorf("SHA key %s", got)
+	}
+	if localizeKey(md5.New, "", engineID) != nil {
+		t.Error("key from an empty password")
+	}
+}
+
+// RFC 2202 test case 1, cut to 96 bits as in RFC 3414 6.3.1 and 7.3.1.
+func TestSign(t *testing.T) {
+	msg := []byte("Hi There")
+	if got := hex.EncodeToString(sign(md5.New, bytes.Repeat([]byte{0x0b}, 16), msg)); got != "9294727a3638bb1c13f48ef8" {
+		t.Errorf("HMAC-MD5-96 %s", got)
+	}
+	if got := hex.EncodeToString(sign(sha1.New, bytes.Repeat([]byte{0x0b}, 20), msg)); got != "b617318655057264e28bc0b6" {
+		t.Errorf("HMAC-SHA-96 %s", got)
+	}
+}
+
+// The ciphertexts are from openssl with the IVs worked out by hand:
+//
+//	DES, RFC 3414 8.1.1.1: the key is the first 8 bytes of the localized
+//	MD5 key above, the IV its last 8 (8964c2930787d82b) XOR the salt
+//	0000000100000002, so 8964c2920787d829.
+//	openssl des-cbc -K 526f5eed9fcce26f -iv 8964c2920787d829 -nopad
+//
+//	AES, RFC 3826 3.1.2.1: the key is the first 16 bytes of the localized
+//	SHA key above, the IV boots 1, time 2 and the salt 0102030405060708.
+//	openssl aes-128-cfb -K 6695febc9288e36282235fc7151f1284 -iv 00000001000000020102030405060708
+func TestPrivacy(t *testing.T) {
+	tests := []struct {
+		proto      string
+		key        string
+		boots      int64
+		time       int64
+		salt       string
+		plain      string
+		ciphertext string
+	}{
+		{"DES", "526f5eed9fcce26f8964c2930787d82b", 0, 0, "0000000100000002", "the scoped PDU!!", "b9a3226847d673c061d3df692ada4c40"},
+		{"AES", "6695febc9288e36282235fc7151f128497b38f3f", 1, 2, "0102030405060708", "a scoped PDU, 20b...", "b2bfd6258971451aeba8bb4437731f1aa4637e41"},
+	}
+	for _, tt := range tests {
+		key := unhex(t, tt.key)
+		got, err := decrypt(tt.proto, key, tt.boots, tt.time, unhex(t, tt.salt), unhex(t, tt.ciphertext))
+		if err != nil {
+			t.Errorf("%s: %v", tt.proto, err)
+			continue
+		}
+		if string(got) != tt.plain {
+			t.Errorf("%s: decrypted to %q", tt.proto, got)
+		}
+
+		// encrypt picks its own salt so check it round trips.
+		encrypted, salt, err := encrypt(tt.proto, key, tt.boots, tt.time, []byte(tt.plain))
+		if err != nil {
+			t.Errorf("%s: %v", tt.proto, err)
+			continue
+		}
+		got, err = decrypt(tt.proto, key, tt.boots, tt.time, salt, encrypted)
+		if err != nil || string(got) != tt.plain {
+			t.Errorf("%s: round trip %q %v", tt.proto, got, err)
+		}
+	}
+}
+
+func TestDecryptBad(t *testing.T) {
+	key := make([]byte, 20)
+	if _, err := decrypt("DES", key, 0, 0, make([]byte, 8), make([]byte, 12)); err == nil {
+		t.Error("DES with a partial block")
+	}
+	if _, err := decrypt("AES", key, 0, 0, make([]byte, 4), make([]byte, 16)); err == nil {
+		t.Error("short salt")
+	}
+	if _, err := decrypt("3DES", key, 0, 0, make([]byte, 8), make([]byte, 16)); err == nil {
+		t.Error("unknown protocol")
+	}
+
+	// the key from an empty password is nil.
+	for _, proto := range []string{"DES", "AES"} {
+		for _, key := range [][]byte{nil, make([]byte, 8)} {
+			if _, err := decrypt(proto, key, 0, 0, make([]byte, 8), make([]byte, 16)); err == nil {
+				t.Errorf("%s decrypted with a %d byte key", proto, len(key))
+			}
+			if _, _, err := encrypt(proto, key, 0, 0, make([]byte, 16)); err == nil {
+				t.Errorf("%s encrypted with a %d byte key", proto, len(key))
+			}
+		}
+	}
+}
+
+func TestParseUser(t *testing.T) {
+	tests := []struct {
+		s    string
+		want User
+		err  bool
+	}{
+		{s: "traps", want: User{Name: "traps"}},
+		{s: "traps:sha:secret12", want: User{Name: "traps", AuthProto: "SHA", AuthPass: "secret12"}},
+		{s: "traps:MD5:secret12:aes:private1", want: User{"traps", "MD5", "secret12", "AES", "private1"}},
+		{s: ":SHA:secret12", err: true},
+		{s: "traps:SHA256:secret12", err: true},
+		{s: "traps:SHA:secret12:3DES:private1", err: true},
+		{s: "traps:::AES:private1", err: true},
+		// RFC 3414 passwords are at least 8 characters.
+		{s: "traps:SHA::AES:", err: true},
+		{s: "traps:SHA", err: true},
+		{s: "traps:SHA:secret1", err: true},
+		{s: "traps:SHA:secret12:AES:", err: true},
+		{s: "traps:SHA:secret12:DES:private", err: true},
+	}
+	for _, tt := range tests {
+		u, err := ParseUser(tt.s)
+		if (err != nil) != tt.err {
+			t.Errorf("%s: error %v", tt.s, err)
+			continue
+		}
+		if !tt.err && u != tt.want {
+			t.Errorf("%s: got %+v", tt.s, u)
+		}
+	}
+}
+
+func TestKeyCache(t *testing.T) {
+	c := newKeyCache(2)
+	c.add("a", []byte{1})
+	c.add("b", []byte{2})
+	if k, ok := c.get("a"); !ok || k[0] != 1 {
+		t.Fatal("a missing")
+	}
+	// b is the least recently used now.
+	c.add("c", []byte{3})
+	if _, ok := c.get("b"); ok {
+		t.Error("b kept")
+	}
+	for _, id := range []string{"a", "c"} {
+		if _, ok := c.get(id); !ok {
+			t.Errorf("%s dropped", id)
+		}
+	}
+	if len(c.entries) != 2 || c.order.Len() != 2 {
+		t.Errorf("%d entries", len(c.entries))
+	}
+}
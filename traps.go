@@ -0,0 +1,185 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/vallard/stickypipe-agent/trap"
+)
+
+// Our SNMPv3 engine ID when SP_TRAP_ENGINE_ID isn't set: the RFC 3411 text
+// format with the net-snmp enterprise number and "stickypipe".
+var defaultTrapEngineID = append([]byte{0x80, 0x00, 0x1f, 0x88, 0x04}, "stickypipe"...)
+
+// The standard traps from SNMPv2-MIB and IF-MIB by snmpTrapOID.
+var trapNames = map[string]string{
+	".1.3.6.1.6.3.1.1.5.1": "coldStart",
+	".1.3.6.1.6.3.1.1.5.2": "warmStart",
+	".1.3.6.1.6.3.1.1.5.3": "linkDown",
+	".1.3.6.1.6.3.1.1.5.4": "linkUp",
+	".1.3.6.1.6.3.1.1.5.5": "authenticationFailure",
+	".1.3.6.1.6.3.1.1.5.6": "egpNeighborLoss",
+}
+
+const (
+	snmpTrapOID = ".1.3.6.1.6.3.1.1.4.1.0"
+	sysUpTime   = ".1.3.6.1.2.1.1.3.0"
+)
+
+// The interface columns that come with linkUp/linkDown, named the same as
+// in oidWork.
+var trapColumns = map[string]string{
+	".1.3.6.1.2.1.2.2.1.1":     "ifIndex",
+	".1.3.6.1.2.1.2.2.1.2":     "name",
+	".1.3.6.1.2.1.2.2.1.7":     "ifAdminStatus",
+	".1.3.6.1.2.1.2.2.1.8":     "ifOperStatus",
+	".1.3.6.1.2.1.31.1.1.1.1":  "ifName",
+	".1.3.6.1.2.1.31.1.1.1.18": "ifAlias",
+}
+
+// TrapEvent is a trap or inform from a switch.  They are sent upstream as
+// soon as they come in rather than waiting for the next poll.
+type TrapEvent struct {
+	Switch      string `json:"switch"`
+	Source      string `json:"source"`
+	TimeStamp   int64  `json:"timeStamp"`
+	Event       string `json:"event"`
+	TrapOID     string `json:"trapOID"`
+	Inform      bool   `json:"inform,omitempty"`
+	SysUpTime   string `json:"sysUpTime,omitempty"`
+	IfId        string `json:"ifId,omitempty"`
+	IfName      string `json:"ifName,omitempty"`
+	AdminStatus string `json:"adminStatus,omitempty"`
+	OperStatus  string `json:"operStatus,omitempty"`
+	// everything else that came with it by OID.
+	Varbinds map[string]string `json:"varbinds,omitempty"`
+}
+
+// newTrapReceiver sets up the receiver from the environment settings.
+// users look like name:SHA:authpass:AES:privpass.
+func newTrapReceiver(communities string, users string, engineID string) (*trap.Receiver, error) {
+	id := defaultTrapEngineID
+	if engineID != "" {
+		var err error
+		if id, err = hex.DecodeString(engineID); err != nil {
+			return nil, err
+		}
+	}
+	cs := []string{}
+	if communities != "" {
+		cs = strings.Split(communities, ",")
+	}
+	us := []trap.User{}
+	if users != "" {
+		for _, s := range strings.Split(users, ",") {
+			u, err := trap.ParseUser(s)
+			if err != nil {
+				return nil, err
+			}
+			us = append(us, u)
+		}
+	}
+	if len(cs) == 0 && len(us) == 0 {
+		return nil, errors.New("SP_TRAP_COMMUNITIES or SP_TRAP_USERS is needed to accept any traps")
+	}
+	return trap.NewReceiver(id, cs, us), nil
+}
+
+/*
+	Receive SNMP traps and informs
+
+Arguments:
+
+	listen - address to listen on, like :162
+	r - checks and decodes what comes in
+	devices - what endpointAddresses returned, to find the switch name
+
+Runs until ctx is cancelled.
+*/
+func receiveTraps(ctx context.Context, listen string, r *trap.Receiver, devices map[string]string) {
+	conn, err := net.ListenPacket("udp", listen)
+	if err != nil {
+		log.Println("trap receiver: ", err)
+		return
+	}
+	go func() {
+		<-ctx.Done()
+		conn.Close()
+	}()
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Println("trap receiver: ", err)
+			continue
+		}
+		p, reply, err := r.Parse(buf[:n])
+		if err != nil {
+			log.Println("trap from", addr, err)
+			continue
+		}
+		if reply != nil {
+			if _, err := conn.WriteTo(reply, addr); err != nil {
+				log.Println("trap from", addr, err)
+			}
+		}
+		if p != nil {
+			source, _, _ := net.SplitHostPort(addr.String())
+			sendUpstream(newTrapEvent(source, devices, p, time.Now().Unix()))
+		}
+	}
+}
+
+// newTrapEvent pulls out the bits of a trap we know about.
+func newTrapEvent(source string, devices map[string]string, p *trap.Packet, now int64) TrapEvent {
+	e := TrapEvent{
+		Switch:    source,
+		Source:    source,
+		TimeStamp: now,
+		Inform:    p.Inform,
+		Varbinds:  map[string]string{},
+	}
+	if name, ok := devices[source]; ok {
+		e.Switch = name
+	}
+	columns := map[string]string{}
+	for _, pdu := range p.Varbinds {
+		value := pduValue(pdu)
+		switch pdu.Name {
+		case snmpTrapOID:
+			e.TrapOID = value
+			continue
+		case sysUpTime:
+			e.SysUpTime = value
+			continue
+		}
+		// interface columns are named column.ifIndex
+		if i := strings.LastIndex(pdu.Name, "."); i > 0 {
+			if name, ok := trapColumns[pdu.Name[:i]]; ok {
+				columns[name] = value
+				e.IfId = pdu.Name[i+1:]
+				continue
+			}
+		}
+		e.Varbinds[pdu.Name] = value
+	}
+	e.Event = trapNames[e.TrapOID]
+	if e.Event == "" {
+		e.Event = e.TrapOID
+	}
+	e.IfName = columns["ifName"]
+	if e.IfName == "" {
+		e.IfName = columns["name"]
+	}
+	e.AdminStatus = ifStatus(columns["ifAdminStatus"])
+	e.OperStatus = ifStatus(columns["ifOperStatus"])
+	return e
+}
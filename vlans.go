@@ -0,0 +1,278 @@
+package main
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vallard/stickypipe-agent/nxapi"
+)
+
+// VLANSample is one VLAN, its ports and how many MAC addresses were
+// learned in it, when that was counted.
+type VLANSample struct {
+	VLAN  int      `json:"vlan"`
+	Name  string   `json:"name,omitempty"`
+	State string   `json:"state,omitempty"`
+	Ports []string `json:"ports"`
+	MACs  int      `json:"macs,omitempty"`
+}
+
+// PortMACs is how many MAC addresses were learned on a port.  An access
+// port with hundreds is flooding or has a switch hanging off it.
+type PortMACs struct {
+	IfName string `json:"ifName"`
+	IfId   string `json:"ifId,omitempty"`
+	MACs   int    `json:"macs"`
+}
+
+// VLANReport is the VLANs and MAC address counts of one switch, sent with
+// the counters.
+type VLANReport struct {
+	Switch      string       `json:"switch"`
+	TimeStamp   int64        `json:"timeStamp"`
+	VLANs       []VLANSample `json:"vlans"`
+	TotalMACs   int          `json:"totalMacs"`
+	DynamicMACs int          `json:"dynamicMacs,omitempty"`
+	StaticMACs  int          `json:"staticMacs,omitempty"`
+}
+
+// PortMACReport is how many MAC addresses each port of a switch learned.
+// It takes the whole MAC address table, which can be tens of thousands of
+// rows, so it's sent every SP_INVENTORY_INTERVAL rather than with the
+// counters.
+type PortMACReport struct {
+	Switch    string     `json:"switch"`
+	TimeStamp int64      `json:"timeStamp"`
+	Ports     []PortMACs `json:"ports"`
+}
+
+// turn show vlan brief and show mac address-table count into a report.
+// The MAC addresses are only there when the whole table was fetched, then
+// the VLANs get their counts too.  Any of them can be missing.
+func nxapiVLANs(sw string, now int64, vlans []nxapi.VLAN, macs []nxapi.MACAddress, count *nxapi.MACCount) VLANReport {
+	r := VLANReport{Switch: sw, TimeStamp: now, VLANs: []VLANSample{}}
+	perVLAN := map[int]int{}
+	for _, m := range macs {
+		v, _ := strconv.Atoi(m.Disp_Vlan)
+		perVLAN[v]++
+	}
+	for _, v := range vlans {
+		id, err := strconv.Atoi(v.Vlanid)
+		if err != nil {
+			continue
+		}
+		r.VLANs = append(r.VLANs, VLANSample{
+			VLAN:  id,
+			Name:  v.Name,
+			State: v.State,
+			Ports: v.Members(),
+			MACs:  perVLAN[id],
+		})
+	}
+	r.TotalMACs = len(macs)
+	if count != nil {
+		r.TotalMACs = count.Total_Cnt
+		r.DynamicMACs = count.Dyn_Cnt
+		r.StaticMACs = count.Static_Cnt
+	}
+	r.sort()
+	return r
+}
+
+// turn show mac address-table into how many addresses each port learned.
+func nxapiPortMACs(sw string, now int64, macs []nxapi.MACAddress) PortMACReport {
+	r := PortMACReport{Switch: sw, TimeStamp: now, Ports: []PortMACs{}}
+	perPort := map[string]int{}
+	for _, m := range macs {
+		// the switch's own addresses are on sup-eth1 or similar.
+		if m.Disp_Port != "" && !strings.HasPrefix(m.Disp_Port, "sup") {
+			perPort[m.Disp_Port]++
+		}
+	}
+	for port, n := range perPort {
+		r.Ports = append(r.Ports, PortMACs{IfName: port, MACs: n})
+	}
+	r.sort()
+	return r
+}
+
+func (r *VLANReport) sort() {
+	sort.Slice(r.VLANs, func(a, b int) bool { return r.VLANs[a].VLAN < r.VLANs[b].VLAN })
+}
+
+func (r *PortMACReport) sort() {
+	sort.Slice(r.Ports, func(a, b int) bool { return r.Ports[a].MACs > r.Ports[b].MACs })
+}
+
+// Q-BRIDGE-MIB and BRIDGE-MIB.
+const (
+	dot1qVlanStaticName         = ".1.3.6.1.2.1.17.7.1.4.3.1.1"
+	dot1qVlanCurrentEgressPorts = ".1.3.6.1.2.1.17.7.1.4.2.1.4"
+	dot1dBasePortIfIndex        = ".1.3.6.1.2.1.17.1.4.1.2"
+	// indexed by the FDB, which is the VLAN on most switches.
+	dot1qFdbDynamicCount = ".1.3.6.1.2.1.17.7.1.2.1.1.2"
+	// indexed by the FDB and the MAC address.
+	dot1qTpFdbPort = ".1.3.6.1.2.1.17.7.1.2.2.1.2"
+)
+
+/*
+	Walk Q-BRIDGE-MIB on a switch and send up its VLANs and how many MAC
+	addresses each has learned.
+
+Arguments:
+
+	server - the switch
+	creds - the SNMP community string
+	sw - the switch name from sysName
+
+Ports in Q-BRIDGE-MIB are bridge ports, BRIDGE-MIB maps them to ifIndexes.
+Cisco IOS only answers these per VLAN (community@vlan) so it usually has
+nothing here.
+*/
+func collectSNMPVLANs(server string, creds string, sw string) {
+	names := map[string]map[string]string{}
+	egress := map[string]map[string]string{}
+	basePorts := map[string]map[string]string{}
+	counts := map[string]map[string]string{}
+	walkTables(server, creds, []snmpTable{
+		{dot1qVlanStaticName, "name", names},
+		{dot1qVlanCurrentEgressPorts, "ports", egress},
+		{dot1dBasePortIfIndex, "ifIndex", basePorts},
+		{dot1qFdbDynamicCount, "count", counts},
+	})
+	if len(names) == 0 && len(egress) == 0 {
+		return
+	}
+
+	perVLAN := map[int]int{}
+	total := 0
+	for row, v := range counts {
+		n, _ := strconv.Atoi(v["count"])
+		vlan, _ := strconv.Atoi(row)
+		perVLAN[vlan] += n
+		total += n
+	}
+
+	r := VLANReport{Switch: sw, TimeStamp: time.Now().Unix(), VLANs: []VLANSample{}, TotalMACs: total, DynamicMACs: total}
+	vlans := map[int]*VLANSample{}
+	get := func(id int) *VLANSample {
+		if vlans[id] == nil {
+			vlans[id] = &VLANSample{VLAN: id, Ports: []string{}, MACs: perVLAN[id]}
+		}
+		return vlans[id]
+	}
+	for row, v := range names {
+		if id, err := strconv.Atoi(row); err == nil {
+			get(id).Name = v["name"]
+		}
+	}
+	for row, v := range egress {
+		bits := strings.Split(row, ".")
+		id, err := strconv.Atoi(bits[len(bits)-1])
+		if err != nil {
+			continue
+		}
+		s := get(id)
+		for _, port := range portList(v["ports"]) {
+			if name, _ := bridgePortName(server, basePorts, port); name != "" {
+				s.Ports = append(s.Ports, name)
+			}
+		}
+	}
+	for _, s := range vlans {
+		r.VLANs = append(r.VLANs, *s)
+	}
+	r.sort()
+	sendUpstream(r)
+}
+
+/*
+	Walk the Q-BRIDGE-MIB forwarding table on a switch and send up how many
+	MAC addresses each port learned.
+
+Arguments:
+
+	server - the switch
+	creds - the SNMP community string
+	sw - the switch name from sysName
+
+The table has a row per MAC address so this runs on the inventory schedule.
+*/
+func collectSNMPPortMACs(server string, creds string, sw string) {
+	basePorts := map[string]map[string]string{}
+	fdb := map[string]map[string]string{}
+	walkTables(server, creds, []snmpTable{
+		{dot1dBasePortIfIndex, "ifIndex", basePorts},
+		{dot1qTpFdbPort, "port", fdb},
+	})
+	if len(fdb) == 0 {
+		return
+	}
+
+	perPort := map[string]int{}
+	for _, v := range fdb {
+		// port 0 is the switch itself.
+		if v["port"] == "0" {
+			continue
+		}
+		perPort[v["port"]]++
+	}
+	r := PortMACReport{Switch: sw, TimeStamp: time.Now().Unix(), Ports: []PortMACs{}}
+	for port, n := range perPort {
+		name, ifIndex := bridgePortName(server, basePorts, port)
+		if name == "" {
+			continue
+		}
+		r.Ports = append(r.Ports, PortMACs{IfName: name, IfId: ifIndex, MACs: n})
+	}
+	r.sort()
+	sendUpstream(r)
+}
+
+// snmpTable is a column to walk into m with walkTable.
+type snmpTable struct {
+	oid string
+	key string
+	m   map[string]map[string]string
+}
+
+// walkTables walks the columns at the same time.
+func walkTables(server string, creds string, tables []snmpTable) {
+	var wg sync.WaitGroup
+	wg.Add(len(tables))
+	for _, t := range tables {
+		go func(t snmpTable) {
+			defer wg.Done()
+			walkTable(server, creds, t.oid, t.key, t.m)
+		}(t)
+	}
+	wg.Wait()
+}
+
+// bridgePortName maps a bridge port to its interface name and ifIndex with
+// the dot1dBasePortIfIndex walk.
+func bridgePortName(server string, basePorts map[string]map[string]string, basePort string) (string, string) {
+	ifIndex := basePorts[basePort]["ifIndex"]
+	if ifIndex == "" {
+		return "", ""
+	}
+	_, name := lookupInterface(server, ifIndex)
+	return name, ifIndex
+}
+
+// portList reads a Q-BRIDGE-MIB PortList, one bit per bridge port starting
+// at the top bit of the first byte, into bridge port numbers.
+func portList(s string) []string {
+	ports := []string{}
+	for i := 0; i < len(s); i++ {
+		for j := 0; j < 8; j++ {
+			if s[i]&(0x80>>uint(j)) != 0 {
+				ports = append(ports, strconv.Itoa(i*8+j+1))
+			}
+		}
+	}
+	return ports
+}
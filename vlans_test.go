@@ -0,0 +1,53 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/vallard/stickypipe-agent/nxapi"
+)
+
+func TestNXAPIVLANs(t *testing.T) {
+	vlans := []nxapi.VLAN{
+		{Vlanid: "20", Name: "servers", State: "active", Ports: []string{"Ethernet1/3-4,port-channel10"}},
+		{Vlanid: "1", Name: "default", State: "active", Ports: []string{"Ethernet1/1"}},
+	}
+	count := &nxapi.MACCount{Dyn_Cnt: 4, Static_Cnt: 1, Total_Cnt: 5}
+
+	// between inventories there's only the count.
+	got := nxapiVLANs("leaf1", 1, vlans, nil, count)
+	want := VLANReport{
+		Switch:    "leaf1",
+		TimeStamp: 1,
+		VLANs: []VLANSample{
+			{VLAN: 1, Name: "default", State: "active", Ports: []string{"Ethernet1/1"}},
+			{VLAN: 20, Name: "servers", State: "active", Ports: []string{"Ethernet1/3", "Ethernet1/4", "port-channel10"}},
+		},
+		TotalMACs:   5,
+		DynamicMACs: 4,
+		StaticMACs:  1,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %+v\nwant %+v", got, want)
+	}
+
+	macs := []nxapi.MACAddress{
+		{Disp_Mac_Addr: "0050.5601.0001", Disp_Vlan: "20", Disp_Port: "Ethernet1/3"},
+		{Disp_Mac_Addr: "0050.5601.0002", Disp_Vlan: "20", Disp_Port: "Ethernet1/3"},
+		{Disp_Mac_Addr: "0050.5601.0003", Disp_Vlan: "20", Disp_Port: "port-channel10"},
+		{Disp_Mac_Addr: "0050.5601.0004", Disp_Vlan: "1", Disp_Port: "Ethernet1/1"},
+		{Disp_Mac_Addr: "00de.fb00.0001", Disp_Vlan: "1", Disp_Is_Static: "enabled", Disp_Port: "sup-eth1(R)"},
+	}
+	got = nxapiVLANs("leaf1", 1, vlans, macs, count)
+	want.VLANs[0].MACs = 2
+	want.VLANs[1].MACs = 3
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("with the table:\ngot  %+v\nwant %+v", got, want)
+	}
+
+	ports := nxapiPortMACs("leaf1", 1, macs)
+	wantPorts := []PortMACs{{IfName: "Ethernet1/3", MACs: 2}}
+	if len(ports.Ports) != 3 || !reflect.DeepEqual(ports.Ports[:1], wantPorts) {
+		t.Errorf("ports %+v", ports.Ports)
+	}
+}
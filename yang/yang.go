@@ -0,0 +1,124 @@
+package yang
+
+import (
+	"strconv"
+	"strings"
+)
+
+/* The interface models that NETCONF and RESTCONF devices share.  The same
+structs are used for the XML that comes back over NETCONF and the JSON that
+comes back over RESTCONF, so they carry both tags.
+*/
+
+// Counter is a 64 bit counter.  In JSON (RFC 7951) 64 bit numbers are sent
+// as strings but plenty of devices send plain numbers anyway, so we take
+// both.  In XML it is just text.
+type Counter uint64
+
+func (c *Counter) UnmarshalJSON(b []byte) error {
+	s := strings.Trim(string(b), `"`)
+	if s == "" || s == "null" {
+		return nil
+	}
+	u, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return err
+	}
+	*c = Counter(u)
+	return nil
+}
+
+// ietf-interfaces (RFC 7223) keeps state in /interfaces-state.  RFC 8343
+// moved it into /interfaces, which is the same list with the same leaves.
+const IETFInterfacesNamespace = "urn:ietf:params:xml:ns:yang:ietf-interfaces"
+
+type IETFInterfaces struct {
+	Interfaces []IETFInterface `xml:"interface" json:"interface"`
+}
+
+type IETFInterface struct {
+	Name        string         `xml:"name" json:"name"`
+	Description string         `xml:"description" json:"description"`
+	Type        string         `xml:"type" json:"type"`
+	AdminStatus string         `xml:"admin-status" json:"admin-status"`
+	OperStatus  string         `xml:"oper-status" json:"oper-status"`
+	IfIndex     int            `xml:"if-index" json:"if-index"`
+	PhysAddress string         `xml:"phys-address" json:"phys-address"`
+	Speed       Counter        `xml:"speed" json:"speed"`
+	Statistics  IETFStatistics `xml:"statistics" json:"statistics"`
+}
+
+type IETFStatistics struct {
+	InOctets         Counter `xml:"in-octets" json:"in-octets"`
+	InUnicastPkts    Counter `xml:"in-unicast-pkts" json:"in-unicast-pkts"`
+	InBroadcastPkts  Counter `xml:"in-broadcast-pkts" json:"in-broadcast-pkts"`
+	InMulticastPkts  Counter `xml:"in-multicast-pkts" json:"in-multicast-pkts"`
+	InDiscards       Counter `xml:"in-discards" json:"in-discards"`
+	InErrors         Counter `xml:"in-errors" json:"in-errors"`
+	OutOctets        Counter `xml:"out-octets" json:"out-octets"`
+	OutUnicastPkts   Counter `xml:"out-unicast-pkts" json:"out-unicast-pkts"`
+	OutBroadcastPkts Counter `xml:"out-broadcast-pkts" json:"out-broadcast-pkts"`
+	OutMulticastPkts Counter `xml:"out-multicast-pkts" json:"out-multicast-pkts"`
+	OutDiscards      Counter `xml:"out-discards" json:"out-discards"`
+	OutErrors        Counter `xml:"out-errors" json:"out-errors"`
+}
+
+// openconfig-interfaces puts everything we want under interface/state.
+const OpenConfigInterfacesNamespace = "http://openconfig.net/yang/interfaces"
+
+type OpenConfigInterfaces struct {
+	Interfaces []OpenConfigInterface `xml:"interface" json:"interface"`
+}
+
+type OpenConfigInterface struct {
+	Name  string                   `xml:"name" json:"name"`
+	State OpenConfigInterfaceState `xml:"state" json:"state"`
+}
+
+type OpenConfigInterfaceState struct {
+	Name        string             `xml:"name" json:"name"`
+	Description string             `xml:"description" json:"description"`
+	Mtu         int                `xml:"mtu" json:"mtu"`
+	IfIndex     int                `xml:"ifindex" json:"ifindex"`
+	AdminStatus string             `xml:"admin-status" json:"admin-status"`
+	OperStatus  string             `xml:"oper-status" json:"oper-status"`
+	Counters    OpenConfigCounters `xml:"counters" json:"counters"`
+}
+
+type OpenConfigCounters struct {
+	InOctets         Counter `xml:"in-octets" json:"in-octets"`
+	InUnicastPkts    Counter `xml:"in-unicast-pkts" json:"in-unicast-pkts"`
+	InBroadcastPkts  Counter `xml:"in-broadcast-pkts" json:"in-broadcast-pkts"`
+	InMulticastPkts  Counter `xml:"in-multicast-pkts" json:"in-multicast-pkts"`
+	InDiscards       Counter `xml:"in-discards" json:"in-discards"`
+	InErrors         Counter `xml:"in-errors" json:"in-errors"`
+	InFcsErrors      Counter `xml:"in-fcs-errors" json:"in-fcs-errors"`
+	OutOctets        Counter `xml:"out-octets" json:"out-octets"`
+	OutUnicastPkts   Counter `xml:"out-unicast-pkts" json:"out-unicast-pkts"`
+	OutBroadcastPkts Counter `xml:"out-broadcast-pkts" json:"out-broadcast-pkts"`
+	OutMulticastPkts Counter `xml:"out-multicast-pkts" json:"out-multicast-pkts"`
+	OutDiscards      Counter `xml:"out-discards" json:"out-discards"`
+	OutErrors        Counter `xml:"out-errors" json:"out-errors"`
+}
+
+// Status lower cases the status so UP (openconfig) and up (ietf) match what
+// the other collectors report.
+func Status(s string) string {
+	return strings.ToLower(s)
+}
+
+// ietf-system (RFC 7317), for the hostname and what the device is running.
+const IETFSystemNamespace = "urn:ietf:params:xml:ns:yang:ietf-system"
+
+type IETFSystem struct {
+	Hostname string `xml:"hostname" json:"hostname"`
+}
+
+type IETFSystemState struct {
+	Platform struct {
+		OSName    string `xml:"os-name" json:"os-name"`
+		OSRelease string `xml:"os-release" json:"os-release"`
+		OSVersion string `xml:"os-version" json:"os-version"`
+		Machine   string `xml:"machine" json:"machine"`
+	} `xml:"platform" json:"platform"`
+}